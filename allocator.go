@@ -0,0 +1,126 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dolthub/maphash"
+)
+
+// GroupSize is the number of slots in a group, i.e., the length of the arrays in the slot buffers of a Set3.
+const GroupSize = set3groupSize
+
+// ErrBufferSize is returned by [EmptyWithBuffers] if the given buffers cannot be used as backing storage of a Set3.
+var ErrBufferSize = errors.New("set3: invalid buffer size")
+
+/*
+Allocator provides the backing storage of a Set3 whenever the set needs to rehash, e.g., to carve sets out of a big slab of memory (arena-style) or out of memory mapped files.
+It must return a control buffer and a slot buffer of at least numGroups elements each. The buffers must not be in use by any set.
+Their content does not matter, the set initializes them as required.
+
+Caution: The garbage collector does not scan memory that has not been allocated by Go. If T contains pointers, the buffers must be allocated by Go.
+
+Example:
+
+	slabCtrl := make([]uint64, 1_000_000)
+	slabSlot := make([][GroupSize]uint64, 1_000_000)
+	next := 0
+	alloc := func(numGroups uint32) ([]uint64, [][GroupSize]uint64) {
+		from, to := next, next+int(numGroups)
+		next = to
+		return slabCtrl[from:to:to], slabSlot[from:to:to]
+	}
+*/
+type Allocator[T comparable] func(numGroups uint32) (groupCtrl []uint64, groupSlot [][GroupSize]T)
+
+/*
+RequiredGroups returns the number of groups a Set3 with the given options needs to hold capacity elements.
+Use it to size the buffers passed to [EmptyWithBuffers].
+
+Example:
+
+	numGroups := RequiredGroups(1000)
+	set, err := EmptyWithBuffers(make([]uint64, numGroups), make([][GroupSize]int, numGroups), nil)
+*/
+func RequiredGroups(capacity uint32, options ...Option) uint32 {
+	return calcReqNrOfGroupsForLoad(capacity, buildOptions(options).maxAvgGroupLoad)
+}
+
+/*
+EmptyWithBuffers creates a new and empty Set3 that uses the given buffers as backing storage. Both buffers must have the same, non-zero length.
+The capacity of the set is determined by the length of the buffers (see [RequiredGroups]). The content of the buffers is overwritten.
+
+If the set needs to rehash, it asks allocator for new buffers. If allocator is nil, new buffers are allocated on the heap.
+Sets created from this set, e.g., by [Set3.Clone] or [Set3.Unite], use the same allocator.
+
+Returns an error wrapping [ErrBufferSize] if the buffers cannot be used.
+
+Example:
+
+	numGroups := RequiredGroups(1000)
+	set, err := EmptyWithBuffers(make([]uint64, numGroups), make([][GroupSize]int, numGroups), nil)
+	if err != nil {
+		// handle error
+	}
+	set.Add(1)
+*/
+func EmptyWithBuffers[T comparable](groupCtrl []uint64, groupSlot [][GroupSize]T, allocator Allocator[T], options ...Option) (*Set3[T], error) {
+	if len(groupCtrl) == 0 {
+		return nil, fmt.Errorf("%w: control buffer is empty", ErrBufferSize)
+	}
+	if len(groupCtrl) != len(groupSlot) {
+		return nil, fmt.Errorf("%w: control buffer has %d groups, slot buffer has %d groups", ErrBufferSize, len(groupCtrl), len(groupSlot))
+	}
+	if uint64(len(groupCtrl)) > uint64(^uint32(0)) {
+		return nil, fmt.Errorf("%w: %d groups exceed the maximum number of groups", ErrBufferSize, len(groupCtrl))
+	}
+	opts := buildOptions(options)
+	numGroups := uint32(len(groupCtrl)) //nolint:gosec
+	opts.minNumGroups = numGroups
+	result := &Set3[T]{
+		hashFunction: maphash.NewHasher[T](),
+		elementLimit: calcElementLimit(numGroups, opts.maxAvgGroupLoad),
+		groupCtrl:    groupCtrl,
+		groupSlot:    groupSlot,
+		options:      opts,
+		allocator:    allocator,
+	}
+	result.clearInPlace()
+	return result, nil
+}
+
+// allocate returns new buffers for numGroups groups, either from the allocator of
+// thisSet or from the heap. The control bytes are initialized to empty.
+func (thisSet *Set3[T]) allocate(numGroups uint32) ([]uint64, [][set3groupSize]T) {
+	var groupCtrl []uint64
+	var groupSlot [][set3groupSize]T
+	if thisSet.allocator == nil {
+		groupCtrl = make([]uint64, numGroups)
+		groupSlot = make([][set3groupSize]T, numGroups)
+	} else {
+		groupCtrl, groupSlot = thisSet.allocator(numGroups)
+		if uint64(len(groupCtrl)) < uint64(numGroups) || uint64(len(groupSlot)) < uint64(numGroups) {
+			panic(fmt.Sprintf("set3: allocator returned %d/%d groups, %d groups requested", len(groupCtrl), len(groupSlot), numGroups))
+		}
+		groupCtrl, groupSlot = groupCtrl[:numGroups], groupSlot[:numGroups]
+		clear(groupSlot)
+	}
+	for i := range groupCtrl {
+		groupCtrl[i] = set3AllEmpty
+	}
+	return groupCtrl, groupSlot
+}
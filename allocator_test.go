@@ -0,0 +1,114 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSlab struct {
+	ctrl  []uint64
+	slot  [][GroupSize]uint64
+	next  int
+	calls int
+}
+
+func (slab *testSlab) allocate(numGroups uint32) ([]uint64, [][GroupSize]uint64) {
+	from, to := slab.next, slab.next+int(numGroups)
+	slab.next = to
+	slab.calls++
+	return slab.ctrl[from:to:to], slab.slot[from:to:to]
+}
+
+func TestEmptyWithBuffers(t *testing.T) {
+	numGroups := RequiredGroups(100)
+	assert.Equal(t, uint32(16), numGroups)
+	ctrl := make([]uint64, numGroups)
+	slot := make([][GroupSize]uint64, numGroups)
+	for i := range slot {
+		ctrl[i] = 0x0102030405060708 // garbage shall be overwritten
+		slot[i][3] = 42
+	}
+	set, err := EmptyWithBuffers(ctrl, slot, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0), set.Size())
+	assert.False(t, set.Contains(42))
+	for i := range uint64(100) {
+		set.Add(i)
+	}
+	assert.Equal(t, &ctrl[0], &set.groupCtrl[0], "set shall use the given control buffer")
+	assert.Equal(t, &slot[0], &set.groupSlot[0], "set shall use the given slot buffer")
+	for i := range uint64(100) {
+		assert.True(t, set.Contains(i))
+	}
+	// growing without allocator falls back to the heap
+	for i := range uint64(1000) {
+		set.Add(i)
+	}
+	assert.Equal(t, uint32(1000), set.Size())
+}
+
+func TestEmptyWithBuffersInvalid(t *testing.T) {
+	_, err := EmptyWithBuffers[int](nil, nil, nil)
+	assert.True(t, errors.Is(err, ErrBufferSize))
+	_, err = EmptyWithBuffers(make([]uint64, 4), make([][GroupSize]int, 3), nil)
+	assert.True(t, errors.Is(err, ErrBufferSize))
+	_, err = EmptyWithBuffers(make([]uint64, 4), make([][GroupSize]int, 4), nil)
+	assert.NoError(t, err)
+}
+
+func TestEmptyWithBuffersAllocator(t *testing.T) {
+	slab := &testSlab{
+		ctrl: make([]uint64, 10_000),
+		slot: make([][GroupSize]uint64, 10_000),
+	}
+	ctrl, slot := slab.allocate(1)
+	set, err := EmptyWithBuffers(ctrl, slot, slab.allocate)
+	require.NoError(t, err)
+	for i := range uint64(10_000) {
+		set.Add(i)
+	}
+	assert.Greater(t, slab.calls, 1, "set shall ask the allocator for new buffers when growing")
+	for i := range uint64(10_000) {
+		assert.True(t, set.Contains(i))
+	}
+	assert.Equal(t, &slab.ctrl[slab.next-len(set.groupCtrl)], &set.groupCtrl[0], "set shall live in the slab")
+
+	calls := slab.calls
+	clone := set.Clone()
+	assert.Equal(t, calls+1, slab.calls, "clone shall be allocated by the allocator")
+	assert.True(t, clone.Equals(set))
+
+	union := set.Unite(From[uint64](20_000))
+	assert.Equal(t, calls+2, slab.calls, "results of set operations shall be allocated by the allocator")
+	assert.Equal(t, uint32(10_001), union.Size())
+}
+
+func TestAllocatorTooSmall(t *testing.T) {
+	tooSmall := func(numGroups uint32) ([]uint64, [][GroupSize]int) {
+		return make([]uint64, numGroups-1), make([][GroupSize]int, numGroups)
+	}
+	set, err := EmptyWithBuffers(make([]uint64, 1), make([][GroupSize]int, 1), tooSmall)
+	require.NoError(t, err)
+	assert.Panics(t, func() {
+		for i := range 100 {
+			set.Add(i)
+		}
+	})
+}
@@ -0,0 +1,457 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"iter"
+	"math"
+	"math/bits"
+)
+
+// BitSetElement is a constraint that permits the unsigned integer types a [BitSet] can hold.
+type BitSetElement interface {
+	~uint8 | ~uint16 | ~uint32
+}
+
+/*
+BitSet is a set of small unsigned integers, stored as a bitmap with one bit per possible element. For dense domains, e.g. a Set3[uint16]
+with many elements, it needs a fraction of the memory of a Set3, and Unite, Intersect, Subtract etc. work on 64 elements at a time.
+The memory consumption depends on the biggest element, not on the number of elements: a BitSet containing only 1<<31 needs 256 MiB.
+
+BitSet has the same method vocabulary as [Set3]. Use [BitSetFromSet3] and [BitSet.ToSet3] to switch between the representations.
+Unlike Set3, a BitSet iterates over its elements in ascending order.
+*/
+type BitSet[T BitSetElement] struct {
+	words []uint64
+	size  uint64 // a BitSet[uint32] can hold 2^32 elements
+}
+
+/*
+EmptyBitSet creates a new and empty BitSet. It grows as elements are added.
+
+Example:
+
+	set := EmptyBitSet[uint16]()
+	set.Add(1)
+*/
+func EmptyBitSet[T BitSetElement]() *BitSet[T] {
+	return &BitSet[T]{}
+}
+
+/*
+EmptyBitSetWithCapacity creates a new and empty BitSet that can hold the elements 0 to maxElement without growing.
+
+Example:
+
+	set := EmptyBitSetWithCapacity[uint16](1000)
+*/
+func EmptyBitSetWithCapacity[T BitSetElement](maxElement T) *BitSet[T] {
+	return &BitSet[T]{words: make([]uint64, uint64(maxElement)/64+1)}
+}
+
+/*
+BitSetFrom creates a new BitSet containing all elements passed as arguments.
+
+Example:
+
+	set := BitSetFrom[uint16](1, 2, 3)
+*/
+func BitSetFrom[T BitSetElement](args ...T) *BitSet[T] {
+	return BitSetFromArray(args)
+}
+
+/*
+BitSetFromArray creates a new BitSet containing all elements of data.
+
+Example:
+
+	set := BitSetFromArray([]uint16{1, 2, 3})
+*/
+func BitSetFromArray[T BitSetElement](data []T) *BitSet[T] {
+	result := EmptyBitSet[T]()
+	result.AddAllFromArray(data)
+	return result
+}
+
+/*
+BitSetFromSet3 creates a new BitSet containing all elements of set. nil is interpreted as empty set.
+
+Example:
+
+	set := From[uint16](1, 2, 3)
+	bitSet := BitSetFromSet3(set)
+*/
+func BitSetFromSet3[T BitSetElement](set *Set3[T]) *BitSet[T] {
+	result := EmptyBitSet[T]()
+	if set != nil {
+		for e := range set.MutableRange() {
+			result.Add(e)
+		}
+	}
+	return result
+}
+
+/*
+ToSet3 creates a new Set3 containing all elements of thisSet.
+
+Example:
+
+	bitSet := BitSetFrom[uint16](1, 2, 3)
+	set := bitSet.ToSet3()
+*/
+func (thisSet *BitSet[T]) ToSet3() *Set3[T] {
+	result := EmptyWithCapacity[T](uint32(min(thisSet.size, math.MaxUint32)))
+	for e := range thisSet.MutableRange() {
+		result.Add(e)
+	}
+	return result
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation, in ascending order.
+
+Example:
+
+	set := BitSetFrom[uint16](3, 1, 2)
+	fmt.Println(set) // will print "{1,2,3}"
+*/
+func (thisSet *BitSet[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), set3formatValue)
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *BitSet[T]) Clone() *BitSet[T] {
+	return &BitSet[T]{words: append([]uint64(nil), thisSet.words...), size: thisSet.size}
+}
+
+/*
+Size returns the number of elements in thisSet. Unlike [Set3.Size], it returns a uint64, as a BitSet[uint32] can hold all 2^32 possible elements.
+*/
+func (thisSet *BitSet[T]) Size() uint64 {
+	return thisSet.size
+}
+
+/*
+Checks if thisSet contains the element.
+*/
+func (thisSet *BitSet[T]) Contains(element T) bool {
+	w := uint64(element) / 64
+	return w < uint64(len(thisSet.words)) && thisSet.words[w]&(1<<(uint64(element)%64)) != 0
+}
+
+/*
+Inserts the element into thisSet if it is not yet in thisSet.
+*/
+func (thisSet *BitSet[T]) Add(element T) {
+	w := uint64(element) / 64
+	if w >= uint64(len(thisSet.words)) {
+		thisSet.grow(int(w) + 1)
+	}
+	mask := uint64(1) << (uint64(element) % 64)
+	if thisSet.words[w]&mask == 0 {
+		thisSet.words[w] |= mask
+		thisSet.size++
+	}
+}
+
+func (thisSet *BitSet[T]) grow(numWords int) {
+	if numWords <= len(thisSet.words) {
+		return
+	}
+	if numWords <= cap(thisSet.words) {
+		thisSet.words = thisSet.words[:numWords]
+		return
+	}
+	newWords := make([]uint64, numWords, max(numWords, 2*len(thisSet.words)))
+	copy(newWords, thisSet.words)
+	thisSet.words = newWords
+}
+
+/*
+Inserts all elements from thatSet that are not yet in thisSet into thisSet. If thatSet is nil, nothing is added to thisSet.
+*/
+func (thisSet *BitSet[T]) AddAll(thatSet *BitSet[T]) {
+	if thatSet == nil {
+		return
+	}
+	thisSet.grow(len(thatSet.words))
+	for i, w := range thatSet.words {
+		thisSet.words[i] |= w
+	}
+	thisSet.recount()
+}
+
+/*
+Inserts all parameter values that are not yet in thisSet into thisSet.
+*/
+func (thisSet *BitSet[T]) AddAllOf(args ...T) {
+	thisSet.AddAllFromArray(args)
+}
+
+/*
+Inserts all elements from the given data array that are not yet in thisSet into thisSet.
+*/
+func (thisSet *BitSet[T]) AddAllFromArray(data []T) {
+	for _, e := range data {
+		thisSet.Add(e)
+	}
+}
+
+/*
+Removes the element from thisSet if it is in thisSet. Returns true if the element was removed.
+*/
+func (thisSet *BitSet[T]) Remove(element T) bool {
+	if !thisSet.Contains(element) {
+		return false
+	}
+	thisSet.words[uint64(element)/64] &^= 1 << (uint64(element) % 64)
+	thisSet.size--
+	return true
+}
+
+/*
+Removes all elements from thisSet that are in thatSet. If thatSet is nil, nothing happens.
+*/
+func (thisSet *BitSet[T]) RemoveAll(thatSet *BitSet[T]) {
+	if thatSet == nil {
+		return
+	}
+	for i := range min(len(thisSet.words), len(thatSet.words)) {
+		thisSet.words[i] &^= thatSet.words[i]
+	}
+	thisSet.recount()
+}
+
+/*
+Removes all elements from thisSet that are passed as arguments.
+*/
+func (thisSet *BitSet[T]) RemoveAllOf(args ...T) {
+	thisSet.RemoveAllFromArray(args)
+}
+
+/*
+Removes all elements from thisSet that are in the data array.
+*/
+func (thisSet *BitSet[T]) RemoveAllFromArray(data []T) {
+	for _, e := range data {
+		thisSet.Remove(e)
+	}
+}
+
+/*
+Clear removes all elements from thisSet. The memory is retained for future use.
+*/
+func (thisSet *BitSet[T]) Clear() {
+	clear(thisSet.words)
+	thisSet.size = 0
+}
+
+func (thisSet *BitSet[T]) recount() {
+	size := uint64(0)
+	for _, w := range thisSet.words {
+		size += uint64(bits.OnesCount64(w))
+	}
+	thisSet.size = size
+}
+
+/*
+Creates a new BitSet as a mathematical union of the elements from thisSet and thatSet. If thatSet is nil, Unite returns a clone of thisSet.
+
+Example:
+
+	set1 := BitSetFrom[uint16](1, 2)
+	set2 := BitSetFrom[uint16](2, 3)
+	u := set1.Unite(set2) // set1 and set2 remain unchanged, u will contain 1, 2, 3
+*/
+func (thisSet *BitSet[T]) Unite(thatSet *BitSet[T]) *BitSet[T] {
+	result := thisSet.Clone()
+	result.AddAll(thatSet)
+	return result
+}
+
+/*
+Creates a new BitSet as a mathematical intersection between thisSet and thatSet. If thatSet is nil, Intersect returns an empty BitSet.
+
+Example:
+
+	set1 := BitSetFrom[uint16](1, 2, 3)
+	set2 := BitSetFrom[uint16](3, 4)
+	intersect := set1.Intersect(set2) // set1 and set2 are not altered, intersect will contain 3
+*/
+func (thisSet *BitSet[T]) Intersect(thatSet *BitSet[T]) *BitSet[T] {
+	if thatSet == nil {
+		return EmptyBitSet[T]()
+	}
+	result := &BitSet[T]{words: make([]uint64, min(len(thisSet.words), len(thatSet.words)))}
+	for i := range result.words {
+		result.words[i] = thisSet.words[i] & thatSet.words[i]
+	}
+	result.recount()
+	return result
+}
+
+/*
+Creates a new BitSet as a mathematical difference between thisSet and thatSet. If thatSet is nil, Subtract returns a clone of thisSet.
+
+Example:
+
+	set1 := BitSetFrom[uint16](1, 2, 3)
+	set2 := BitSetFrom[uint16](3, 4)
+	d := set1.Subtract(set2) // set1 and set2 are not altered, d will contain 1, 2
+*/
+func (thisSet *BitSet[T]) Subtract(thatSet *BitSet[T]) *BitSet[T] {
+	result := thisSet.Clone()
+	result.RemoveAll(thatSet)
+	return result
+}
+
+/*
+Returns true if thisSet and thatSet contain the same elements. If thatSet is nil, Equals returns true if and only if thisSet is empty.
+*/
+func (thisSet *BitSet[T]) Equals(thatSet *BitSet[T]) bool {
+	if thatSet == nil {
+		return thisSet.size == 0
+	}
+	if thisSet.size != thatSet.size {
+		return false
+	}
+	for i := range min(len(thisSet.words), len(thatSet.words)) {
+		if thisSet.words[i] != thatSet.words[i] {
+			return false
+		}
+	}
+	// the remaining words of the longer set are empty, as both sets have the same size
+	return true
+}
+
+/*
+Checks if thisSet contains all elements from thatSet. Returns true if thatSet is nil.
+*/
+func (thisSet *BitSet[T]) ContainsAll(thatSet *BitSet[T]) bool {
+	if thatSet == nil {
+		return true
+	}
+	for i, w := range thatSet.words {
+		var own uint64
+		if i < len(thisSet.words) {
+			own = thisSet.words[i]
+		}
+		if w&^own != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Checks if thisSet contains all of the given argument values.
+*/
+func (thisSet *BitSet[T]) ContainsAllOf(args ...T) bool {
+	return thisSet.ContainsAllFromArray(args)
+}
+
+/*
+Checks if thisSet contains all elements from the given data array.
+*/
+func (thisSet *BitSet[T]) ContainsAllFromArray(data []T) bool {
+	for _, e := range data {
+		if !thisSet.Contains(e) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Checks if thisSet contains any element from thatSet. Returns false if thatSet is nil.
+*/
+func (thisSet *BitSet[T]) ContainsAny(thatSet *BitSet[T]) bool {
+	if thatSet == nil {
+		return false
+	}
+	for i := range min(len(thisSet.words), len(thatSet.words)) {
+		if thisSet.words[i]&thatSet.words[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Checks if thisSet contains any of the given argument values.
+*/
+func (thisSet *BitSet[T]) ContainsAnyOf(args ...T) bool {
+	return thisSet.ContainsAnyFromArray(args)
+}
+
+/*
+Checks if thisSet contains any element from the given data array.
+*/
+func (thisSet *BitSet[T]) ContainsAnyFromArray(data []T) bool {
+	for _, e := range data {
+		if thisSet.Contains(e) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Iterates over all elements in thisSet in ascending order.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [BitSet.ImmutableRange].
+*/
+func (thisSet *BitSet[T]) MutableRange() iter.Seq[T] {
+	return bitSetRange[T](thisSet.words)
+}
+
+/*
+Iterates over all elements in thisSet in ascending order.
+
+Makes an internal copy of the bitmap first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *BitSet[T]) ImmutableRange() iter.Seq[T] {
+	return bitSetRange[T](append([]uint64(nil), thisSet.words...))
+}
+
+func bitSetRange[T BitSetElement](words []uint64) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i, w := range words {
+			for w != 0 {
+				bit := bits.TrailingZeros64(w)
+				w &= w - 1
+				if !yield(T(i*64 + bit)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+/*
+ToArray allocates an array of type T and adds all elements of thisSet to it in ascending order.
+*/
+func (thisSet *BitSet[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.size)
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randomUint16Set3(rng *rand.Rand, n int, limit int) *Set3[uint16] {
+	result := Empty[uint16]()
+	for range n {
+		result.Add(uint16(rng.IntN(limit))) //nolint:gosec
+	}
+	return result
+}
+
+func TestBitSetMatchesSet3(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4)) //nolint:gosec
+	for range 50 {
+		a := randomUint16Set3(rng, rng.IntN(2000), 1+rng.IntN(65536))
+		b := randomUint16Set3(rng, rng.IntN(2000), 1+rng.IntN(65536))
+		bitA := BitSetFromSet3(a)
+		bitB := BitSetFromSet3(b)
+		assert.Equal(t, uint64(a.Size()), bitA.Size())
+		assert.True(t, a.Equals(bitA.ToSet3()))
+		assert.True(t, a.Unite(b).Equals(bitA.Unite(bitB).ToSet3()))
+		assert.True(t, a.Intersect(b).Equals(bitA.Intersect(bitB).ToSet3()))
+		assert.True(t, a.Subtract(b).Equals(bitA.Subtract(bitB).ToSet3()))
+		assert.Equal(t, uint64(a.Intersect(b).Size()), bitA.Intersect(bitB).Size())
+		assert.Equal(t, a.ContainsAll(b), bitA.ContainsAll(bitB))
+		assert.Equal(t, a.ContainsAny(b), bitA.ContainsAny(bitB))
+		assert.True(t, bitA.Unite(bitB).ContainsAll(bitA))
+		assert.Equal(t, a.Equals(b), bitA.Equals(bitB))
+		for range 100 {
+			e := uint16(rng.IntN(65536)) //nolint:gosec
+			assert.Equal(t, a.Contains(e), bitA.Contains(e))
+		}
+	}
+}
+
+func TestBitSetAddRemove(t *testing.T) {
+	set := EmptyBitSet[uint32]()
+	set.AddAllOf(1, 64, 1000, 64)
+	assert.Equal(t, uint64(3), set.Size())
+	assert.True(t, set.ContainsAllOf(1, 64, 1000))
+	assert.False(t, set.ContainsAllOf(1, 2))
+	assert.True(t, set.ContainsAnyOf(2, 1000))
+	assert.False(t, set.ContainsAnyOf(2, 1_000_000))
+	assert.True(t, set.Remove(64))
+	assert.False(t, set.Remove(64))
+	assert.False(t, set.Remove(1_000_000), "removing an element beyond the bitmap shall be a no-op")
+	set.RemoveAllOf(1, 2)
+	assert.Equal(t, []uint32{1000}, set.ToArray())
+	set.Clear()
+	assert.Equal(t, uint64(0), set.Size())
+	assert.False(t, set.Contains(1000))
+
+	capacity := EmptyBitSetWithCapacity[uint8](255)
+	capacity.Add(255)
+	assert.Equal(t, 4, len(capacity.words))
+	assert.True(t, capacity.Contains(255))
+}
+
+func TestBitSetSizeDoesNotWrap(t *testing.T) {
+	// a full BitSet[uint32] needs 512 MiB, so pretend that all other elements are present
+	set := EmptyBitSet[uint32]()
+	set.size = math.MaxUint32
+	set.Add(7)
+	assert.Equal(t, uint64(1)<<32, set.Size())
+	set.Remove(7)
+	assert.Equal(t, uint64(math.MaxUint32), set.Size())
+}
+
+func TestBitSetEqualsDifferentLengths(t *testing.T) {
+	a := BitSetFrom[uint16](1, 2, 60000)
+	b := BitSetFrom[uint16](1, 2)
+	a.Remove(60000)
+	assert.True(t, a.Equals(b))
+	assert.True(t, b.Equals(a))
+	assert.True(t, a.ContainsAll(b))
+	assert.True(t, b.ContainsAll(a))
+	assert.True(t, EmptyBitSet[uint16]().Equals(nil))
+	assert.False(t, b.Equals(nil))
+	assert.True(t, b.ContainsAll(nil))
+	assert.False(t, b.ContainsAny(nil))
+	assert.Equal(t, uint64(0), b.Intersect(nil).Size())
+	assert.True(t, b.Unite(nil).Equals(b))
+	assert.True(t, b.Subtract(nil).Equals(b))
+}
+
+func TestBitSetRanges(t *testing.T) {
+	set := BitSetFrom[uint16](500, 3, 64, 63, 0)
+	assert.Equal(t, "{0,3,63,64,500}", set.String())
+	assert.Equal(t, []uint16{0, 3, 63, 64, 500}, slices.Collect(set.MutableRange()))
+	for e := range set.ImmutableRange() {
+		set.Remove(e)
+		set.Add(e + 1000)
+	}
+	assert.Equal(t, []uint16{1000, 1003, 1063, 1064, 1500}, set.ToArray())
+	for e := range set.MutableRange() {
+		if e > 1003 {
+			break
+		}
+	}
+	var nilSet *BitSet[uint16]
+	assert.Equal(t, "{nil}", nilSet.String())
+	assert.Equal(t, uint64(0), BitSetFromSet3[uint16](nil).Size())
+}
@@ -0,0 +1,451 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/dolthub/maphash"
+)
+
+/*
+EvictionPolicy selects the element a [BoundedSet3] removes when a new element is added to a full set.
+*/
+type EvictionPolicy int
+
+const (
+	// EvictFIFO evicts the element that has been added first.
+	EvictFIFO EvictionPolicy = iota
+	// EvictLRU evicts the element that has been added or found by Contains least recently.
+	EvictLRU
+	// EvictRandom evicts a random element.
+	EvictRandom
+	// EvictCLOCK approximates LRU: it evicts the next element in slot order that has not been added or found by Contains
+	// since the last time the clock hand passed it.
+	EvictCLOCK
+)
+
+/*
+Returns the name of the policy.
+*/
+func (policy EvictionPolicy) String() string {
+	switch policy {
+	case EvictFIFO:
+		return "FIFO"
+	case EvictLRU:
+		return "LRU"
+	case EvictRandom:
+		return "Random"
+	case EvictCLOCK:
+		return "CLOCK"
+	}
+	return fmt.Sprintf("EvictionPolicy(%d)", int(policy))
+}
+
+const boundedNil = math.MaxUint32
+
+/*
+BoundedSet3 is a set with a hard limit on the number of its elements, e.g. for caches of seen keys. It uses the same Swiss table
+layout as Set3, allocated once for the maximum size. When an element is added to a full set, a victim chosen by the [EvictionPolicy]
+is removed in place and reported to the eviction callback. The tombstones left behind by evictions are purged by rehashing within
+the same table, which uses one additional buffer of maxSize elements, allocated on the first purge.
+
+With [EvictLRU] and [EvictCLOCK], Contains records the access, so it changes thisSet like Add does.
+*/
+type BoundedSet3[T comparable] struct {
+	hashFunction maphash.Hasher[T]
+	policy       EvictionPolicy
+	onEvict      func(T)
+	maxSize      uint32
+	set3table
+	groupSlot [][set3groupSize]T
+	// FIFO and LRU keep the elements in a doubly linked list of slot indexes (group*8 + slot), oldest first
+	prev, next []uint32
+	head, tail uint32
+	// CLOCK keeps a referenced bit per slot index and the position of the clock hand
+	referenced []uint64
+	hand       uint32
+	// scratch holds the elements while rehashing in place, see rehashInPlace
+	scratch []boundedEntry[T]
+}
+
+type boundedEntry[T comparable] struct {
+	element    T
+	referenced bool
+}
+
+/*
+EmptyBoundedSet3 creates a new and empty BoundedSet3 that holds at most maxSize elements. onEvict is called with every element that
+is evicted to make room for a new one, but not for elements removed by Remove or Clear. onEvict may be nil.
+
+EmptyBoundedSet3 panics if maxSize is 0 or the policy is unknown.
+
+Example:
+
+	seen := EmptyBoundedSet3[string](10_000, EvictLRU, func(key string) {
+		log.Printf("forgetting %s", key)
+	})
+	seen.Add("request-42")
+*/
+func EmptyBoundedSet3[T comparable](maxSize uint32, policy EvictionPolicy, onEvict func(evicted T)) *BoundedSet3[T] {
+	if maxSize == 0 {
+		panic("set3: max size must be positive")
+	}
+	if policy < EvictFIFO || policy > EvictCLOCK {
+		panic(fmt.Sprintf("set3: unknown eviction policy %v", policy))
+	}
+	result := &BoundedSet3[T]{hashFunction: maphash.NewHasher[T](), policy: policy, onEvict: onEvict, maxSize: maxSize}
+	// thisSet never grows, so a full set must stay below the load limit, with headroom for the tombstones
+	// that evictions leave behind: they are dropped by rehashing in place after maxSize/8 evictions at most
+	minLimit := uint64(maxSize) + uint64(maxSize)/8 + 1
+	numGroups := calcReqNrOfGroups(maxSize)
+	for uint64(calcElementLimit(numGroups, set3maxAvgGroupLoad)) < minLimit {
+		numGroups++
+	}
+	result.allocate(numGroups)
+	return result
+}
+
+func (thisSet *BoundedSet3[T]) allocate(numGroups uint32) {
+	thisSet.set3table.allocate(numGroups)
+	thisSet.groupSlot = make([][set3groupSize]T, numGroups)
+	numSlots := numGroups * set3groupSize
+	switch thisSet.policy {
+	case EvictFIFO, EvictLRU:
+		thisSet.prev = make([]uint32, numSlots)
+		thisSet.next = make([]uint32, numSlots)
+	case EvictCLOCK:
+		thisSet.referenced = make([]uint64, (numSlots+63)/64)
+	}
+	thisSet.reset()
+}
+
+// reset removes all elements without allocating.
+func (thisSet *BoundedSet3[T]) reset() {
+	thisSet.set3table.reset()
+	clear(thisSet.groupSlot)
+	clear(thisSet.referenced)
+	thisSet.head, thisSet.tail, thisSet.hand = boundedNil, boundedNil, 0
+}
+
+func (thisSet *BoundedSet3[T]) find(element T) (uint64, int, bool) {
+	return thisSet.probe(thisSet.hashFunction.Hash(element), func(g uint64, s int) bool {
+		return element == thisSet.groupSlot[g][s]
+	})
+}
+
+func boundedIndex(g uint64, s int) uint32 {
+	return uint32(g)*set3groupSize + uint32(s) //nolint:gosec
+}
+
+func boundedSlot(idx uint32) (uint64, int) {
+	return uint64(idx / set3groupSize), int(idx % set3groupSize)
+}
+
+func (thisSet *BoundedSet3[T]) linkLast(idx uint32) {
+	thisSet.prev[idx], thisSet.next[idx] = thisSet.tail, boundedNil
+	if thisSet.tail == boundedNil {
+		thisSet.head = idx
+	} else {
+		thisSet.next[thisSet.tail] = idx
+	}
+	thisSet.tail = idx
+}
+
+func (thisSet *BoundedSet3[T]) unlink(idx uint32) {
+	p, n := thisSet.prev[idx], thisSet.next[idx]
+	if p == boundedNil {
+		thisSet.head = n
+	} else {
+		thisSet.next[p] = n
+	}
+	if n == boundedNil {
+		thisSet.tail = p
+	} else {
+		thisSet.prev[n] = p
+	}
+}
+
+func (thisSet *BoundedSet3[T]) setReferenced(idx uint32, referenced bool) {
+	if referenced {
+		thisSet.referenced[idx/64] |= 1 << (idx % 64)
+	} else {
+		thisSet.referenced[idx/64] &^= 1 << (idx % 64)
+	}
+}
+
+// touch records an access to the element at idx.
+func (thisSet *BoundedSet3[T]) touch(idx uint32) {
+	switch thisSet.policy {
+	case EvictLRU:
+		thisSet.unlink(idx)
+		thisSet.linkLast(idx)
+	case EvictCLOCK:
+		thisSet.setReferenced(idx, true)
+	}
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation. With [EvictFIFO] and [EvictLRU] the elements are ordered
+from the next victim to the most recently used element, otherwise the order is arbitrary.
+*/
+func (thisSet *BoundedSet3[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), set3formatValue)
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *BoundedSet3[T]) Size() uint32 {
+	return thisSet.size()
+}
+
+/*
+MaxSize returns the maximum number of elements in thisSet.
+*/
+func (thisSet *BoundedSet3[T]) MaxSize() uint32 {
+	return thisSet.maxSize
+}
+
+/*
+Policy returns the eviction policy of thisSet.
+*/
+func (thisSet *BoundedSet3[T]) Policy() EvictionPolicy {
+	return thisSet.policy
+}
+
+/*
+Contains returns true if thisSet contains the element. With [EvictLRU] and [EvictCLOCK] this counts as an access to the element.
+*/
+func (thisSet *BoundedSet3[T]) Contains(element T) bool {
+	g, s, found := thisSet.find(element)
+	if found {
+		thisSet.touch(boundedIndex(g, s))
+	}
+	return found
+}
+
+/*
+Add inserts the element into thisSet. If thisSet already contains the element, this counts as an access to the element.
+If thisSet is full, a victim chosen by the eviction policy is removed first and passed to the eviction callback.
+
+Example:
+
+	set := EmptyBoundedSet3[int](2, EvictFIFO, nil)
+	set.AddAllOf(1, 2, 3) // set will contain 2 and 3
+*/
+func (thisSet *BoundedSet3[T]) Add(element T) {
+	if g, s, found := thisSet.find(element); found {
+		thisSet.touch(boundedIndex(g, s))
+		return
+	}
+	if thisSet.Size() >= thisSet.maxSize {
+		thisSet.evict()
+	}
+	if thisSet.full() {
+		// thisSet holds less than elementLimit elements, so there are tombstones to drop
+		thisSet.rehashInPlace()
+	}
+	thisSet.insertNew(element)
+}
+
+func (thisSet *BoundedSet3[T]) insertNew(element T) uint32 {
+	g, s := thisSet.claim(thisSet.hashFunction.Hash(element))
+	thisSet.groupSlot[g][s] = element
+	idx := boundedIndex(g, s)
+	switch thisSet.policy {
+	case EvictFIFO, EvictLRU:
+		thisSet.linkLast(idx)
+	case EvictCLOCK:
+		thisSet.setReferenced(idx, false)
+	}
+	return idx
+}
+
+/*
+Inserts all parameter values into thisSet, see [BoundedSet3.Add].
+*/
+func (thisSet *BoundedSet3[T]) AddAllOf(args ...T) {
+	for _, e := range args {
+		thisSet.Add(e)
+	}
+}
+
+// evict removes the victim of the eviction policy and reports it to the callback.
+func (thisSet *BoundedSet3[T]) evict() {
+	var victim uint32
+	switch thisSet.policy {
+	case EvictFIFO, EvictLRU:
+		victim = thisSet.head
+	case EvictRandom:
+		// the table is well filled when thisSet is full, so few attempts are needed
+		numSlots := uint32(len(thisSet.groupCtrl)) * set3groupSize //nolint:gosec
+		for {
+			victim = rand.Uint32N(numSlots) //nolint:gosec
+			if g, s := boundedSlot(victim); isAnElementAt(thisSet.groupCtrl[g], s) {
+				break
+			}
+		}
+	case EvictCLOCK:
+		numSlots := uint32(len(thisSet.groupCtrl)) * set3groupSize //nolint:gosec
+		for {
+			victim = thisSet.hand
+			thisSet.hand = (thisSet.hand + 1) % numSlots
+			g, s := boundedSlot(victim)
+			if !isAnElementAt(thisSet.groupCtrl[g], s) {
+				continue
+			}
+			if thisSet.referenced[victim/64]&(1<<(victim%64)) == 0 {
+				break
+			}
+			thisSet.setReferenced(victim, false) // second chance
+		}
+	}
+	g, s := boundedSlot(victim)
+	element := thisSet.groupSlot[g][s]
+	thisSet.release(g, s)
+	if thisSet.onEvict != nil {
+		thisSet.onEvict(element)
+	}
+}
+
+func (thisSet *BoundedSet3[T]) release(g uint64, s int) {
+	thisSet.set3table.release(g, s)
+	var k T
+	thisSet.groupSlot[g][s] = k
+	if thisSet.policy == EvictFIFO || thisSet.policy == EvictLRU {
+		thisSet.unlink(boundedIndex(g, s))
+	}
+}
+
+/*
+Removes the element from thisSet, returns whether or not the element was in thisSet. The eviction callback is not called.
+*/
+func (thisSet *BoundedSet3[T]) Remove(element T) bool {
+	g, s, found := thisSet.find(element)
+	if found {
+		thisSet.release(g, s)
+	}
+	return found
+}
+
+/*
+Clear removes all elements from thisSet. The eviction callback is not called.
+*/
+func (thisSet *BoundedSet3[T]) Clear() {
+	thisSet.reset()
+}
+
+/*
+Clone creates a copy of thisSet with the same eviction policy, callback and order of eviction.
+*/
+func (thisSet *BoundedSet3[T]) Clone() *BoundedSet3[T] {
+	result := *thisSet
+	result.set3table = thisSet.clone()
+	result.groupSlot = slices.Clone(thisSet.groupSlot)
+	result.prev = slices.Clone(thisSet.prev)
+	result.next = slices.Clone(thisSet.next)
+	result.referenced = slices.Clone(thisSet.referenced)
+	result.scratch = nil
+	return &result
+}
+
+// rehashInPlace drops the tombstones. It keeps the order of eviction of FIFO and LRU and the referenced bits of CLOCK.
+// The elements are parked in the scratch buffer and reinserted into the same, reset table.
+// As the elements move to new slots, the CLOCK hand restarts at the first slot.
+func (thisSet *BoundedSet3[T]) rehashInPlace() {
+	if thisSet.scratch == nil {
+		thisSet.scratch = make([]boundedEntry[T], 0, thisSet.maxSize)
+	}
+	scratch := thisSet.scratch[:0]
+	for idx := range thisSet.indexes() {
+		g, s := boundedSlot(idx)
+		referenced := thisSet.policy == EvictCLOCK && thisSet.referenced[idx/64]&(1<<(idx%64)) != 0
+		scratch = append(scratch, boundedEntry[T]{element: thisSet.groupSlot[g][s], referenced: referenced})
+	}
+	thisSet.hashFunction = maphash.NewSeed(thisSet.hashFunction)
+	thisSet.reset()
+	for _, entry := range scratch {
+		idx := thisSet.insertNew(entry.element)
+		if entry.referenced {
+			thisSet.setReferenced(idx, true)
+		}
+	}
+	clear(scratch) // do not keep the elements alive
+	thisSet.scratch = scratch
+}
+
+// indexes iterates over the slot indexes of all elements, in the order of eviction for FIFO and LRU.
+func (thisSet *BoundedSet3[T]) indexes() iter.Seq[uint32] {
+	return func(yield func(uint32) bool) {
+		if thisSet.policy == EvictFIFO || thisSet.policy == EvictLRU {
+			for idx := thisSet.head; idx != boundedNil; idx = thisSet.next[idx] {
+				if !yield(idx) {
+					return
+				}
+			}
+			return
+		}
+		for g, s := range thisSet.slots() {
+			if !yield(boundedIndex(g, s)) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet. With [EvictFIFO] and [EvictLRU] the elements are yielded from the next victim to the most recently
+used element, otherwise the order is arbitrary. Iterating does not count as an access.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [BoundedSet3.ImmutableRange].
+*/
+func (thisSet *BoundedSet3[T]) MutableRange() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for idx := range thisSet.indexes() {
+			g, s := boundedSlot(idx)
+			if !yield(thisSet.groupSlot[g][s]) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet, in the same order as [BoundedSet3.MutableRange].
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *BoundedSet3[T]) ImmutableRange() iter.Seq[T] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray allocates an array of type T and adds all elements of thisSet to it, in the same order as [BoundedSet3.MutableRange].
+*/
+func (thisSet *BoundedSet3[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
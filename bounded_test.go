@@ -0,0 +1,188 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedSetFIFO(t *testing.T) {
+	var evicted []int
+	set := EmptyBoundedSet3(3, EvictFIFO, func(e int) { evicted = append(evicted, e) })
+	set.AddAllOf(1, 2, 3)
+	assert.True(t, set.Contains(1))
+	set.Add(4)
+	assert.Equal(t, []int{1}, evicted)
+	assert.Equal(t, []int{2, 3, 4}, set.ToArray())
+	assert.True(t, set.Remove(3))
+	set.AddAllOf(5, 6)
+	assert.Equal(t, []int{1, 2}, evicted, "Remove does not call the callback")
+	assert.Equal(t, "{4,5,6}", set.String())
+}
+
+func TestBoundedSetLRU(t *testing.T) {
+	var evicted []int
+	set := EmptyBoundedSet3(3, EvictLRU, func(e int) { evicted = append(evicted, e) })
+	set.AddAllOf(1, 2, 3)
+	assert.True(t, set.Contains(1))
+	set.Add(2)
+	set.Add(4)
+	assert.Equal(t, []int{3}, evicted)
+	assert.Equal(t, []int{1, 2, 4}, set.ToArray())
+	set.Add(5)
+	assert.Equal(t, []int{3, 1}, evicted)
+}
+
+func TestBoundedSetCLOCK(t *testing.T) {
+	var evicted []int
+	set := EmptyBoundedSet3(100, EvictCLOCK, func(e int) { evicted = append(evicted, e) })
+	for i := range 100 {
+		set.Add(i)
+	}
+	for i := range 50 {
+		assert.True(t, set.Contains(i))
+	}
+	for i := 100; i < 150; i++ {
+		set.Add(i)
+	}
+	assert.Len(t, evicted, 50)
+	referencedEvicted := 0
+	for _, e := range evicted {
+		if e < 50 {
+			referencedEvicted++
+		}
+	}
+	// rehashing to drop tombstones moves the clock hand, so some referenced elements may be evicted early
+	assert.Less(t, referencedEvicted, 20, "referenced elements get a second chance")
+	assert.Equal(t, uint32(100), set.Size())
+}
+
+func TestBoundedSetRandom(t *testing.T) {
+	evicted := 0
+	set := EmptyBoundedSet3(10, EvictRandom, func(int) { evicted++ })
+	for i := range 1000 {
+		set.Add(i)
+		assert.True(t, set.Contains(i))
+	}
+	assert.Equal(t, 990, evicted)
+	assert.Equal(t, uint32(10), set.Size())
+	assert.Len(t, set.ToArray(), 10)
+}
+
+func TestBoundedSetMatchesModel(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictFIFO, EvictLRU, EvictRandom, EvictCLOCK} {
+		t.Run(policy.String(), func(t *testing.T) {
+			rng := rand.New(rand.NewPCG(51, 52)) //nolint:gosec
+			// oldest first, the order is only checked for FIFO and LRU
+			model := []int{}
+			set := EmptyBoundedSet3(200, policy, func(e int) {
+				idx := slices.Index(model, e)
+				require.GreaterOrEqual(t, idx, 0)
+				if policy == EvictFIFO || policy == EvictLRU {
+					require.Equal(t, 0, idx)
+				}
+				model = slices.Delete(model, idx, idx+1)
+			})
+			for i := range 50_000 {
+				e := rng.IntN(1000)
+				idx := slices.Index(model, e)
+				switch rng.IntN(3) {
+				case 0:
+					require.Equal(t, idx >= 0, set.Remove(e))
+					if idx >= 0 {
+						model = slices.Delete(model, idx, idx+1)
+					}
+				default:
+					if idx >= 0 {
+						if policy == EvictLRU {
+							model = append(slices.Delete(model, idx, idx+1), e)
+						}
+						if rng.IntN(2) == 0 {
+							require.True(t, set.Contains(e))
+							continue
+						}
+					} else {
+						model = append(model, e)
+					}
+					set.Add(e)
+				}
+				require.LessOrEqual(t, set.Size(), uint32(200))
+				if i%500 == 0 {
+					if policy == EvictFIFO || policy == EvictLRU {
+						require.Equal(t, model, set.ToArray())
+					} else {
+						require.ElementsMatch(t, model, set.ToArray())
+					}
+				}
+			}
+			assert.Equal(t, uint32(len(model)), set.Size()) //nolint:gosec
+		})
+	}
+}
+
+func TestBoundedSetCloneAndClear(t *testing.T) {
+	set := EmptyBoundedSet3[string](2, EvictFIFO, nil)
+	assert.Equal(t, uint32(2), set.MaxSize())
+	assert.Equal(t, EvictFIFO, set.Policy())
+	set.AddAllOf("a", "b", "c")
+	clone := set.Clone()
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, []string{"b", "c"}, clone.ToArray())
+	for e := range clone.ImmutableRange() {
+		clone.Remove(e)
+	}
+	assert.Equal(t, "{}", clone.String())
+	var nilSet *BoundedSet3[int]
+	assert.Equal(t, "{nil}", nilSet.String())
+	assert.Equal(t, "EvictionPolicy(7)", EvictionPolicy(7).String())
+	assert.Panics(t, func() { EmptyBoundedSet3[int](0, EvictFIFO, nil) })
+	assert.Panics(t, func() { EmptyBoundedSet3[int](1, EvictionPolicy(7), nil) })
+}
+
+func TestBoundedSetEvictionDoesNotAllocate(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictFIFO, EvictLRU, EvictRandom, EvictCLOCK} {
+		set := EmptyBoundedSet3[int](1000, policy, nil)
+		next := 0
+		for range 10_000 { // warm up, including the first purge of tombstones
+			set.Add(next)
+			next++
+		}
+		allocs := testing.AllocsPerRun(10_000, func() {
+			set.Add(next)
+			next++
+		})
+		assert.Zero(t, allocs, "policy %v", policy)
+	}
+}
+
+func TestBoundedSetSmallMaxSizes(t *testing.T) {
+	for maxSize := uint32(1); maxSize <= 40; maxSize++ {
+		set := EmptyBoundedSet3[int](maxSize, EvictLRU, nil)
+		for i := range 500 {
+			set.Add(i)
+			if i%3 == 0 {
+				set.Remove(i - 1)
+			}
+		}
+		assert.LessOrEqual(t, set.Size(), maxSize)
+		assert.True(t, set.Contains(499))
+	}
+}
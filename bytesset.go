@@ -0,0 +1,307 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"hash/maphash"
+	"iter"
+	"math"
+	"slices"
+)
+
+/*
+BytesSet is a set of byte strings that stores the bytes of all elements in one contiguous arena. The group slots only hold the offset
+and length of an element within the arena, so they contain no pointers and a BytesSet with millions of elements consists of a few
+large allocations that the garbage collector does not need to scan. Byte slices and strings with the same contents are the same element.
+
+Removing an element leaves its bytes in the arena as garbage. The garbage is reclaimed when the set grows, when an element is added
+while more than half of the arena is garbage, or by [BytesSet.Compact]. So the arena stays bounded under add/remove churn without
+calling Compact. The live elements are limited to 4 GiB.
+*/
+type BytesSet struct {
+	set3table
+	garbage   uint32
+	arena     []byte
+	groupSlot [][set3groupSize]bytesRef
+}
+
+// bytesRef locates the bytes of an element in the arena of a BytesSet.
+type bytesRef struct {
+	offset uint32
+	length uint32
+}
+
+/*
+EmptyBytesSet creates a new and empty BytesSet with a reasonable default initial capacity.
+
+Example:
+
+	set := EmptyBytesSet()
+	set.AddString("key")
+*/
+func EmptyBytesSet() *BytesSet {
+	return EmptyBytesSetWithCapacity(21, 0)
+}
+
+/*
+EmptyBytesSetWithCapacity creates a new and empty BytesSet that can hold initialCapacity elements with a total of arenaCapacity bytes without being reorganized.
+
+Example:
+
+	set := EmptyBytesSetWithCapacity(1_000_000, 32_000_000)
+*/
+func EmptyBytesSetWithCapacity(initialCapacity uint32, arenaCapacity uint32) *BytesSet {
+	result := &BytesSet{arena: make([]byte, 0, arenaCapacity)}
+	result.allocate(calcReqNrOfGroups(initialCapacity))
+	return result
+}
+
+func (thisSet *BytesSet) allocate(numGroups uint32) {
+	thisSet.set3table.allocate(numGroups)
+	thisSet.groupSlot = make([][set3groupSize]bytesRef, numGroups)
+}
+
+func (thisSet *BytesSet) bytesAt(ref bytesRef) []byte {
+	return thisSet.arena[ref.offset : ref.offset+ref.length : ref.offset+ref.length]
+}
+
+func (thisSet *BytesSet) findBytes(b []byte) (uint64, int, bool) {
+	return thisSet.probe(maphash.Bytes(setFuncSeed, b), func(g uint64, s int) bool {
+		return string(thisSet.bytesAt(thisSet.groupSlot[g][s])) == string(b)
+	})
+}
+
+func (thisSet *BytesSet) findString(str string) (uint64, int, bool) {
+	// maphash.String yields the same hash as maphash.Bytes for the same contents
+	return thisSet.probe(maphash.String(setFuncSeed, str), func(g uint64, s int) bool {
+		return string(thisSet.bytesAt(thisSet.groupSlot[g][s])) == str
+	})
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation, each element quoted. The order of the elements in the result is arbitrary.
+*/
+func (thisSet *BytesSet) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), func(e []byte) string {
+		return fmt.Sprintf("%q", e)
+	})
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *BytesSet) Size() uint32 {
+	return thisSet.size()
+}
+
+/*
+ArenaSize returns the number of bytes in the arena of thisSet, including the garbage left behind by removed elements.
+*/
+func (thisSet *BytesSet) ArenaSize() uint64 {
+	return uint64(len(thisSet.arena))
+}
+
+/*
+ContainsBytes returns true if thisSet contains an element with the same contents as b. It does not allocate.
+*/
+func (thisSet *BytesSet) ContainsBytes(b []byte) bool {
+	_, _, found := thisSet.findBytes(b)
+	return found
+}
+
+/*
+ContainsString returns true if thisSet contains an element with the same contents as str. It does not allocate.
+
+Example:
+
+	set := EmptyBytesSet()
+	set.AddBytes([]byte("key"))
+	b := set.ContainsString("key") // b will be true
+*/
+func (thisSet *BytesSet) ContainsString(str string) bool {
+	_, _, found := thisSet.findString(str)
+	return found
+}
+
+/*
+AddBytes copies the contents of b into thisSet, if thisSet does not already contain them. b may be modified afterwards.
+Panics if the live elements would exceed 4 GiB.
+*/
+func (thisSet *BytesSet) AddBytes(b []byte) {
+	if _, _, found := thisSet.findBytes(b); found {
+		return
+	}
+	thisSet.insertNew(b, maphash.Bytes(setFuncSeed, b))
+}
+
+/*
+AddString adds the contents of str to thisSet, see [BytesSet.AddBytes].
+*/
+func (thisSet *BytesSet) AddString(str string) {
+	if _, _, found := thisSet.findString(str); found {
+		return
+	}
+	offset := thisSet.prepareInsert(len(str))
+	thisSet.arena = append(thisSet.arena, str...)
+	thisSet.insertRef(maphash.String(setFuncSeed, str), offset, uint32(len(str))) //nolint:gosec
+}
+
+func (thisSet *BytesSet) insertNew(b []byte, hash uint64) {
+	offset := thisSet.prepareInsert(len(b))
+	thisSet.arena = append(thisSet.arena, b...)
+	thisSet.insertRef(hash, offset, uint32(len(b))) //nolint:gosec
+}
+
+// prepareInsert makes room for one more element of the given length and returns its offset in the arena.
+// It drops the garbage once it makes up more than half of the arena, so every compaction is paid for by the removals before it.
+func (thisSet *BytesSet) prepareInsert(length int) uint32 {
+	exceeds := uint64(len(thisSet.arena))+uint64(length) > math.MaxUint32
+	if thisSet.garbage > uint32(len(thisSet.arena))/2 || (exceeds && thisSet.garbage > 0) { //nolint:gosec
+		thisSet.rehashToNumGroups(uint32(len(thisSet.groupCtrl))) //nolint:gosec
+		exceeds = uint64(len(thisSet.arena))+uint64(length) > math.MaxUint32
+	}
+	if exceeds {
+		panic("set3: BytesSet arena exceeds 4 GiB")
+	}
+	if thisSet.full() {
+		thisSet.rehashToNumGroups(thisSet.nextGroupCount())
+	}
+	return uint32(len(thisSet.arena)) //nolint:gosec
+}
+
+func (thisSet *BytesSet) insertRef(hash uint64, offset, length uint32) {
+	g, s := thisSet.claim(hash)
+	thisSet.groupSlot[g][s] = bytesRef{offset: offset, length: length}
+}
+
+/*
+RemoveBytes removes the element with the same contents as b from thisSet and returns whether or not there was such an element.
+The bytes of the element stay in the arena until the next compaction.
+*/
+func (thisSet *BytesSet) RemoveBytes(b []byte) bool {
+	g, s, found := thisSet.findBytes(b)
+	if found {
+		thisSet.release(g, s)
+	}
+	return found
+}
+
+/*
+RemoveString removes the element with the same contents as str from thisSet, see [BytesSet.RemoveBytes].
+*/
+func (thisSet *BytesSet) RemoveString(str string) bool {
+	g, s, found := thisSet.findString(str)
+	if found {
+		thisSet.release(g, s)
+	}
+	return found
+}
+
+func (thisSet *BytesSet) release(g uint64, s int) {
+	thisSet.set3table.release(g, s)
+	thisSet.garbage += thisSet.groupSlot[g][s].length
+	thisSet.groupSlot[g][s] = bytesRef{}
+}
+
+/*
+Clear removes all elements from thisSet. The memory of the arena is kept for reuse.
+*/
+func (thisSet *BytesSet) Clear() {
+	clear(thisSet.groupSlot)
+	thisSet.reset()
+	thisSet.garbage = 0
+	thisSet.arena = thisSet.arena[:0]
+}
+
+/*
+Clone creates a copy of thisSet. The arena of the copy holds no garbage.
+*/
+func (thisSet *BytesSet) Clone() *BytesSet {
+	result := EmptyBytesSetWithCapacity(thisSet.Size(), uint32(len(thisSet.arena))-thisSet.garbage) //nolint:gosec
+	for e := range thisSet.MutableRange() {
+		result.insertNew(e, maphash.Bytes(setFuncSeed, e))
+	}
+	return result
+}
+
+/*
+Compact rebuilds thisSet, dropping the bytes of removed elements from the arena and the tombstones from the groups.
+Adding elements reclaims the garbage automatically, so call it only to release memory after removing many elements from a set that will not grow anymore.
+
+Example:
+
+	for _, key := range expiredKeys {
+		set.RemoveString(key)
+	}
+	set.Compact()
+*/
+func (thisSet *BytesSet) Compact() {
+	thisSet.rehashToNumGroups(calcReqNrOfGroups(thisSet.Size()))
+}
+
+// rehashToNumGroups rebuilds the groups and copies the live elements into a new arena, which drops the garbage.
+func (thisSet *BytesSet) rehashToNumGroups(newNumGroups uint32) {
+	oldArena, oldTable, oldGroupSlot := thisSet.arena, thisSet.set3table, thisSet.groupSlot
+	thisSet.arena = make([]byte, 0, uint64(len(oldArena))-uint64(thisSet.garbage)+uint64(cap(oldArena)-len(oldArena)))
+	thisSet.garbage = 0
+	thisSet.allocate(newNumGroups)
+	for g, s := range oldTable.slots() {
+		ref := oldGroupSlot[g][s]
+		b := oldArena[ref.offset : ref.offset+ref.length]
+		offset := uint32(len(thisSet.arena)) //nolint:gosec
+		thisSet.arena = append(thisSet.arena, b...)
+		thisSet.insertRef(maphash.Bytes(setFuncSeed, b), offset, ref.length)
+	}
+}
+
+/*
+Iterates over all elements in thisSet. The yielded slices share the memory of the arena: they must not be modified and
+they are only valid until thisSet is changed.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [BytesSet.ImmutableRange].
+*/
+func (thisSet *BytesSet) MutableRange() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for g, s := range thisSet.slots() {
+			if !yield(thisSet.bytesAt(thisSet.groupSlot[g][s])) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet.
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *BytesSet) ImmutableRange() iter.Seq[[]byte] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray returns copies of all elements of thisSet. The order of the elements in the resulting array is arbitrary.
+*/
+func (thisSet *BytesSet) ToArray() [][]byte {
+	result := make([][]byte, 0, thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result = append(result, slices.Clone(e))
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBytesSetMatchesMap(t *testing.T) {
+	rng := rand.New(rand.NewPCG(31, 32)) //nolint:gosec
+	set := EmptyBytesSet()
+	model := map[string]bool{}
+	for i := range 50_000 {
+		key := fmt.Sprintf("key-%d", rng.IntN(3000))
+		switch rng.IntN(4) {
+		case 0:
+			set.AddString(key)
+			model[key] = true
+		case 1:
+			set.AddBytes([]byte(key))
+			model[key] = true
+		case 2:
+			assert.Equal(t, model[key], set.RemoveString(key))
+			delete(model, key)
+		default:
+			assert.Equal(t, model[key], set.RemoveBytes([]byte(key)))
+			delete(model, key)
+		}
+		if i%1000 == 0 {
+			require.Equal(t, uint32(len(model)), set.Size()) //nolint:gosec
+			for k := range model {
+				require.True(t, set.ContainsString(k))
+				require.True(t, set.ContainsBytes([]byte(k)))
+			}
+		}
+	}
+	actual := []string{}
+	for e := range set.MutableRange() {
+		actual = append(actual, string(e))
+	}
+	expected := []string{}
+	for k := range model {
+		expected = append(expected, k)
+	}
+	assert.ElementsMatch(t, expected, actual)
+}
+
+func TestBytesSetCompact(t *testing.T) {
+	set := EmptyBytesSetWithCapacity(1000, 0)
+	for i := range 1000 {
+		set.AddString(fmt.Sprintf("%04d", i))
+	}
+	assert.Equal(t, uint64(4000), set.ArenaSize())
+	for i := range 900 {
+		assert.True(t, set.RemoveString(fmt.Sprintf("%04d", i)))
+	}
+	assert.Equal(t, uint64(4000), set.ArenaSize(), "removal leaves garbage")
+	clone := set.Clone()
+	assert.Equal(t, uint64(400), clone.ArenaSize())
+	set.Compact()
+	assert.Equal(t, uint64(400), set.ArenaSize())
+	assert.Equal(t, uint32(100), set.Size())
+	for i := range 1000 {
+		assert.Equal(t, i >= 900, set.ContainsString(fmt.Sprintf("%04d", i)))
+		assert.Equal(t, i >= 900, clone.ContainsString(fmt.Sprintf("%04d", i)))
+	}
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, uint64(0), set.ArenaSize())
+	assert.False(t, set.ContainsString("0950"))
+}
+
+func TestBytesSetChurnKeepsArenaBounded(t *testing.T) {
+	set := EmptyBytesSet()
+	const window = 100
+	key := func(i int) string { return fmt.Sprintf("churn-key-%08d", i) }
+	maxArena := uint64(0)
+	for i := range 200_000 {
+		set.AddString(key(i))
+		if i >= window {
+			require.True(t, set.RemoveBytes([]byte(key(i-window))))
+		}
+		maxArena = max(maxArena, set.ArenaSize())
+	}
+	live := uint64(window * len(key(0)))
+	// garbage is dropped once it exceeds half of the arena
+	assert.LessOrEqual(t, maxArena, 2*live+uint64(2*len(key(0))))
+	assert.Equal(t, uint32(window), set.Size())
+	for i := 200_000 - window; i < 200_000; i++ {
+		assert.True(t, set.ContainsString(key(i)))
+	}
+}
+
+func TestBytesSetEmptyAndCopiedElements(t *testing.T) {
+	set := EmptyBytesSet()
+	assert.False(t, set.ContainsString(""))
+	set.AddBytes(nil)
+	assert.True(t, set.ContainsString(""))
+	assert.True(t, set.ContainsBytes([]byte{}))
+	b := []byte("abc")
+	set.AddBytes(b)
+	b[0] = 'x'
+	assert.True(t, set.ContainsString("abc"), "AddBytes copies its argument")
+	assert.False(t, set.ContainsString("xbc"))
+	assert.ElementsMatch(t, [][]byte{{}, []byte("abc")}, set.ToArray())
+	for e := range set.ImmutableRange() {
+		set.RemoveBytes(e)
+	}
+	assert.Equal(t, "{}", set.String())
+	var nilSet *BytesSet
+	assert.Equal(t, "{nil}", nilSet.String())
+}
+
+func TestBytesSetLookupDoesNotAllocate(t *testing.T) {
+	set := EmptyBytesSet()
+	for i := range 1000 {
+		set.AddString(fmt.Sprintf("key-%d", i))
+	}
+	key, keyBytes := "key-500", []byte("key-501")
+	allocs := testing.AllocsPerRun(100, func() {
+		if !set.ContainsString(key) || !set.ContainsBytes(keyBytes) {
+			t.Fail()
+		}
+	})
+	assert.Zero(t, allocs)
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+/*
+Codec converts elements of type T to and from a binary representation. Codecs are used to serialize sets and their derived data structures.
+See [IntegerCodec] and [StringCodec] for ready-to-use codecs.
+
+Append appends the binary representation of element to dst and returns the extended buffer.
+Decode decodes one element from the beginning of src and returns it along with the number of bytes read.
+Every element must take at least one byte, so Decode must not return n == 0 without an error.
+*/
+type Codec[T any] interface {
+	Append(dst []byte, element T) []byte
+	Decode(src []byte) (element T, n int, err error)
+}
+
+// Integer is a constraint that permits any integer type.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+type integerCodec[T Integer] struct{}
+
+/*
+IntegerCodec returns a [Codec] for integer types. Values are encoded as varints, signed values zig-zag encoded, so small values take few bytes.
+
+Example:
+
+	codec := IntegerCodec[uint64]()
+	buf := codec.Append(nil, 42)
+*/
+func IntegerCodec[T Integer]() Codec[T] {
+	return integerCodec[T]{}
+}
+
+func isSigned[T Integer]() bool {
+	return ^T(0) < 0
+}
+
+func (integerCodec[T]) Append(dst []byte, element T) []byte {
+	if isSigned[T]() {
+		return binary.AppendVarint(dst, int64(element))
+	}
+	return binary.AppendUvarint(dst, uint64(element))
+}
+
+func (integerCodec[T]) Decode(src []byte) (T, int, error) {
+	if isSigned[T]() {
+		v, n := binary.Varint(src)
+		if n <= 0 || int64(T(v)) != v {
+			return 0, 0, fmt.Errorf("%w: invalid varint", ErrInvalidFormat)
+		}
+		return T(v), n, nil
+	}
+	v, n := binary.Uvarint(src)
+	if n <= 0 || uint64(T(v)) != v {
+		return 0, 0, fmt.Errorf("%w: invalid uvarint", ErrInvalidFormat)
+	}
+	return T(v), n, nil
+}
+
+type stringCodec[T ~string] struct{}
+
+/*
+StringCodec returns a [Codec] for string types. Strings are encoded as their length (varint) followed by their bytes.
+
+Example:
+
+	codec := StringCodec[string]()
+	buf := codec.Append(nil, "hello")
+*/
+func StringCodec[T ~string]() Codec[T] {
+	return stringCodec[T]{}
+}
+
+func (stringCodec[T]) Append(dst []byte, element T) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(element)))
+	return append(dst, element...)
+}
+
+func (stringCodec[T]) Decode(src []byte) (T, int, error) {
+	l, n := binary.Uvarint(src)
+	if n <= 0 || l > uint64(len(src)-n) {
+		return "", 0, fmt.Errorf("%w: invalid string", ErrInvalidFormat)
+	}
+	end := n + int(l) //nolint:gosec
+	return T(src[n:end]), end, nil
+}
+
+/*
+AppendEncoded appends a binary representation of thisSet to dst and returns the extended buffer. The elements are encoded by codec.
+Use [FromEncoded] to restore the set.
+
+Example:
+
+	set := From[uint64](1, 2, 3)
+	buf := set.AppendEncoded(nil, IntegerCodec[uint64]())
+*/
+func (thisSet *Set3[T]) AppendEncoded(dst []byte, codec Codec[T]) []byte {
+	dst = binary.AppendUvarint(dst, uint64(thisSet.Size()))
+	for e := range thisSet.MutableRange() {
+		dst = codec.Append(dst, e)
+	}
+	return dst
+}
+
+/*
+FromEncoded is a constructor to create a Set3 from the binary representation written by [Set3.AppendEncoded].
+It returns the set along with the number of bytes read from data.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid encoded set, or if codec decodes an element from zero bytes.
+
+Example:
+
+	set1 := From[uint64](1, 2, 3)
+	buf := set1.AppendEncoded(nil, IntegerCodec[uint64]())
+	set2, _, err := FromEncoded(buf, IntegerCodec[uint64]()) // set1 and set2 are equal
+*/
+func FromEncoded[T comparable](data []byte, codec Codec[T]) (*Set3[T], int, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > math.MaxUint32 {
+		return nil, 0, fmt.Errorf("%w: invalid set size", ErrInvalidFormat)
+	}
+	// every element takes at least one byte, so a size beyond the remaining bytes cannot be valid
+	if size > uint64(len(data)-n) {
+		return nil, 0, fmt.Errorf("%w: set size %d exceeds the %d remaining bytes", ErrInvalidFormat, size, len(data)-n)
+	}
+	result := EmptyWithCapacity[T](uint32(size))
+	pos := n
+	for range size {
+		e, l, err := codec.Decode(data[pos:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if l <= 0 || l > len(data)-pos {
+			return nil, 0, fmt.Errorf("%w: codec read %d bytes for the element at offset %d", ErrInvalidFormat, l, pos)
+		}
+		result.Add(e)
+		pos += l
+	}
+	if uint64(result.Size()) != size {
+		return nil, 0, fmt.Errorf("%w: duplicate elements", ErrInvalidFormat)
+	}
+	return result, pos, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCodecRoundTrip[T comparable](t *testing.T, codec Codec[T], values ...T) {
+	var buf []byte
+	for _, v := range values {
+		buf = codec.Append(buf, v)
+	}
+	pos := 0
+	for _, v := range values {
+		decoded, n, err := codec.Decode(buf[pos:])
+		require.NoError(t, err)
+		assert.Equal(t, v, decoded)
+		pos += n
+	}
+	assert.Equal(t, len(buf), pos)
+}
+
+func TestIntegerCodec(t *testing.T) {
+	testCodecRoundTrip(t, IntegerCodec[uint64](), 0, 1, 127, 128, math.MaxUint64)
+	testCodecRoundTrip(t, IntegerCodec[int64](), 0, -1, 1, math.MinInt64, math.MaxInt64)
+	testCodecRoundTrip(t, IntegerCodec[int8](), 0, -128, 127)
+	testCodecRoundTrip(t, IntegerCodec[uint16](), 0, 65535)
+	assert.Equal(t, 1, len(IntegerCodec[int32]().Append(nil, -1)), "small negative values shall be encoded in one byte")
+
+	_, _, err := IntegerCodec[uint8]().Decode(IntegerCodec[uint16]().Append(nil, 256))
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "overflow shall be detected")
+	_, _, err = IntegerCodec[int8]().Decode(IntegerCodec[int16]().Append(nil, -129))
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "overflow shall be detected")
+	_, _, err = IntegerCodec[uint64]().Decode([]byte{0x80})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "truncated varint shall be detected")
+	_, _, err = IntegerCodec[int64]().Decode(nil)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestStringCodec(t *testing.T) {
+	testCodecRoundTrip(t, StringCodec[string](), "", "a", "hello world", string(make([]byte, 300)))
+	type name string
+	testCodecRoundTrip(t, StringCodec[name](), "x", "y")
+	_, _, err := StringCodec[string]().Decode([]byte{5, 'a', 'b'})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "truncated string shall be detected")
+	_, _, err = StringCodec[string]().Decode(nil)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestSet3Encoded(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10_000} {
+		set := FromArray(generateInt64Data(n))
+		buf := set.AppendEncoded([]byte("prefix"), IntegerCodec[int64]())
+		decoded, l, err := FromEncoded(buf[6:], IntegerCodec[int64]())
+		require.NoError(t, err)
+		assert.Equal(t, len(buf)-6, l)
+		assert.True(t, set.Equals(decoded))
+	}
+	strs := FromArray(genStringData(8, 1000))
+	decoded, _, err := FromEncoded(strs.AppendEncoded(nil, StringCodec[string]()), StringCodec[string]())
+	require.NoError(t, err)
+	assert.True(t, strs.Equals(decoded))
+}
+
+func TestSet3EncodedInvalid(t *testing.T) {
+	codec := IntegerCodec[uint32]()
+	buf := From[uint32](1, 2, 3).AppendEncoded(nil, codec)
+	_, _, err := FromEncoded(buf[:len(buf)-1], codec)
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "truncated data shall be detected")
+	_, _, err = FromEncoded(nil, codec)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, _, err = FromEncoded([]byte{2, 1, 1}, codec)
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "duplicates shall be detected")
+	_, _, err = FromEncoded([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}, codec)
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "sizes beyond uint32 shall be detected")
+	_, _, err = FromEncoded([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 0x01}, codec)
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "sizes beyond the remaining bytes shall be detected")
+}
+
+// zeroLengthCodec decodes every element from zero bytes, like a buggy codec for a fixed-size type at the end of the data.
+type zeroLengthCodec struct{}
+
+func (zeroLengthCodec) Append(dst []byte, _ uint32) []byte {
+	return dst
+}
+
+func (zeroLengthCodec) Decode([]byte) (uint32, int, error) {
+	return 0, 0, nil
+}
+
+// overreadingCodec claims to have read more bytes than it was given.
+type overreadingCodec struct{}
+
+func (overreadingCodec) Append(dst []byte, _ uint32) []byte {
+	return dst
+}
+
+func (overreadingCodec) Decode(src []byte) (uint32, int, error) {
+	return uint32(len(src)), len(src) + 1, nil //nolint:gosec
+}
+
+func TestSet3EncodedHostileCodec(t *testing.T) {
+	data := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 1, 2, 3} // a size of MaxUint32 followed by 3 bytes
+	_, _, err := FromEncoded(data, zeroLengthCodec{})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "a hostile size shall be rejected before decoding")
+	_, _, err = FromEncoded([]byte{3, 1, 2, 3}, zeroLengthCodec{})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "a codec that reads no bytes shall be rejected")
+	_, _, err = FromEncoded([]byte{1, 1, 2}, overreadingCodec{})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "a codec that reads beyond the data shall be rejected")
+}
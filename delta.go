@@ -0,0 +1,206 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+/*
+Delta describes the changes between two versions of a set: the elements that have been added and the elements that have been removed.
+Use [Diff] to compute a Delta and [Set3.Apply] to apply it to a replica of the old version.
+*/
+type Delta[T comparable] struct {
+	Added   []T
+	Removed []T
+}
+
+/*
+Diff computes the changes that turn oldSet into newSet. nil is interpreted as empty set.
+
+Example:
+
+	oldSet := From(1, 2, 3)
+	newSet := From(2, 3, 4)
+	delta := Diff(oldSet, newSet) // delta.Added will contain 4, delta.Removed will contain 1
+*/
+func Diff[T comparable](oldSet, newSet *Set3[T]) Delta[T] {
+	var result Delta[T]
+	if newSet != nil {
+		for e := range newSet.MutableRange() {
+			if oldSet == nil || !oldSet.Contains(e) {
+				result.Added = append(result.Added, e)
+			}
+		}
+	}
+	if oldSet != nil {
+		for e := range oldSet.MutableRange() {
+			if newSet == nil || !newSet.Contains(e) {
+				result.Removed = append(result.Removed, e)
+			}
+		}
+	}
+	return result
+}
+
+/*
+Size returns the total number of changes in delta.
+*/
+func (delta Delta[T]) Size() int {
+	return len(delta.Added) + len(delta.Removed)
+}
+
+/*
+Apply applies the changes in delta to thisSet: it removes all elements in delta.Removed and adds all elements in delta.Added.
+
+Example:
+
+	replica := From(1, 2, 3)
+	replica.Apply(Diff(From(1, 2, 3), From(2, 3, 4))) // replica will now contain 2, 3, 4
+*/
+func (thisSet *Set3[T]) Apply(delta Delta[T]) {
+	thisSet.RemoveAllFromArray(delta.Removed)
+	thisSet.AddAllFromArray(delta.Added)
+}
+
+/*
+AppendEncoded appends a binary representation of delta to dst and returns the extended buffer. The elements are encoded by codec.
+For integer types, [AppendIntegerDelta] yields a much more compact representation.
+
+Example:
+
+	buf := delta.AppendEncoded(nil, StringCodec[string]())
+*/
+func (delta Delta[T]) AppendEncoded(dst []byte, codec Codec[T]) []byte {
+	for _, part := range [][]T{delta.Added, delta.Removed} {
+		dst = binary.AppendUvarint(dst, uint64(len(part)))
+		for _, e := range part {
+			dst = codec.Append(dst, e)
+		}
+	}
+	return dst
+}
+
+/*
+DeltaFromEncoded restores a Delta from the binary representation written by [Delta.AppendEncoded].
+It returns the delta along with the number of bytes read from data.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid encoded delta.
+
+Example:
+
+	delta, _, err := DeltaFromEncoded(buf, StringCodec[string]())
+*/
+func DeltaFromEncoded[T comparable](data []byte, codec Codec[T]) (Delta[T], int, error) {
+	var result Delta[T]
+	pos := 0
+	for _, part := range []*[]T{&result.Added, &result.Removed} {
+		count, n := binary.Uvarint(data[pos:])
+		if n <= 0 || count > uint64(len(data)) {
+			return Delta[T]{}, 0, fmt.Errorf("%w: invalid delta size", ErrInvalidFormat)
+		}
+		pos += n
+		*part = make([]T, 0, count)
+		for range count {
+			e, l, err := codec.Decode(data[pos:])
+			if err != nil {
+				return Delta[T]{}, 0, err
+			}
+			*part = append(*part, e)
+			pos += l
+		}
+	}
+	return result, pos, nil
+}
+
+/*
+AppendIntegerDelta appends a compact binary representation of delta to dst and returns the extended buffer.
+The added and removed elements are sorted and encoded as varints of the gaps between them, so clustered ids take only one or two bytes each.
+delta is not modified, the elements are sorted in a copy.
+
+Example:
+
+	delta := Diff(oldIDs, newIDs)
+	buf := AppendIntegerDelta(nil, delta)
+*/
+func AppendIntegerDelta[T Integer](dst []byte, delta Delta[T]) []byte {
+	codec := IntegerCodec[T]()
+	sorted := make([]T, 0, max(len(delta.Added), len(delta.Removed)))
+	for _, part := range [][]T{delta.Added, delta.Removed} {
+		part = append(sorted[:0], part...)
+		slices.Sort(part)
+		dst = binary.AppendUvarint(dst, uint64(len(part)))
+		for i, e := range part {
+			if i == 0 {
+				dst = codec.Append(dst, e)
+				continue
+			}
+			// gaps between sorted values are non-negative and fit into an uint64,
+			// even if the difference overflows T (modular arithmetic)
+			dst = binary.AppendUvarint(dst, uint64(e)-uint64(part[i-1]))
+		}
+	}
+	return dst
+}
+
+/*
+IntegerDeltaFromEncoded restores a Delta from the binary representation written by [AppendIntegerDelta].
+It returns the delta along with the number of bytes read from data. The slices in the resulting delta are sorted.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid encoded delta.
+
+Example:
+
+	delta, _, err := IntegerDeltaFromEncoded[uint32](buf)
+	replica.Apply(delta)
+*/
+func IntegerDeltaFromEncoded[T Integer](data []byte) (Delta[T], int, error) {
+	codec := IntegerCodec[T]()
+	var result Delta[T]
+	pos := 0
+	for _, part := range []*[]T{&result.Added, &result.Removed} {
+		count, n := binary.Uvarint(data[pos:])
+		if n <= 0 || count > uint64(len(data)) {
+			return Delta[T]{}, 0, fmt.Errorf("%w: invalid delta size", ErrInvalidFormat)
+		}
+		pos += n
+		*part = make([]T, 0, count)
+		var prev T
+		for i := range count {
+			var e T
+			if i == 0 {
+				first, l, err := codec.Decode(data[pos:])
+				if err != nil {
+					return Delta[T]{}, 0, err
+				}
+				e, n = first, l
+			} else {
+				var gap uint64
+				gap, n = binary.Uvarint(data[pos:])
+				e = T(uint64(prev) + gap)
+				// gaps must be positive and must not exceed the range of T
+				if n <= 0 || e <= prev || uint64(e)-uint64(prev) != gap {
+					return Delta[T]{}, 0, fmt.Errorf("%w: invalid gap", ErrInvalidFormat)
+				}
+			}
+			*part = append(*part, e)
+			prev = e
+			pos += n
+		}
+	}
+	return result, pos, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffAndApply(t *testing.T) {
+	oldSet := From(1, 2, 3, 4, 5)
+	newSet := From(4, 5, 6, 7)
+	delta := Diff(oldSet, newSet)
+	assert.ElementsMatch(t, []int{6, 7}, delta.Added)
+	assert.ElementsMatch(t, []int{1, 2, 3}, delta.Removed)
+	assert.Equal(t, 5, delta.Size())
+
+	replica := oldSet.Clone()
+	replica.Apply(delta)
+	assert.True(t, replica.Equals(newSet))
+
+	assert.Equal(t, 0, Diff(newSet, newSet.Clone()).Size(), "equal sets shall have an empty delta")
+	assert.ElementsMatch(t, []int{4, 5, 6, 7}, Diff(nil, newSet).Added)
+	assert.ElementsMatch(t, []int{4, 5, 6, 7}, Diff(newSet, nil).Removed)
+	assert.Equal(t, 0, Diff[int](nil, nil).Size())
+}
+
+func TestDeltaEncoded(t *testing.T) {
+	oldSet := FromArray(genStringData(8, 1000))
+	newSet := oldSet.Clone()
+	newSet.RemoveAllFromArray(oldSet.ToArray()[:100])
+	newSet.AddAllFromArray(genStringData(9, 50))
+	delta := Diff(oldSet, newSet)
+	buf := delta.AppendEncoded(nil, StringCodec[string]())
+	decoded, n, err := DeltaFromEncoded(buf, StringCodec[string]())
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, delta, decoded)
+
+	replica := oldSet.Clone()
+	replica.Apply(decoded)
+	assert.True(t, replica.Equals(newSet))
+
+	_, _, err = DeltaFromEncoded(buf[:len(buf)-1], StringCodec[string]())
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, _, err = DeltaFromEncoded(nil, StringCodec[string]())
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestIntegerDelta(t *testing.T) {
+	ids := generateInt64Data(10_000)
+	oldSet := FromArray(ids[:9_000])
+	newSet := FromArray(ids[1_000:])
+	delta := Diff(oldSet, newSet)
+	original := Delta[int64]{Added: slices.Clone(delta.Added), Removed: slices.Clone(delta.Removed)}
+	compact := AppendIntegerDelta(nil, delta)
+	assert.Equal(t, original, delta, "delta shall not be modified")
+	generic := delta.AppendEncoded(nil, IntegerCodec[int64]())
+	assert.Less(t, len(compact), len(generic)/2, "gap encoding shall be much more compact for clustered ids")
+	assert.Less(t, len(compact), 2*delta.Size()+20, "gaps < 128 shall take one byte")
+
+	decoded, n, err := IntegerDeltaFromEncoded[int64](compact)
+	require.NoError(t, err)
+	assert.Equal(t, len(compact), n)
+	slices.Sort(delta.Added)
+	slices.Sort(delta.Removed)
+	assert.Equal(t, delta, decoded, "decoded delta shall be sorted")
+
+	replica := oldSet.Clone()
+	replica.Apply(decoded)
+	assert.True(t, replica.Equals(newSet))
+}
+
+func TestIntegerDeltaExtremes(t *testing.T) {
+	signed := Delta[int64]{Added: []int64{math.MaxInt64, math.MinInt64, 0, -1}, Removed: []int64{}}
+	decoded, _, err := IntegerDeltaFromEncoded[int64](AppendIntegerDelta(nil, signed))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{math.MinInt64, -1, 0, math.MaxInt64}, decoded.Added)
+	assert.Empty(t, decoded.Removed)
+
+	unsigned := Delta[uint8]{Added: []uint8{255, 0}, Removed: []uint8{7}}
+	decoded8, _, err := IntegerDeltaFromEncoded[uint8](AppendIntegerDelta(nil, unsigned))
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{0, 255}, decoded8.Added)
+	assert.Equal(t, []uint8{7}, decoded8.Removed)
+}
+
+func TestIntegerDeltaInvalid(t *testing.T) {
+	_, _, err := IntegerDeltaFromEncoded[uint8]([]byte{2, 250, 10, 0})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "gaps beyond the range of T shall be detected")
+	_, _, err = IntegerDeltaFromEncoded[int8]([]byte{2, 9, 200, 1, 0})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "gaps beyond the range of T shall be detected")
+	_, _, err = IntegerDeltaFromEncoded[uint32]([]byte{2, 1, 0, 0})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "zero gaps (duplicates) shall be detected")
+	_, _, err = IntegerDeltaFromEncoded[uint32]([]byte{3, 1, 1})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "truncated data shall be detected")
+	_, _, err = IntegerDeltaFromEncoded[uint32]([]byte{1, 1})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "missing removed part shall be detected")
+}
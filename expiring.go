@@ -0,0 +1,311 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"time"
+
+	"github.com/dolthub/maphash"
+)
+
+/*
+ExpiringSet3 is a set whose elements expire a fixed time to live (TTL) after they have been added, e.g. for deduplication windows
+of "recently seen" keys. It uses the same Swiss table layout as Set3 with an expiry timestamp next to each slot.
+
+Expired elements are treated as absent. They are reclaimed lazily when a lookup comes across them, when thisSet would otherwise
+have to grow, or explicitly by [ExpiringSet3.Sweep]. The clock can be replaced for tests, see [EmptyExpiringSet3WithClock].
+*/
+type ExpiringSet3[T comparable] struct {
+	hashFunction maphash.Hasher[T]
+	ttl          time.Duration
+	clock        func() time.Time
+	epoch        time.Time // expiry timestamps are stored relative to epoch
+	set3table
+	groupSlot   [][set3groupSize]T
+	groupExpiry [][set3groupSize]time.Duration
+}
+
+/*
+EmptyExpiringSet3 creates a new and empty ExpiringSet3 whose elements expire ttl after they have been added.
+
+EmptyExpiringSet3 panics if ttl is not positive.
+
+Example:
+
+	seen := EmptyExpiringSet3[string](5 * time.Minute)
+	seen.Add("request-42")
+*/
+func EmptyExpiringSet3[T comparable](ttl time.Duration) *ExpiringSet3[T] {
+	return EmptyExpiringSet3WithClock[T](21, ttl, time.Now)
+}
+
+/*
+EmptyExpiringSet3WithCapacity creates a new and empty ExpiringSet3 that can hold initialCapacity elements without being reorganized.
+See [EmptyExpiringSet3].
+*/
+func EmptyExpiringSet3WithCapacity[T comparable](initialCapacity uint32, ttl time.Duration) *ExpiringSet3[T] {
+	return EmptyExpiringSet3WithClock[T](initialCapacity, ttl, time.Now)
+}
+
+/*
+EmptyExpiringSet3WithClock creates a new and empty ExpiringSet3 that reads the current time from clock instead of [time.Now].
+This lets tests advance the time without sleeping. See [EmptyExpiringSet3].
+
+Example:
+
+	now := time.Now()
+	seen := EmptyExpiringSet3WithClock[string](100, time.Minute, func() time.Time { return now })
+	seen.Add("a")
+	now = now.Add(2 * time.Minute)
+	b := seen.Contains("a") // b will be false
+*/
+func EmptyExpiringSet3WithClock[T comparable](initialCapacity uint32, ttl time.Duration, clock func() time.Time) *ExpiringSet3[T] {
+	if ttl <= 0 {
+		panic(fmt.Sprintf("set3: ttl must be positive, got %v", ttl))
+	}
+	result := &ExpiringSet3[T]{hashFunction: maphash.NewHasher[T](), ttl: ttl, clock: clock, epoch: clock()}
+	result.allocate(calcReqNrOfGroups(initialCapacity))
+	return result
+}
+
+func (thisSet *ExpiringSet3[T]) allocate(numGroups uint32) {
+	thisSet.set3table.allocate(numGroups)
+	thisSet.groupSlot = make([][set3groupSize]T, numGroups)
+	thisSet.groupExpiry = make([][set3groupSize]time.Duration, numGroups)
+}
+
+// now returns the current time relative to the epoch of thisSet.
+func (thisSet *ExpiringSet3[T]) now() time.Duration {
+	return thisSet.clock().Sub(thisSet.epoch)
+}
+
+// find looks up the element and reclaims the expired elements it comes across on the way.
+func (thisSet *ExpiringSet3[T]) find(element T, now time.Duration) (uint64, int, bool) {
+	return thisSet.probe(thisSet.hashFunction.Hash(element), func(g uint64, s int) bool {
+		if thisSet.groupExpiry[g][s] <= now {
+			thisSet.release(g, s)
+			return false
+		}
+		return element == thisSet.groupSlot[g][s]
+	})
+}
+
+func (thisSet *ExpiringSet3[T]) release(g uint64, s int) {
+	thisSet.set3table.release(g, s)
+	var k T
+	thisSet.groupSlot[g][s] = k
+	thisSet.groupExpiry[g][s] = 0
+}
+
+/*
+Returns a string representation of the unexpired elements of thisSet in Roster notation. The order of the elements in the result is arbitrary.
+*/
+func (thisSet *ExpiringSet3[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), set3formatValue)
+}
+
+/*
+TTL returns the time to live of the elements of thisSet.
+*/
+func (thisSet *ExpiringSet3[T]) TTL() time.Duration {
+	return thisSet.ttl
+}
+
+/*
+Size returns the number of elements stored in thisSet. This includes expired elements that have not been reclaimed yet,
+so call [ExpiringSet3.Sweep] first to get the exact number of unexpired elements.
+*/
+func (thisSet *ExpiringSet3[T]) Size() uint32 {
+	return thisSet.size()
+}
+
+/*
+Contains returns true if thisSet contains the element and the element has not expired yet.
+*/
+func (thisSet *ExpiringSet3[T]) Contains(element T) bool {
+	_, _, found := thisSet.find(element, thisSet.now())
+	return found
+}
+
+/*
+ExpiresAt returns the point in time when the element expires, or false if thisSet does not contain the element.
+*/
+func (thisSet *ExpiringSet3[T]) ExpiresAt(element T) (time.Time, bool) {
+	g, s, found := thisSet.find(element, thisSet.now())
+	if !found {
+		return time.Time{}, false
+	}
+	return thisSet.epoch.Add(thisSet.groupExpiry[g][s]), true
+}
+
+/*
+Add inserts the element into thisSet, or renews its time to live if thisSet already contains it.
+
+Example:
+
+	seen := EmptyExpiringSet3[string](time.Minute)
+	seen.Add("a")
+	// 50 seconds later
+	seen.Add("a") // "a" will now expire one minute from now
+*/
+func (thisSet *ExpiringSet3[T]) Add(element T) {
+	thisSet.AddWithTTL(element, thisSet.ttl)
+}
+
+/*
+AddWithTTL inserts the element into thisSet with an individual time to live, or sets the time to live if thisSet already contains it.
+The element is treated as expired right away if ttl is not positive.
+*/
+func (thisSet *ExpiringSet3[T]) AddWithTTL(element T, ttl time.Duration) {
+	now := thisSet.now()
+	if g, s, found := thisSet.find(element, now); found {
+		thisSet.groupExpiry[g][s] = now + ttl
+		return
+	}
+	if thisSet.full() {
+		// reclaim the expired elements first, maybe they make room without growing
+		thisSet.sweep(now)
+		if thisSet.full() {
+			thisSet.rehashToNumGroups(thisSet.nextGroupCount())
+		}
+	}
+	thisSet.insertNew(element, now+ttl)
+}
+
+func (thisSet *ExpiringSet3[T]) insertNew(element T, expiry time.Duration) {
+	g, s := thisSet.claim(thisSet.hashFunction.Hash(element))
+	thisSet.groupSlot[g][s] = element
+	thisSet.groupExpiry[g][s] = expiry
+}
+
+/*
+Inserts all parameter values into thisSet, see [ExpiringSet3.Add].
+*/
+func (thisSet *ExpiringSet3[T]) AddAllOf(args ...T) {
+	for _, e := range args {
+		thisSet.Add(e)
+	}
+}
+
+/*
+Removes the element from thisSet, returns whether or not the element was in thisSet and had not expired yet.
+*/
+func (thisSet *ExpiringSet3[T]) Remove(element T) bool {
+	g, s, found := thisSet.find(element, thisSet.now())
+	if found {
+		thisSet.release(g, s)
+	}
+	return found
+}
+
+/*
+Sweep reclaims all expired elements and returns their number.
+
+Example:
+
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		seen.Sweep()
+	}
+*/
+func (thisSet *ExpiringSet3[T]) Sweep() uint32 {
+	return thisSet.sweep(thisSet.now())
+}
+
+func (thisSet *ExpiringSet3[T]) sweep(now time.Duration) uint32 {
+	removed := uint32(0)
+	for g, s := range thisSet.slots() {
+		if thisSet.groupExpiry[g][s] <= now {
+			thisSet.release(g, s)
+			removed++
+		}
+	}
+	return removed
+}
+
+/*
+Clear removes all elements from thisSet.
+*/
+func (thisSet *ExpiringSet3[T]) Clear() {
+	clear(thisSet.groupSlot)
+	clear(thisSet.groupExpiry)
+	thisSet.reset()
+}
+
+/*
+Clone creates a copy of thisSet, including the expiry times of its elements.
+*/
+func (thisSet *ExpiringSet3[T]) Clone() *ExpiringSet3[T] {
+	return &ExpiringSet3[T]{
+		hashFunction: thisSet.hashFunction,
+		ttl:          thisSet.ttl,
+		clock:        thisSet.clock,
+		epoch:        thisSet.epoch,
+		set3table:    thisSet.clone(),
+		groupSlot:    slices.Clone(thisSet.groupSlot),
+		groupExpiry:  slices.Clone(thisSet.groupExpiry),
+	}
+}
+
+func (thisSet *ExpiringSet3[T]) rehashToNumGroups(newNumGroups uint32) {
+	oldTable, oldGroupSlot, oldGroupExpiry := thisSet.set3table, thisSet.groupSlot, thisSet.groupExpiry
+	thisSet.hashFunction = maphash.NewSeed(thisSet.hashFunction)
+	thisSet.allocate(newNumGroups)
+	for g, s := range oldTable.slots() {
+		thisSet.insertNew(oldGroupSlot[g][s], oldGroupExpiry[g][s])
+	}
+}
+
+/*
+Iterates over all unexpired elements in thisSet.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [ExpiringSet3.ImmutableRange].
+*/
+func (thisSet *ExpiringSet3[T]) MutableRange() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		now := thisSet.now()
+		for g, s := range thisSet.slots() {
+			if thisSet.groupExpiry[g][s] > now && !yield(thisSet.groupSlot[g][s]) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all unexpired elements in thisSet.
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *ExpiringSet3[T]) ImmutableRange() iter.Seq[T] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray allocates an array of type T and adds all unexpired elements of thisSet to it. The order of the elements in the resulting array is arbitrary.
+*/
+func (thisSet *ExpiringSet3[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestExpiringSetExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	set := EmptyExpiringSet3WithClock[string](10, time.Minute, clock.Now)
+	assert.Equal(t, time.Minute, set.TTL())
+	set.AddAllOf("a", "b")
+	clock.Advance(30 * time.Second)
+	set.Add("c")
+	set.Add("a") // renews "a"
+	expiresAt, ok := set.ExpiresAt("a")
+	assert.True(t, ok)
+	assert.Equal(t, clock.now.Add(time.Minute), expiresAt)
+
+	clock.Advance(30 * time.Second)
+	assert.False(t, set.Contains("b"), "b expires exactly after one minute")
+	assert.True(t, set.Contains("a"))
+	assert.True(t, set.Contains("c"))
+	assert.Equal(t, uint32(2), set.Size(), "the lookup of b has reclaimed it")
+	assert.ElementsMatch(t, []string{"a", "c"}, set.ToArray())
+
+	set.AddWithTTL("d", time.Hour)
+	clock.Advance(time.Minute)
+	assert.Equal(t, uint32(3), set.Size())
+	assert.Equal(t, "{d}", set.String())
+	assert.Equal(t, uint32(2), set.Sweep())
+	assert.Equal(t, uint32(1), set.Size())
+	assert.False(t, set.Remove("a"))
+	assert.True(t, set.Remove("d"))
+	_, ok = set.ExpiresAt("d")
+	assert.False(t, ok)
+}
+
+func TestExpiringSetMatchesModel(t *testing.T) {
+	rng := rand.New(rand.NewPCG(41, 42)) //nolint:gosec
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	set := EmptyExpiringSet3WithClock[int](0, 100*time.Millisecond, clock.Now)
+	model := map[int]time.Time{}
+	for i := range 50_000 {
+		e := rng.IntN(2000)
+		switch rng.IntN(4) {
+		case 0, 1:
+			set.Add(e)
+			model[e] = clock.now.Add(100 * time.Millisecond)
+		case 2:
+			expiry, ok := model[e]
+			assert.Equal(t, ok && expiry.After(clock.now), set.Remove(e))
+			delete(model, e)
+		default:
+			clock.Advance(time.Duration(rng.IntN(100)) * time.Microsecond)
+		}
+		if i%500 == 0 {
+			live := 0
+			for k, expiry := range model {
+				if expiry.After(clock.now) {
+					live++
+				}
+				require.Equal(t, expiry.After(clock.now), set.Contains(k))
+			}
+			require.Len(t, set.ToArray(), live)
+		}
+	}
+	set.Sweep()
+	assert.LessOrEqual(t, set.Size(), uint32(len(model))) //nolint:gosec
+	assert.Less(t, len(set.groupCtrl), 2000, "expired elements make room instead of growing")
+}
+
+func TestExpiringSetCloneAndClear(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	set := EmptyExpiringSet3WithClock[int](10, time.Second, clock.Now)
+	for i := range 100 {
+		set.Add(i)
+	}
+	clone := set.Clone()
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+	assert.True(t, clone.Contains(42))
+	for e := range clone.ImmutableRange() {
+		if e%2 == 0 {
+			clone.Remove(e)
+		}
+	}
+	assert.Equal(t, uint32(50), clone.Size())
+	clock.Advance(time.Second)
+	assert.Empty(t, clone.ToArray())
+	var nilSet *ExpiringSet3[int]
+	assert.Equal(t, "{nil}", nilSet.String())
+	assert.Panics(t, func() { EmptyExpiringSet3[int](0) })
+	assert.NotNil(t, EmptyExpiringSet3WithCapacity[int](100, time.Second))
+}
@@ -0,0 +1,460 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+)
+
+const (
+	bloomMagic           = "SET3BLM\x00"
+	cuckooMagic          = "SET3CKO\x00"
+	cuckooBucketSize     = 4
+	cuckooMaxKicks       = 500
+	cuckooMaxLoad        = 0.95
+	cuckooMinFingerprint = 4
+	cuckooMaxFingerprint = 16
+)
+
+func checkFalsePositiveRate(fpRate float64) {
+	if !(fpRate > 0 && fpRate < 1) {
+		panic(fmt.Sprintf("set3: false positive rate must be in (0,1), got %v", fpRate))
+	}
+}
+
+/*
+BloomFilter is a probabilistic set: [BloomFilter.MightContain] never returns false for an element that has been added, but may return true for an element
+that has not been added (false positive). Use it as a compact pre-check in front of a large Set3 or to ship a membership summary to clients.
+Elements cannot be removed from a BloomFilter; use a [CuckooFilter] if you need to.
+
+For plain data types (see [IBLT]) and string types, the hash values are the same in every process, so a BloomFilter can be serialized with [BloomFilter.AppendEncoded].
+*/
+type BloomFilter[T comparable] struct {
+	hasher    sketchHasher[T]
+	numBits   uint64
+	numHashes uint32
+	bits      []uint64
+}
+
+/*
+NewBloomFilter creates a new and empty BloomFilter that has a false positive rate of about fpRate once expectedElements elements have been added.
+Panics if fpRate is not in (0,1).
+
+Example:
+
+	filter := NewBloomFilter[string](1_000_000, 0.01)
+*/
+func NewBloomFilter[T comparable](expectedElements uint32, fpRate float64) *BloomFilter[T] {
+	checkFalsePositiveRate(fpRate)
+	n := float64(max(expectedElements, 1))
+	numBits := uint64(math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	numBits = max(64, (numBits+63)&^63)
+	numHashes := uint32(max(1, math.Round(float64(numBits)/n*math.Ln2)))
+	return &BloomFilter[T]{
+		hasher:    newSketchHasher[T](),
+		numBits:   numBits,
+		numHashes: numHashes,
+		bits:      make([]uint64, numBits/64),
+	}
+}
+
+/*
+BloomFilterFromSet3 creates a new BloomFilter with a false positive rate of about fpRate and adds all elements of set. nil is interpreted as empty set.
+Panics if fpRate is not in (0,1).
+
+Example:
+
+	set := From("a", "b", "c")
+	filter := BloomFilterFromSet3(set, 0.01)
+	filter.MightContain("a") // true
+*/
+func BloomFilterFromSet3[T comparable](set *Set3[T], fpRate float64) *BloomFilter[T] {
+	var size uint32
+	if set != nil {
+		size = set.Size()
+	}
+	result := NewBloomFilter[T](size, fpRate)
+	if set != nil {
+		for e := range set.MutableRange() {
+			result.Add(e)
+		}
+	}
+	return result
+}
+
+// bloomIndex returns the i-th bit index of an element with hash h (double hashing).
+func (thisFilter *BloomFilter[T]) bloomIndex(h1, h2 uint64, i uint32) uint64 {
+	hi, _ := bits.Mul64(h1+uint64(i)*h2, thisFilter.numBits)
+	return hi
+}
+
+func bloomHashes(h uint64) (uint64, uint64) {
+	return h, stableFinalize(h) | 1
+}
+
+/*
+Add adds the element to thisFilter.
+*/
+func (thisFilter *BloomFilter[T]) Add(element T) {
+	h1, h2 := bloomHashes(thisFilter.hasher.hash(element, 0))
+	for i := range thisFilter.numHashes {
+		idx := thisFilter.bloomIndex(h1, h2, i)
+		thisFilter.bits[idx/64] |= 1 << (idx % 64)
+	}
+}
+
+/*
+MightContain returns false if the element has definitely not been added to thisFilter. It returns true if the element has been added,
+or with a small probability (false positive), if it has not been added.
+*/
+func (thisFilter *BloomFilter[T]) MightContain(element T) bool {
+	h1, h2 := bloomHashes(thisFilter.hasher.hash(element, 0))
+	for i := range thisFilter.numHashes {
+		idx := thisFilter.bloomIndex(h1, h2, i)
+		if thisFilter.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NumBits returns the size of thisFilter in bits.
+func (thisFilter *BloomFilter[T]) NumBits() uint64 {
+	return thisFilter.numBits
+}
+
+// NumHashes returns the number of bits set per element.
+func (thisFilter *BloomFilter[T]) NumHashes() uint32 {
+	return thisFilter.numHashes
+}
+
+/*
+AppendEncoded appends a binary representation of thisFilter to dst and returns the extended buffer.
+
+Returns an error wrapping [ErrUnsupportedType] if T is neither a plain data type nor a string type, as the hash values of other types differ between processes.
+
+Example:
+
+	buf, err := filter.AppendEncoded(nil)
+*/
+func (thisFilter *BloomFilter[T]) AppendEncoded(dst []byte) ([]byte, error) {
+	tag, ok := thisFilter.hasher.formatTag()
+	if !ok {
+		return dst, fmt.Errorf("%w: hash values of %T cannot be serialized", ErrUnsupportedType, *new(T))
+	}
+	dst = append(dst, bloomMagic...)
+	dst = binary.LittleEndian.AppendUint32(dst, tag)
+	dst = binary.LittleEndian.AppendUint32(dst, thisFilter.numHashes)
+	dst = binary.LittleEndian.AppendUint64(dst, thisFilter.numBits)
+	for _, w := range thisFilter.bits {
+		dst = binary.LittleEndian.AppendUint64(dst, w)
+	}
+	return dst, nil
+}
+
+/*
+BloomFilterFromEncoded restores a BloomFilter from the binary representation written by [BloomFilter.AppendEncoded].
+It returns the filter along with the number of bytes read from data.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid encoded filter,
+or [ErrUnsupportedType] if the filter has been built for another element type or on a platform with another byte order.
+
+Example:
+
+	filter, _, err := BloomFilterFromEncoded[string](buf)
+*/
+func BloomFilterFromEncoded[T comparable](data []byte) (*BloomFilter[T], int, error) {
+	const headerSize = len(bloomMagic) + 4 + 4 + 8
+	if len(data) < headerSize || string(data[:len(bloomMagic)]) != bloomMagic {
+		return nil, 0, fmt.Errorf("%w: not a BloomFilter", ErrInvalidFormat)
+	}
+	hasher := newSketchHasher[T]()
+	if err := checkFormatTag(&hasher, binary.LittleEndian.Uint32(data[len(bloomMagic):])); err != nil {
+		return nil, 0, err
+	}
+	numHashes := binary.LittleEndian.Uint32(data[len(bloomMagic)+4:])
+	numBits := binary.LittleEndian.Uint64(data[len(bloomMagic)+8:])
+	if numHashes == 0 || numBits == 0 || numBits%64 != 0 || numBits/8 > uint64(len(data)-headerSize) {
+		return nil, 0, fmt.Errorf("%w: invalid BloomFilter size", ErrInvalidFormat)
+	}
+	result := &BloomFilter[T]{
+		hasher:    hasher,
+		numBits:   numBits,
+		numHashes: numHashes,
+		bits:      make([]uint64, numBits/64),
+	}
+	pos := headerSize
+	for i := range result.bits {
+		result.bits[i] = binary.LittleEndian.Uint64(data[pos:])
+		pos += 8
+	}
+	return result, pos, nil
+}
+
+func checkFormatTag[T comparable](hasher *sketchHasher[T], tag uint32) error {
+	own, ok := hasher.formatTag()
+	if !ok {
+		return fmt.Errorf("%w: hash values of %T cannot be serialized", ErrUnsupportedType, *new(T))
+	}
+	if own != tag {
+		return fmt.Errorf("%w: data has been built for another element type or byte order", ErrUnsupportedType)
+	}
+	return nil
+}
+
+/*
+CuckooFilter is a probabilistic set like [BloomFilter], which additionally supports the removal of elements. It stores a small fingerprint
+of every element in one of two candidate buckets. For low false positive rates, it needs less space than a BloomFilter.
+
+As for BloomFilter, a CuckooFilter can be serialized if T is a plain data type or a string type.
+*/
+type CuckooFilter[T comparable] struct {
+	hasher          sketchHasher[T]
+	fingerprintBits uint32
+	size            uint32
+	bucketMask      uint64
+	slots           []uint16 // cuckooBucketSize fingerprints per bucket, 0 marks an empty slot
+}
+
+/*
+NewCuckooFilter creates a new and empty CuckooFilter for up to capacity elements and a false positive rate of about fpRate.
+Fingerprints are at most 16 bits wide, which limits the false positive rate to about 0.0002.
+Panics if fpRate is not in (0,1).
+
+Example:
+
+	filter := NewCuckooFilter[uint64](1_000_000, 0.001)
+*/
+func NewCuckooFilter[T comparable](capacity uint32, fpRate float64) *CuckooFilter[T] {
+	checkFalsePositiveRate(fpRate)
+	fingerprintBits := uint32(math.Ceil(math.Log2(2 * cuckooBucketSize / fpRate)))
+	fingerprintBits = min(max(fingerprintBits, cuckooMinFingerprint), cuckooMaxFingerprint)
+	numBuckets := uint64(math.Ceil(float64(max(capacity, 1)) / (cuckooBucketSize * cuckooMaxLoad)))
+	numBuckets = 1 << bits.Len64(numBuckets-1) // power of two, so the alternate bucket can be computed with XOR
+	return newCuckooFilter[T](fingerprintBits, numBuckets)
+}
+
+func newCuckooFilter[T comparable](fingerprintBits uint32, numBuckets uint64) *CuckooFilter[T] {
+	return &CuckooFilter[T]{
+		hasher:          newSketchHasher[T](),
+		fingerprintBits: fingerprintBits,
+		bucketMask:      numBuckets - 1,
+		slots:           make([]uint16, numBuckets*cuckooBucketSize),
+	}
+}
+
+/*
+CuckooFilterFromSet3 creates a new CuckooFilter with a false positive rate of about fpRate and adds all elements of set. nil is interpreted as empty set.
+Panics if fpRate is not in (0,1).
+
+Example:
+
+	set := From[uint64](1, 2, 3)
+	filter := CuckooFilterFromSet3(set, 0.001)
+	filter.MightContain(1) // true
+*/
+func CuckooFilterFromSet3[T comparable](set *Set3[T], fpRate float64) *CuckooFilter[T] {
+	if set == nil {
+		return NewCuckooFilter[T](0, fpRate)
+	}
+	result := NewCuckooFilter[T](set.Size(), fpRate)
+	for {
+		complete := true
+		for e := range set.MutableRange() {
+			if !result.Add(e) {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			return result
+		}
+		// very unlikely: too many collisions, retry with twice the number of buckets
+		result = newCuckooFilter[T](result.fingerprintBits, 2*(result.bucketMask+1))
+	}
+}
+
+func (thisFilter *CuckooFilter[T]) locate(element T) (fp uint16, i1, i2 uint64) {
+	h := thisFilter.hasher.hash(element, 0)
+	fp = uint16(h>>48) & (1<<thisFilter.fingerprintBits - 1) //nolint:gosec
+	if fp == 0 {
+		fp = 1
+	}
+	i1 = h & thisFilter.bucketMask
+	return fp, i1, thisFilter.altIndex(i1, fp)
+}
+
+func (thisFilter *CuckooFilter[T]) altIndex(i uint64, fp uint16) uint64 {
+	return (i ^ stableFinalize(uint64(fp))) & thisFilter.bucketMask
+}
+
+func (thisFilter *CuckooFilter[T]) bucket(i uint64) []uint16 {
+	return thisFilter.slots[i*cuckooBucketSize : (i+1)*cuckooBucketSize]
+}
+
+func (thisFilter *CuckooFilter[T]) insertInto(i uint64, fp uint16) bool {
+	b := thisFilter.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Add adds the element to thisFilter. It returns false if thisFilter is too full to add the element; thisFilter is unchanged in this case.
+Adding the same element more than 8 times fails as well, as all copies share the same two buckets.
+*/
+func (thisFilter *CuckooFilter[T]) Add(element T) bool {
+	fp, i1, i2 := thisFilter.locate(element)
+	if thisFilter.insertInto(i1, fp) || thisFilter.insertInto(i2, fp) {
+		thisFilter.size++
+		return true
+	}
+	// relocate existing fingerprints; remember the path to undo it on failure
+	type kick struct {
+		bucket uint64
+		slot   int
+	}
+	var path [cuckooMaxKicks]kick
+	i := i1
+	if rand.IntN(2) == 0 { //nolint:gosec
+		i = i2
+	}
+	for n := range cuckooMaxKicks {
+		j := rand.IntN(cuckooBucketSize) //nolint:gosec
+		b := thisFilter.bucket(i)
+		fp, b[j] = b[j], fp
+		path[n] = kick{i, j}
+		i = thisFilter.altIndex(i, fp)
+		if thisFilter.insertInto(i, fp) {
+			thisFilter.size++
+			return true
+		}
+	}
+	for n := cuckooMaxKicks - 1; n >= 0; n-- {
+		b := thisFilter.bucket(path[n].bucket)
+		fp, b[path[n].slot] = b[path[n].slot], fp
+	}
+	return false
+}
+
+/*
+MightContain returns false if the element has definitely not been added to thisFilter. It returns true if the element has been added,
+or with a small probability (false positive), if it has not been added.
+*/
+func (thisFilter *CuckooFilter[T]) MightContain(element T) bool {
+	fp, i1, i2 := thisFilter.locate(element)
+	for _, i := range [2]uint64{i1, i2} {
+		for _, f := range thisFilter.bucket(i) {
+			if f == fp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+Remove removes the element from thisFilter and returns true, if the element might have been added. Only remove elements that have been added before,
+otherwise another element that shares the fingerprint might be removed.
+*/
+func (thisFilter *CuckooFilter[T]) Remove(element T) bool {
+	fp, i1, i2 := thisFilter.locate(element)
+	for _, i := range [2]uint64{i1, i2} {
+		b := thisFilter.bucket(i)
+		for j := range b {
+			if b[j] == fp {
+				b[j] = 0
+				thisFilter.size--
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Size returns the number of elements in thisFilter.
+func (thisFilter *CuckooFilter[T]) Size() uint32 {
+	return thisFilter.size
+}
+
+/*
+AppendEncoded appends a binary representation of thisFilter to dst and returns the extended buffer.
+
+Returns an error wrapping [ErrUnsupportedType] if T is neither a plain data type nor a string type, as the hash values of other types differ between processes.
+
+Example:
+
+	buf, err := filter.AppendEncoded(nil)
+*/
+func (thisFilter *CuckooFilter[T]) AppendEncoded(dst []byte) ([]byte, error) {
+	tag, ok := thisFilter.hasher.formatTag()
+	if !ok {
+		return dst, fmt.Errorf("%w: hash values of %T cannot be serialized", ErrUnsupportedType, *new(T))
+	}
+	dst = append(dst, cuckooMagic...)
+	dst = binary.LittleEndian.AppendUint32(dst, tag)
+	dst = binary.LittleEndian.AppendUint32(dst, thisFilter.fingerprintBits)
+	dst = binary.LittleEndian.AppendUint32(dst, thisFilter.size)
+	dst = binary.LittleEndian.AppendUint64(dst, thisFilter.bucketMask+1)
+	for _, f := range thisFilter.slots {
+		dst = binary.LittleEndian.AppendUint16(dst, f)
+	}
+	return dst, nil
+}
+
+/*
+CuckooFilterFromEncoded restores a CuckooFilter from the binary representation written by [CuckooFilter.AppendEncoded].
+It returns the filter along with the number of bytes read from data.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid encoded filter,
+or [ErrUnsupportedType] if the filter has been built for another element type or on a platform with another byte order.
+
+Example:
+
+	filter, _, err := CuckooFilterFromEncoded[uint64](buf)
+*/
+func CuckooFilterFromEncoded[T comparable](data []byte) (*CuckooFilter[T], int, error) {
+	const headerSize = len(cuckooMagic) + 4 + 4 + 4 + 8
+	if len(data) < headerSize || string(data[:len(cuckooMagic)]) != cuckooMagic {
+		return nil, 0, fmt.Errorf("%w: not a CuckooFilter", ErrInvalidFormat)
+	}
+	hasher := newSketchHasher[T]()
+	if err := checkFormatTag(&hasher, binary.LittleEndian.Uint32(data[len(cuckooMagic):])); err != nil {
+		return nil, 0, err
+	}
+	fingerprintBits := binary.LittleEndian.Uint32(data[len(cuckooMagic)+4:])
+	size := binary.LittleEndian.Uint32(data[len(cuckooMagic)+8:])
+	numBuckets := binary.LittleEndian.Uint64(data[len(cuckooMagic)+12:])
+	if fingerprintBits < cuckooMinFingerprint || fingerprintBits > cuckooMaxFingerprint || numBuckets == 0 || numBuckets&(numBuckets-1) != 0 ||
+		numBuckets > uint64(len(data)-headerSize)/(2*cuckooBucketSize) || uint64(size) > numBuckets*cuckooBucketSize {
+		return nil, 0, fmt.Errorf("%w: invalid CuckooFilter parameters", ErrInvalidFormat)
+	}
+	result := newCuckooFilter[T](fingerprintBits, numBuckets)
+	result.size = size
+	pos := headerSize
+	for i := range result.slots {
+		result.slots[i] = binary.LittleEndian.Uint16(data[pos:])
+		pos += 2
+	}
+	return result, pos, nil
+}
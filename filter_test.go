@@ -0,0 +1,180 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type membershipFilter[T comparable] interface {
+	MightContain(element T) bool
+}
+
+// measureFalsePositiveRate probes elements that are not in the filter and returns the fraction of positive answers.
+func measureFalsePositiveRate[T comparable](filter membershipFilter[T], probes []T) float64 {
+	positives := 0
+	for _, e := range probes {
+		if filter.MightContain(e) {
+			positives++
+		}
+	}
+	return float64(positives) / float64(len(probes))
+}
+
+func filterTestData(n int) (members, probes []int64) {
+	for i := range n {
+		members = append(members, int64(i)*7919)
+		probes = append(probes, -int64(i)-1)
+	}
+	return members, probes
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	members, probes := filterTestData(100_000)
+	set := FromArray(members)
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		filter := BloomFilterFromSet3(set, fpRate)
+		for _, e := range members {
+			require.True(t, filter.MightContain(e), "a BloomFilter shall not have false negatives")
+		}
+		measured := measureFalsePositiveRate[int64](filter, probes)
+		assert.Less(t, measured, 1.3*fpRate, "false positive rate for target %v", fpRate)
+		assert.Greater(t, measured, 0.5*fpRate, "filter for target %v shall not be oversized", fpRate)
+	}
+}
+
+func TestBloomFilterStrings(t *testing.T) {
+	set := Empty[string]()
+	var probes []string
+	for i := range 10_000 {
+		set.Add(fmt.Sprintf("member-%d", i))
+		probes = append(probes, fmt.Sprintf("other-%d", i))
+	}
+	filter := BloomFilterFromSet3(set, 0.01)
+	for e := range set.MutableRange() {
+		require.True(t, filter.MightContain(e))
+	}
+	assert.Less(t, measureFalsePositiveRate[string](filter, probes), 0.013)
+}
+
+func TestBloomFilterEncoded(t *testing.T) {
+	members, probes := filterTestData(1000)
+	filter := BloomFilterFromSet3(FromArray(members), 0.01)
+	buf, err := filter.AppendEncoded([]byte{0xff})
+	require.NoError(t, err)
+	decoded, n, err := BloomFilterFromEncoded[int64](buf[1:])
+	require.NoError(t, err)
+	assert.Equal(t, len(buf)-1, n)
+	assert.Equal(t, filter.NumBits(), decoded.NumBits())
+	assert.Equal(t, filter.NumHashes(), decoded.NumHashes())
+	for _, e := range append(members, probes...) {
+		assert.Equal(t, filter.MightContain(e), decoded.MightContain(e))
+	}
+
+	_, _, err = BloomFilterFromEncoded[int64](buf[1 : len(buf)-1])
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, _, err = BloomFilterFromEncoded[int64](buf[:8])
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, _, err = BloomFilterFromEncoded[int32](buf[1:])
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "element type shall be checked")
+	_, _, err = BloomFilterFromEncoded[string](buf[1:])
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "element type shall be checked")
+}
+
+func TestBloomFilterNotSerializable(t *testing.T) {
+	filter := BloomFilterFromSet3(From(1.5, 2.5), 0.01)
+	assert.True(t, filter.MightContain(1.5))
+	other := NewBloomFilter[float64](10, 0.01)
+	other.Add(2.5)
+	assert.True(t, other.MightContain(2.5), "hash values of non-portable types shall be consistent within the process")
+	_, err := filter.AppendEncoded(nil)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+}
+
+func TestFilterInvalidRate(t *testing.T) {
+	for _, rate := range []float64{0, 1, -0.5, 2} {
+		assert.Panics(t, func() { NewBloomFilter[int](10, rate) })
+		assert.Panics(t, func() { NewCuckooFilter[int](10, rate) })
+	}
+	assert.PanicsWithValue(t, "set3: false positive rate must be in (0,1), got 2", func() { NewBloomFilter[int](10, 2) })
+}
+
+func TestCuckooFilterFalsePositiveRate(t *testing.T) {
+	members, probes := filterTestData(100_000)
+	set := FromArray(members)
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		filter := CuckooFilterFromSet3(set, fpRate)
+		assert.Equal(t, set.Size(), filter.Size())
+		for _, e := range members {
+			require.True(t, filter.MightContain(e), "a CuckooFilter shall not have false negatives")
+		}
+		measured := measureFalsePositiveRate[int64](filter, probes)
+		assert.Less(t, measured, fpRate, "false positive rate for target %v", fpRate)
+	}
+}
+
+func TestCuckooFilterRemove(t *testing.T) {
+	members, _ := filterTestData(10_000)
+	filter := CuckooFilterFromSet3(FromArray(members), 0.001)
+	for _, e := range members[:5000] {
+		assert.True(t, filter.Remove(e))
+	}
+	assert.Equal(t, uint32(5000), filter.Size())
+	for _, e := range members[5000:] {
+		assert.True(t, filter.MightContain(e), "remaining elements shall still be found")
+	}
+	assert.Less(t, measureFalsePositiveRate[int64](filter, members[:5000]), 0.002)
+}
+
+func TestCuckooFilterFull(t *testing.T) {
+	filter := NewCuckooFilter[int](4, 0.1)
+	added := 0
+	for i := range 1000 {
+		if !filter.Add(i) {
+			break
+		}
+		added++
+	}
+	assert.Less(t, added, 1000, "a full filter shall reject elements")
+	assert.Equal(t, uint32(added), filter.Size()) //nolint:gosec
+	for i := range added {
+		assert.True(t, filter.MightContain(i), "a rejected element shall not evict others")
+	}
+}
+
+func TestCuckooFilterEncoded(t *testing.T) {
+	filter := CuckooFilterFromSet3(From("a", "b", "c"), 0.01)
+	buf, err := filter.AppendEncoded(nil)
+	require.NoError(t, err)
+	decoded, n, err := CuckooFilterFromEncoded[string](buf)
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), n)
+	assert.Equal(t, uint32(3), decoded.Size())
+	assert.True(t, decoded.MightContain("b"))
+	assert.True(t, decoded.Remove("b"))
+	assert.False(t, decoded.MightContain("b"))
+
+	_, _, err = CuckooFilterFromEncoded[string](buf[:len(buf)-1])
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, _, err = CuckooFilterFromEncoded[uint64](buf)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+	_, err = CuckooFilterFromSet3(From(1.5), 0.01).AppendEncoded(nil)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+}
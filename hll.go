@@ -0,0 +1,235 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+)
+
+const (
+	// HyperLogLogDefaultPrecision is the precision used by [EstimateCapacity]. It yields a standard error of about 0.8%.
+	HyperLogLogDefaultPrecision = 14
+	hllMinPrecision             = 4
+	hllMaxPrecision             = 18
+	hllSparsePrecision          = 25
+	hllSparseEntrySize          = 12 // bytes per entry of the sparse map, including the overhead of the map
+)
+
+/*
+HyperLogLog is a HyperLogLog++ sketch that estimates the number of distinct elements of a stream in constant space.
+With precision p, it uses 2^p registers of one byte each and has a standard error of about 1.04/sqrt(2^p).
+
+As proposed by Heule et al. for HyperLogLog++, it uses 64 bit hash values and starts with a sparse representation of precision 25,
+which yields (almost) exact counts for small cardinalities. Instead of the empirical bias correction of HyperLogLog++,
+it uses the improved estimator by Otmar Ertl, which is unbiased over the full range of cardinalities.
+*/
+type HyperLogLog[T comparable] struct {
+	hasher    sketchHasher[T]
+	precision uint8
+	sparse    map[uint32]uint8 // index (precision 25) -> rank; nil in dense mode
+	registers []uint8          // nil in sparse mode
+}
+
+/*
+NewHyperLogLog creates a new and empty HyperLogLog sketch with 2^precision registers. Panics if precision is not in [4,18].
+
+Example:
+
+	sketch := NewHyperLogLog[string](HyperLogLogDefaultPrecision)
+*/
+func NewHyperLogLog[T comparable](precision uint8) *HyperLogLog[T] {
+	if precision < hllMinPrecision || precision > hllMaxPrecision {
+		panic(fmt.Sprintf("set3: precision must be in [%d,%d], got %d", hllMinPrecision, hllMaxPrecision, precision))
+	}
+	return &HyperLogLog[T]{
+		hasher:    newSketchHasher[T](),
+		precision: precision,
+		sparse:    make(map[uint32]uint8),
+	}
+}
+
+// Precision returns the precision thisSketch has been created with.
+func (thisSketch *HyperLogLog[T]) Precision() uint8 {
+	return thisSketch.precision
+}
+
+// hllRank returns the position of the first 1-bit in the bits of h that are not used for the index.
+func hllRank(h uint64, precision uint8) uint8 {
+	return uint8(bits.LeadingZeros64(h<<precision|1<<(precision-1))) + 1 //nolint:gosec
+}
+
+/*
+Add adds the element to thisSketch.
+*/
+func (thisSketch *HyperLogLog[T]) Add(element T) {
+	h := thisSketch.hasher.hash(element, 0)
+	if thisSketch.registers != nil {
+		idx := h >> (64 - thisSketch.precision)
+		thisSketch.registers[idx] = max(thisSketch.registers[idx], hllRank(h, thisSketch.precision))
+		return
+	}
+	idx := uint32(h >> (64 - hllSparsePrecision))
+	thisSketch.sparse[idx] = max(thisSketch.sparse[idx], hllRank(h, hllSparsePrecision))
+	thisSketch.convertIfFull()
+}
+
+// convertIfFull switches to the dense representation once the sparse map needs more memory than the 2^p registers.
+func (thisSketch *HyperLogLog[T]) convertIfFull() {
+	if len(thisSketch.sparse)*hllSparseEntrySize <= 1<<thisSketch.precision {
+		return
+	}
+	thisSketch.registers = make([]uint8, 1<<thisSketch.precision)
+	for idx, rank := range thisSketch.sparse {
+		thisSketch.addSparseToDense(idx, rank)
+	}
+	thisSketch.sparse = nil
+}
+
+// addSparseToDense reduces an entry of the sparse representation to the precision of the registers.
+func (thisSketch *HyperLogLog[T]) addSparseToDense(idx uint32, rank uint8) {
+	extraBits := hllSparsePrecision - thisSketch.precision
+	denseIdx := idx >> extraBits
+	if rest := idx & (1<<extraBits - 1); rest != 0 {
+		rank = uint8(bits.LeadingZeros32(rest)-(32-int(extraBits))) + 1 //nolint:gosec
+	} else {
+		rank += extraBits
+	}
+	thisSketch.registers[denseIdx] = max(thisSketch.registers[denseIdx], rank)
+}
+
+/*
+Merge adds all elements that have been added to thatSketch to thisSketch, so thisSketch estimates the number of distinct elements of the union of both streams.
+thatSketch is not modified.
+
+Returns an error wrapping [ErrIncompatible] if the sketches have been created with different precisions.
+
+Example:
+
+	sketch1.Merge(sketch2)
+	distinct := sketch1.Estimate()
+*/
+func (thisSketch *HyperLogLog[T]) Merge(thatSketch *HyperLogLog[T]) error {
+	if thisSketch.precision != thatSketch.precision {
+		return fmt.Errorf("%w: precisions %d and %d differ", ErrIncompatible, thisSketch.precision, thatSketch.precision)
+	}
+	if thisSketch.registers == nil && thatSketch.registers == nil {
+		for idx, rank := range thatSketch.sparse {
+			thisSketch.sparse[idx] = max(thisSketch.sparse[idx], rank)
+		}
+		thisSketch.convertIfFull()
+		return nil
+	}
+	if thisSketch.registers == nil {
+		thisSketch.registers = make([]uint8, 1<<thisSketch.precision)
+		for idx, rank := range thisSketch.sparse {
+			thisSketch.addSparseToDense(idx, rank)
+		}
+		thisSketch.sparse = nil
+	}
+	if thatSketch.registers == nil {
+		for idx, rank := range thatSketch.sparse {
+			thisSketch.addSparseToDense(idx, rank)
+		}
+		return nil
+	}
+	for i, rank := range thatSketch.registers {
+		thisSketch.registers[i] = max(thisSketch.registers[i], rank)
+	}
+	return nil
+}
+
+/*
+Estimate returns the estimated number of distinct elements that have been added to thisSketch.
+*/
+func (thisSketch *HyperLogLog[T]) Estimate() uint64 {
+	if thisSketch.registers == nil {
+		// linear counting on the 2^25 buckets of the sparse representation
+		m := float64(uint64(1) << hllSparsePrecision)
+		return uint64(math.Round(m * math.Log(m/(m-float64(len(thisSketch.sparse))))))
+	}
+	q := 64 - int(thisSketch.precision)
+	histogram := make([]float64, q+2)
+	for _, rank := range thisSketch.registers {
+		histogram[rank]++
+	}
+	m := float64(len(thisSketch.registers))
+	z := m * hllTau(1-histogram[q+1]/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + histogram[k])
+	}
+	z += m * hllSigma(histogram[0]/m)
+	return uint64(math.Round(m * m / (2 * math.Ln2 * z)))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+/*
+EstimateCapacity estimates the number of distinct elements in seq with a [HyperLogLog] sketch and returns a capacity that can be passed to [EmptyWithCapacity].
+The estimate is increased by three standard errors, so the set will hardly ever need to grow. seq is consumed once.
+
+Example:
+
+	capacity := EstimateCapacity(stream)
+	set := EmptyWithCapacity[string](capacity)
+	for e := range stream {
+		set.Add(e)
+	}
+*/
+func EstimateCapacity[T comparable](seq iter.Seq[T]) uint32 {
+	sketch := NewHyperLogLog[T](HyperLogLogDefaultPrecision)
+	for e := range seq {
+		sketch.Add(e)
+	}
+	estimate := float64(sketch.Estimate())
+	if sketch.registers != nil {
+		estimate *= 1 + 3*1.04/math.Sqrt(float64(len(sketch.registers)))
+	}
+	return uint32(min(math.Ceil(estimate), math.MaxUint32))
+}
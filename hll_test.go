@@ -0,0 +1,102 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperLogLogAccuracy(t *testing.T) {
+	for _, precision := range []uint8{10, 14} {
+		sketch := NewHyperLogLog[uint64](precision)
+		assert.Equal(t, uint64(0), sketch.Estimate())
+		// standard error is 1.04/sqrt(2^precision), allow for 4 standard errors
+		tolerance := 4 * 1.04 / float64(uint64(1)<<(precision/2))
+		added := uint64(0)
+		for _, n := range []uint64{1, 10, 100, 1000, 10_000, 100_000, 1_000_000} {
+			for ; added < n; added++ {
+				sketch.Add(added * 0x9E3779B1)
+				sketch.Add(added * 0x9E3779B1) // duplicates shall not count
+			}
+			assert.InEpsilon(t, n, sketch.Estimate(), max(tolerance, 0.001), "precision %d, cardinality %d", precision, n)
+		}
+	}
+}
+
+func TestHyperLogLogSparseIsExactForSmallSets(t *testing.T) {
+	sketch := NewHyperLogLog[string](HyperLogLogDefaultPrecision)
+	for i := range 500 {
+		sketch.Add(fmt.Sprintf("element-%d", i))
+	}
+	assert.Nil(t, sketch.registers, "sketch shall still be sparse")
+	assert.Equal(t, uint64(500), sketch.Estimate())
+}
+
+func TestHyperLogLogSparseNeedsLessMemoryThanDense(t *testing.T) {
+	sketch := NewHyperLogLog[int](10)
+	added := 0
+	for ; sketch.registers == nil; added++ {
+		require.LessOrEqual(t, len(sketch.sparse)*hllSparseEntrySize, 1<<10)
+		sketch.Add(added)
+	}
+	assert.LessOrEqual(t, added, (1<<10)/hllSparseEntrySize+1)
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	for _, sizes := range [][2]int{{100, 200}, {100, 50_000}, {50_000, 100}, {50_000, 60_000}} {
+		all := NewHyperLogLog[int](12)
+		a := NewHyperLogLog[int](12)
+		b := NewHyperLogLog[int](12)
+		for i := range sizes[0] {
+			a.Add(i)
+			all.Add(i)
+		}
+		for i := range sizes[1] {
+			b.Add(-i)
+			all.Add(-i)
+		}
+		require.NoError(t, a.Merge(b))
+		assert.Equal(t, all.Estimate(), a.Estimate(), "sizes %v", sizes)
+		if all.registers != nil {
+			assert.Equal(t, all.registers, a.registers, "merged registers shall equal the registers of the union for sizes %v", sizes)
+		}
+	}
+	err := NewHyperLogLog[int](12).Merge(NewHyperLogLog[int](13))
+	assert.True(t, errors.Is(err, ErrIncompatible))
+}
+
+func TestHyperLogLogPrecision(t *testing.T) {
+	assert.Equal(t, uint8(4), NewHyperLogLog[int](4).Precision())
+	assert.Panics(t, func() { NewHyperLogLog[int](3) })
+	assert.PanicsWithValue(t, "set3: precision must be in [4,18], got 19", func() { NewHyperLogLog[int](19) })
+}
+
+func TestEstimateCapacity(t *testing.T) {
+	for _, n := range []int{0, 10, 5000, 200_000} {
+		data := make([]int64, 0, 2*n)
+		for i := range n {
+			data = append(data, int64(i), int64(i))
+		}
+		capacity := EstimateCapacity(slices.Values(data))
+		assert.GreaterOrEqual(t, capacity, uint32(n), "capacity shall cover all distinct elements") //nolint:gosec
+		assert.LessOrEqual(t, float64(capacity), 1.05*float64(n)+1)
+	}
+}
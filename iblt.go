@@ -0,0 +1,309 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	ibltHashCount          = 3
+	ibltCheckSeed   uint64 = 0x9E3779B97F4A7C15
+	ibltFormatMagic        = "SET3IBLT"
+)
+
+// ErrIncompatible is returned if two data structures of this package cannot be combined because they have been created with different parameters.
+var ErrIncompatible = errors.New("set3: incompatible parameters")
+
+/*
+IBLT is an invertible Bloom lookup table for set reconciliation: two nodes can find the symmetric difference of their sets by exchanging sketches
+whose size depends on the size of the difference only, not on the size of the sets.
+
+Each node builds an IBLT of its set with [IBLTFromSet3], using the same number of cells and the same seed. One node sends its sketch (see [IBLT.AppendEncoded])
+to the other, which subtracts it from its own sketch with [IBLT.Subtract] and decodes the result with [IBLT.Decode]. Decoding succeeds with high probability
+if the number of cells is at least about 1.5 times the size of the symmetric difference (plus some slack for small differences).
+
+T must be a plain data type, i.e., an integer or boolean type, or an array or struct (without padding) of such types.
+*/
+type IBLT[T comparable] struct {
+	seed        uint64
+	elementSize int
+	cellsPerFn  int
+	count       []int64
+	keySum      []byte // elementSize bytes per cell, XOR of the elements
+	hashSum     []uint64
+}
+
+/*
+NewIBLT creates a new and empty IBLT with at least numCells cells. Sketches can only be subtracted from each other if they have been created with the same numCells and seed.
+
+Returns an error wrapping [ErrUnsupportedType] if T is not a plain data type.
+
+Example:
+
+	sketch, err := NewIBLT[uint64](300, 42)
+*/
+func NewIBLT[T comparable](numCells int, seed uint64) (*IBLT[T], error) {
+	elementSize, ok := plainDataSize[T]()
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a plain data type", ErrUnsupportedType, *new(T))
+	}
+	cellsPerFn := max(1, (numCells+ibltHashCount-1)/ibltHashCount)
+	total := cellsPerFn * ibltHashCount
+	return &IBLT[T]{
+		seed:        seed,
+		elementSize: elementSize,
+		cellsPerFn:  cellsPerFn,
+		count:       make([]int64, total),
+		keySum:      make([]byte, total*elementSize),
+		hashSum:     make([]uint64, total),
+	}, nil
+}
+
+/*
+IBLTFromSet3 creates a new IBLT with at least numCells cells and inserts all elements of set.
+
+Returns an error wrapping [ErrUnsupportedType] if T is not a plain data type.
+
+Example:
+
+	sketch, err := IBLTFromSet3(set, 300, 42)
+*/
+func IBLTFromSet3[T comparable](set *Set3[T], numCells int, seed uint64) (*IBLT[T], error) {
+	result, err := NewIBLT[T](numCells, seed)
+	if err != nil {
+		return nil, err
+	}
+	if set != nil {
+		for e := range set.MutableRange() {
+			result.Insert(e)
+		}
+	}
+	return result, nil
+}
+
+// NumCells returns the number of cells of thisIBLT.
+func (thisIBLT *IBLT[T]) NumCells() int {
+	return len(thisIBLT.count)
+}
+
+/*
+Insert adds the element to thisIBLT. Inserting an element twice does not have the same effect as inserting it once.
+*/
+func (thisIBLT *IBLT[T]) Insert(element T) {
+	thisIBLT.update(plainDataBytes(&element, thisIBLT.elementSize), 1)
+}
+
+/*
+Delete removes the element from thisIBLT. Deleting an element that has not been inserted leaves a negative count, as if the element was in the subtracted sketch.
+*/
+func (thisIBLT *IBLT[T]) Delete(element T) {
+	thisIBLT.update(plainDataBytes(&element, thisIBLT.elementSize), -1)
+}
+
+func (thisIBLT *IBLT[T]) update(key []byte, delta int64) {
+	check := stableHash(thisIBLT.seed^ibltCheckSeed, key)
+	for i := range ibltHashCount {
+		cell := thisIBLT.cellIndex(i, key)
+		thisIBLT.count[cell] += delta
+		cellKey := thisIBLT.keySum[cell*thisIBLT.elementSize : (cell+1)*thisIBLT.elementSize]
+		for j, b := range key {
+			cellKey[j] ^= b
+		}
+		thisIBLT.hashSum[cell] ^= check
+	}
+}
+
+// cellIndex returns the cell of the i-th hash function. Every hash function has
+// its own range of cells, so an element always maps to ibltHashCount different cells.
+func (thisIBLT *IBLT[T]) cellIndex(i int, key []byte) int {
+	h := stableHash(thisIBLT.seed+uint64(i), key)
+	return i*thisIBLT.cellsPerFn + int((h>>32)*uint64(thisIBLT.cellsPerFn)>>32) //nolint:gosec
+}
+
+/*
+Subtract returns a new IBLT that represents the difference between thisIBLT and thatIBLT: elements that are only in thisIBLT have a positive count,
+elements that are only in thatIBLT have a negative count, and elements in both cancel out.
+
+Returns an error wrapping [ErrIncompatible] if the sketches have been created with a different number of cells or a different seed.
+
+Example:
+
+	diff, err := mySketch.Subtract(peerSketch)
+*/
+func (thisIBLT *IBLT[T]) Subtract(thatIBLT *IBLT[T]) (*IBLT[T], error) {
+	if thisIBLT.seed != thatIBLT.seed || len(thisIBLT.count) != len(thatIBLT.count) || thisIBLT.elementSize != thatIBLT.elementSize {
+		return nil, fmt.Errorf("%w: sketches differ in number of cells, seed or element size", ErrIncompatible)
+	}
+	result := thisIBLT.clone()
+	for i := range result.count {
+		result.count[i] -= thatIBLT.count[i]
+		result.hashSum[i] ^= thatIBLT.hashSum[i]
+	}
+	for i := range result.keySum {
+		result.keySum[i] ^= thatIBLT.keySum[i]
+	}
+	return result, nil
+}
+
+func (thisIBLT *IBLT[T]) clone() *IBLT[T] {
+	return &IBLT[T]{
+		seed:        thisIBLT.seed,
+		elementSize: thisIBLT.elementSize,
+		cellsPerFn:  thisIBLT.cellsPerFn,
+		count:       append([]int64(nil), thisIBLT.count...),
+		keySum:      append([]byte(nil), thisIBLT.keySum...),
+		hashSum:     append([]uint64(nil), thisIBLT.hashSum...),
+	}
+}
+
+func (thisIBLT *IBLT[T]) isPure(cell int) bool {
+	if c := thisIBLT.count[cell]; c != 1 && c != -1 {
+		return false
+	}
+	key := thisIBLT.keySum[cell*thisIBLT.elementSize : (cell+1)*thisIBLT.elementSize]
+	return stableHash(thisIBLT.seed^ibltCheckSeed, key) == thisIBLT.hashSum[cell]
+}
+
+/*
+Decode lists the elements of thisIBLT. For a sketch created by [IBLT.Subtract], onlyHere contains the elements that are only in the set of thisIBLT
+and onlyThere contains the elements that are only in the set of the subtracted sketch. thisIBLT is not modified.
+
+If ok is false, the difference is too big for the number of cells and the lists are incomplete. Retry with a bigger sketch in this case.
+
+Example:
+
+	diff, _ := mySketch.Subtract(peerSketch)
+	onlyHere, onlyThere, ok := diff.Decode()
+*/
+func (thisIBLT *IBLT[T]) Decode() (onlyHere, onlyThere []T, ok bool) {
+	work := thisIBLT.clone()
+	pending := make([]int, 0, len(work.count))
+	for cell := range work.count {
+		if work.isPure(cell) {
+			pending = append(pending, cell)
+		}
+	}
+	key := make([]byte, work.elementSize)
+	for len(pending) > 0 {
+		cell := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if !work.isPure(cell) {
+			continue // has been peeled as part of another element
+		}
+		copy(key, work.keySum[cell*work.elementSize:(cell+1)*work.elementSize])
+		var element T
+		copy(plainDataBytes(&element, work.elementSize), key)
+		sign := work.count[cell]
+		if sign > 0 {
+			onlyHere = append(onlyHere, element)
+		} else {
+			onlyThere = append(onlyThere, element)
+		}
+		work.update(key, -sign)
+		for i := range ibltHashCount {
+			if c := work.cellIndex(i, key); work.isPure(c) {
+				pending = append(pending, c)
+			}
+		}
+	}
+	for cell := range work.count {
+		if work.count[cell] != 0 || work.hashSum[cell] != 0 {
+			return onlyHere, onlyThere, false
+		}
+	}
+	for _, b := range work.keySum {
+		if b != 0 {
+			return onlyHere, onlyThere, false
+		}
+	}
+	return onlyHere, onlyThere, true
+}
+
+/*
+AppendEncoded appends a binary representation of thisIBLT to dst and returns the extended buffer, e.g., to send it to a peer.
+The elements are stored in their memory representation, so the peer must run on a platform with the same byte order.
+
+Example:
+
+	buf := sketch.AppendEncoded(nil)
+*/
+func (thisIBLT *IBLT[T]) AppendEncoded(dst []byte) []byte {
+	dst = append(dst, ibltFormatMagic...)
+	dst = binary.LittleEndian.AppendUint32(dst, mappedHostFlags())
+	dst = binary.LittleEndian.AppendUint64(dst, thisIBLT.seed)
+	dst = binary.AppendUvarint(dst, uint64(thisIBLT.elementSize))
+	dst = binary.AppendUvarint(dst, uint64(thisIBLT.cellsPerFn))
+	for i, c := range thisIBLT.count {
+		dst = binary.AppendVarint(dst, c)
+		dst = binary.LittleEndian.AppendUint64(dst, thisIBLT.hashSum[i])
+	}
+	return append(dst, thisIBLT.keySum...)
+}
+
+/*
+IBLTFromEncoded restores an IBLT from the binary representation written by [IBLT.AppendEncoded].
+It returns the sketch along with the number of bytes read from data.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid encoded sketch, or [ErrUnsupportedType] if the sketch has been built for another element type.
+
+Example:
+
+	peerSketch, _, err := IBLTFromEncoded[uint64](buf)
+*/
+func IBLTFromEncoded[T comparable](data []byte) (*IBLT[T], int, error) {
+	const fixedSize = len(ibltFormatMagic) + 4 + 8
+	if len(data) < fixedSize || string(data[:len(ibltFormatMagic)]) != ibltFormatMagic {
+		return nil, 0, fmt.Errorf("%w: not an IBLT", ErrInvalidFormat)
+	}
+	if binary.LittleEndian.Uint32(data[len(ibltFormatMagic):]) != mappedHostFlags() {
+		return nil, 0, fmt.Errorf("%w: byte order of sketch does not match this platform", ErrInvalidFormat)
+	}
+	seed := binary.LittleEndian.Uint64(data[len(ibltFormatMagic)+4:])
+	pos := fixedSize
+	elementSize, n := binary.Uvarint(data[pos:])
+	if n <= 0 {
+		return nil, 0, fmt.Errorf("%w: invalid element size", ErrInvalidFormat)
+	}
+	pos += n
+	cellsPerFn, n := binary.Uvarint(data[pos:])
+	if n <= 0 || cellsPerFn == 0 || cellsPerFn > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("%w: invalid number of cells", ErrInvalidFormat)
+	}
+	pos += n
+	result, err := NewIBLT[T](int(cellsPerFn)*ibltHashCount, seed) //nolint:gosec
+	if err != nil {
+		return nil, 0, err
+	}
+	if uint64(result.elementSize) != elementSize {
+		return nil, 0, fmt.Errorf("%w: sketch contains elements of %d bytes, %T has %d bytes", ErrUnsupportedType, elementSize, *new(T), result.elementSize)
+	}
+	for i := range result.count {
+		c, n := binary.Varint(data[pos:])
+		if n <= 0 || len(data) < pos+n+8 {
+			return nil, 0, fmt.Errorf("%w: truncated cells", ErrInvalidFormat)
+		}
+		result.count[i] = c
+		result.hashSum[i] = binary.LittleEndian.Uint64(data[pos+n:])
+		pos += n + 8
+	}
+	if len(data) < pos+len(result.keySum) {
+		return nil, 0, fmt.Errorf("%w: truncated cells", ErrInvalidFormat)
+	}
+	pos += copy(result.keySum, data[pos:])
+	return result, pos, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIBLTReconcile(t *testing.T) {
+	common := generateInt64Data(100_000)
+	for _, diffSize := range []int{0, 1, 10, 100, 1000} {
+		setA := FromArray(common)
+		setB := FromArray(common)
+		var onlyA, onlyB []int64
+		for i := range diffSize {
+			if i%2 == 0 {
+				onlyA = append(onlyA, int64(-i-1))
+				setA.Add(int64(-i - 1))
+			} else {
+				onlyB = append(onlyB, int64(-i-1))
+				setB.Add(int64(-i - 1))
+			}
+		}
+		numCells := 2*diffSize + 30
+		sketchA, err := IBLTFromSet3(setA, numCells, 42)
+		require.NoError(t, err)
+		sketchB, err := IBLTFromSet3(setB, numCells, 42)
+		require.NoError(t, err)
+		diff, err := sketchA.Subtract(sketchB)
+		require.NoError(t, err)
+		gotA, gotB, ok := diff.Decode()
+		assert.True(t, ok, "difference of %d elements shall be decodable", diffSize)
+		assert.ElementsMatch(t, onlyA, gotA)
+		assert.ElementsMatch(t, onlyB, gotB)
+	}
+}
+
+func TestIBLTTooSmall(t *testing.T) {
+	setA := FromArray(generateInt64Data(1000))
+	sketchA, err := IBLTFromSet3(setA, 30, 1)
+	require.NoError(t, err)
+	sketchB, err := IBLTFromSet3(Empty[int64](), 30, 1)
+	require.NoError(t, err)
+	diff, err := sketchA.Subtract(sketchB)
+	require.NoError(t, err)
+	_, _, ok := diff.Decode()
+	assert.False(t, ok, "a difference of 1000 elements shall not be decodable from 30 cells")
+}
+
+func TestIBLTInsertDelete(t *testing.T) {
+	sketch, err := NewIBLT[uint32](30, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 30, sketch.NumCells())
+	sketch.Insert(1)
+	sketch.Insert(2)
+	sketch.Delete(3)
+	onlyHere, onlyThere, ok := sketch.Decode()
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []uint32{1, 2}, onlyHere)
+	assert.ElementsMatch(t, []uint32{3}, onlyThere)
+	sketch.Delete(1)
+	sketch.Delete(2)
+	sketch.Insert(3)
+	onlyHere, onlyThere, ok = sketch.Decode()
+	assert.True(t, ok)
+	assert.Empty(t, onlyHere)
+	assert.Empty(t, onlyThere)
+}
+
+func TestIBLTStruct(t *testing.T) {
+	type key struct {
+		Hi, Lo uint64
+	}
+	setA := From(key{1, 2}, key{3, 4}, key{5, 6})
+	setB := From(key{1, 2}, key{7, 8})
+	sketchA, err := IBLTFromSet3(setA, 20, 0)
+	require.NoError(t, err)
+	sketchB, err := IBLTFromSet3(setB, 20, 0)
+	require.NoError(t, err)
+	diff, err := sketchA.Subtract(sketchB)
+	require.NoError(t, err)
+	onlyA, onlyB, ok := diff.Decode()
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []key{{3, 4}, {5, 6}}, onlyA)
+	assert.ElementsMatch(t, []key{{7, 8}}, onlyB)
+}
+
+func TestIBLTIncompatible(t *testing.T) {
+	_, err := NewIBLT[string](30, 0)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+	_, err = IBLTFromSet3(From("a"), 30, 0)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+	a, _ := NewIBLT[uint64](30, 0)
+	b, _ := NewIBLT[uint64](30, 1)
+	c, _ := NewIBLT[uint64](60, 0)
+	_, err = a.Subtract(b)
+	assert.True(t, errors.Is(err, ErrIncompatible))
+	_, err = a.Subtract(c)
+	assert.True(t, errors.Is(err, ErrIncompatible))
+}
+
+func TestIBLTEncoded(t *testing.T) {
+	sketch, err := IBLTFromSet3(FromArray(generateInt64Data(500)), 60, 99)
+	require.NoError(t, err)
+	sketch.Delete(-5)
+	buf := sketch.AppendEncoded([]byte{1, 2, 3})
+	decoded, n, err := IBLTFromEncoded[int64](buf[3:])
+	require.NoError(t, err)
+	assert.Equal(t, len(buf)-3, n)
+	assert.Equal(t, sketch, decoded)
+
+	_, _, err = IBLTFromEncoded[int64](buf[3 : len(buf)-1])
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "truncated sketch shall be detected")
+	_, _, err = IBLTFromEncoded[int64](buf[:10])
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, _, err = IBLTFromEncoded[int32](buf[3:])
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "element size shall be checked")
+}
+
+func ExampleIBLT() {
+	// two nodes with almost the same set of ids
+	node1 := Empty[uint64]()
+	node2 := Empty[uint64]()
+	for id := range uint64(10_000) {
+		node1.Add(id)
+		node2.Add(id)
+	}
+	node1.AddAllOf(20_001, 20_002)
+	node2.Add(30_000)
+	node2.Remove(42)
+
+	// both nodes agree on the number of cells and the seed
+	sketch1, _ := IBLTFromSet3(node1, 40, 12345)
+	sketch2, _ := IBLTFromSet3(node2, 40, 12345)
+
+	// node1 sends its sketch to node2, node2 computes the difference
+	received, _, _ := IBLTFromEncoded[uint64](sketch1.AppendEncoded(nil))
+	diff, _ := sketch2.Subtract(received)
+	onlyNode2, onlyNode1, ok := diff.Decode()
+	slices.Sort(onlyNode1)
+	slices.Sort(onlyNode2)
+	fmt.Println(ok, onlyNode1, onlyNode2)
+	// Output: true [42 20001 20002] [30000]
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+/*
+Interner returns canonical instances of equal values, e.g., to deduplicate the strings parsed from a log so that equal strings share one
+copy in memory. It is built on a Set3 and [Set3.Lookup]. An Interner is not safe for concurrent use.
+
+Interning keeps the first instance of every value alive. So if a value refers to a larger buffer, e.g., a substring of a line that has been
+read, intern a copy (see [strings.Clone]) to let the garbage collector reclaim the buffer.
+
+Example:
+
+	interner := NewInterner[string](0)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		host := interner.Intern(strings.Clone(fields[0])) // all equal hosts share one string
+		// ...
+	}
+*/
+type Interner[T comparable] struct {
+	set *Set3[T]
+}
+
+/*
+NewInterner creates a new and empty Interner that can hold initialCapacity values without being reorganized.
+
+Example:
+
+	interner := NewInterner[string](10_000)
+*/
+func NewInterner[T comparable](initialCapacity uint32) *Interner[T] {
+	return &Interner[T]{set: EmptyWithCapacity[T](initialCapacity)}
+}
+
+/*
+Intern returns the canonical instance of value: the value interned first that is equal to value. If no equal value has been interned
+before, value becomes the canonical instance and is returned.
+
+Example:
+
+	interner := NewInterner[string](0)
+	a := interner.Intern(string([]byte("host")))
+	b := interner.Intern(string([]byte("host"))) // b will share the memory of a
+*/
+func (thisInterner *Interner[T]) Intern(value T) T {
+	if canonical, ok := thisInterner.set.Lookup(value); ok {
+		return canonical
+	}
+	thisInterner.set.Add(value)
+	return value
+}
+
+/*
+Lookup returns the canonical instance of value and true if an equal value has been interned before, otherwise the zero value and false.
+*/
+func (thisInterner *Interner[T]) Lookup(value T) (T, bool) {
+	return thisInterner.set.Lookup(value)
+}
+
+/*
+Size returns the number of canonical instances in thisInterner.
+*/
+func (thisInterner *Interner[T]) Size() uint32 {
+	return thisInterner.set.Size()
+}
+
+/*
+Clear forgets all canonical instances.
+*/
+func (thisInterner *Interner[T]) Clear() {
+	thisInterner.set.Clear()
+}
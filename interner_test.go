@@ -0,0 +1,57 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInternerReturnsCanonicalInstance(t *testing.T) {
+	interner := NewInterner[string](0)
+	a := interner.Intern(strings.Clone("host-1"))
+	b := strings.Clone("host-1")
+	assert.NotSame(t, unsafe.StringData(a), unsafe.StringData(b))
+	c := interner.Intern(b)
+	assert.Equal(t, "host-1", c)
+	assert.Same(t, unsafe.StringData(a), unsafe.StringData(c), "equal strings share the first instance")
+	stored, ok := interner.Lookup(strings.Clone("host-1"))
+	assert.True(t, ok)
+	assert.Same(t, unsafe.StringData(a), unsafe.StringData(stored))
+	_, ok = interner.Lookup("host-2")
+	assert.False(t, ok)
+	assert.Equal(t, uint32(1), interner.Size())
+	interner.Clear()
+	assert.Equal(t, uint32(0), interner.Size())
+}
+
+func TestInternerManyValues(t *testing.T) {
+	interner := NewInterner[string](10)
+	first := map[string]*byte{}
+	for round := range 3 {
+		for i := range 1000 {
+			s := strings.Repeat("x", i%50) + strings.Clone(string(rune('a'+i%26)))
+			canonical := interner.Intern(s)
+			if round == 0 && first[s] == nil {
+				first[s] = unsafe.StringData(canonical)
+			}
+			assert.Same(t, first[s], unsafe.StringData(canonical))
+		}
+	}
+	assert.Equal(t, uint32(len(first)), interner.Size()) //nolint:gosec
+}
@@ -0,0 +1,421 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"iter"
+	"math/bits"
+	"math/rand/v2"
+	"os"
+	"unsafe"
+)
+
+/*
+The mapped file format mirrors the in-memory layout of a Set3, so a set can be used directly from a memory mapped file without loading it:
+
+	offset  size            content
+	0       8               magic "SET3MAP\x00"
+	8       4               format version (little endian)
+	12      4               flags (little endian), bit 0 set if the data section is big endian
+	16      4               element size in bytes (little endian)
+	20      4               number of groups (little endian)
+	24      8               number of elements (little endian)
+	32      8               hash seed (little endian)
+	40      8               CRC-64 (ECMA) of the data section (little endian)
+	48      16              reserved, zero
+	64      groups*8        control words (native byte order, see flags)
+	...     groups*8*size   slots, 8 elements per group (native memory representation)
+
+As the hash function of Set3 is seeded randomly per process, the mapped format uses its own stable hash function on the memory representation of the elements.
+*/
+const (
+	mappedMagic         = "SET3MAP\x00"
+	mappedVersion       = 1
+	mappedHeaderSize    = 64
+	mappedFlagBigEndian = 1
+)
+
+var mappedCRCTable = crc64.MakeTable(crc64.ECMA)
+
+// ErrInvalidFormat is returned if a file or a byte sequence does not contain a valid serialized data structure of this package.
+var ErrInvalidFormat = errors.New("set3: invalid format")
+
+// ErrUnsupportedType is returned if a data structure of this package cannot be serialized or deserialized for the given element type.
+var ErrUnsupportedType = errors.New("set3: unsupported element type")
+
+type mappedHeader struct {
+	flags       uint32
+	elementSize uint32
+	numGroups   uint32
+	size        uint64
+	seed        uint64
+	checksum    uint64
+}
+
+func (h *mappedHeader) dataSize() uint64 {
+	return uint64(h.numGroups) * set3groupSize * (1 + uint64(h.elementSize))
+}
+
+func (h *mappedHeader) appendTo(dst []byte) []byte {
+	dst = append(dst, mappedMagic...)
+	dst = binary.LittleEndian.AppendUint32(dst, mappedVersion)
+	dst = binary.LittleEndian.AppendUint32(dst, h.flags)
+	dst = binary.LittleEndian.AppendUint32(dst, h.elementSize)
+	dst = binary.LittleEndian.AppendUint32(dst, h.numGroups)
+	dst = binary.LittleEndian.AppendUint64(dst, h.size)
+	dst = binary.LittleEndian.AppendUint64(dst, h.seed)
+	dst = binary.LittleEndian.AppendUint64(dst, h.checksum)
+	return append(dst, make([]byte, mappedHeaderSize-48)...)
+}
+
+func parseMappedHeader(data []byte) (mappedHeader, error) {
+	var h mappedHeader
+	if len(data) < mappedHeaderSize || string(data[:8]) != mappedMagic {
+		return h, fmt.Errorf("%w: not a mapped Set3 file", ErrInvalidFormat)
+	}
+	if v := binary.LittleEndian.Uint32(data[8:]); v != mappedVersion {
+		return h, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, v)
+	}
+	h.flags = binary.LittleEndian.Uint32(data[12:])
+	h.elementSize = binary.LittleEndian.Uint32(data[16:])
+	h.numGroups = binary.LittleEndian.Uint32(data[20:])
+	h.size = binary.LittleEndian.Uint64(data[24:])
+	h.seed = binary.LittleEndian.Uint64(data[32:])
+	h.checksum = binary.LittleEndian.Uint64(data[40:])
+	return h, nil
+}
+
+func mappedHostFlags() uint32 {
+	if isLittleEndianHost() {
+		return 0
+	}
+	return mappedFlagBigEndian
+}
+
+/*
+WriteMapped writes thisSet in the mapped file format to w (see [OpenMapped]).
+
+T must be a plain data type, i.e., an integer or boolean type, or an array or struct (without padding) of such types. Otherwise, WriteMapped returns an error wrapping [ErrUnsupportedType].
+
+Example:
+
+	set := From[uint64](1, 2, 3)
+	var buf bytes.Buffer
+	err := set.WriteMapped(&buf)
+*/
+func (thisSet *Set3[T]) WriteMapped(w io.Writer) error {
+	elementSize, ok := plainDataSize[T]()
+	if !ok {
+		return fmt.Errorf("%w: %T is not a plain data type", ErrUnsupportedType, *new(T))
+	}
+	size := thisSet.Size()
+	numGroups := calcReqNrOfGroups(size)
+	if calcElementLimit(numGroups, set3maxAvgGroupLoad) < size {
+		numGroups++ // calcReqNrOfGroups rounds to the nearest number of groups
+	}
+	seed := rand.Uint64() //nolint:gosec
+	groupCtrl := make([]uint64, numGroups)
+	groupSlot := make([][set3groupSize]T, numGroups)
+	for i := range groupCtrl {
+		groupCtrl[i] = set3AllEmpty
+	}
+	grpCnt := uint64(numGroups)
+	for e := range thisSet.MutableRange() {
+		hash := stableHash(seed, plainDataBytes(&e, elementSize))
+		H2 := (hash & 0x0000_0000_0000_007f)
+		grpIdx := getGroupIndex(hash, grpCnt)
+		for {
+			matches := set3ctlrMatchEmpty(groupCtrl[grpIdx])
+			if matches != 0 {
+				s := set3nextMatch(&matches)
+				groupCtrl[grpIdx] = setCTRLat(groupCtrl[grpIdx], H2, s)
+				groupSlot[grpIdx][s] = e
+				break
+			}
+			grpIdx++ // carousel through all groups
+			if grpIdx >= grpCnt {
+				grpIdx = 0
+			}
+		}
+	}
+	ctrlBytes := unsafe.Slice((*byte)(unsafe.Pointer(&groupCtrl[0])), len(groupCtrl)*8)
+	slotBytes := unsafe.Slice((*byte)(unsafe.Pointer(&groupSlot[0])), len(groupSlot)*set3groupSize*elementSize)
+	crc := crc64.Update(0, mappedCRCTable, ctrlBytes)
+	crc = crc64.Update(crc, mappedCRCTable, slotBytes)
+	header := mappedHeader{
+		flags:       mappedHostFlags(),
+		elementSize: uint32(elementSize), //nolint:gosec
+		numGroups:   numGroups,
+		size:        uint64(size),
+		seed:        seed,
+		checksum:    crc,
+	}
+	if _, err := w.Write(header.appendTo(nil)); err != nil {
+		return err
+	}
+	if _, err := w.Write(ctrlBytes); err != nil {
+		return err
+	}
+	_, err := w.Write(slotBytes)
+	return err
+}
+
+/*
+WriteMappedFile writes thisSet in the mapped file format to the file with the given path (see [Set3.WriteMapped] and [OpenMapped]).
+An existing file is overwritten.
+
+Example:
+
+	set := From[uint64](1, 2, 3)
+	err := set.WriteMappedFile("blocklist.set3")
+*/
+func (thisSet *Set3[T]) WriteMappedFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+	err = thisSet.WriteMapped(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+MappedSet3 is a read-only set that is backed by a memory mapped file in the format written by [Set3.WriteMapped].
+Opening a MappedSet3 does not load or rehash the elements, [MappedSet3.Contains] probes the mapped file directly.
+A MappedSet3 is safe for concurrent use. Call [MappedSet3.Close] to release the mapping; the set must not be used afterwards.
+*/
+type MappedSet3[T comparable] struct {
+	data        []byte
+	unmap       func() error
+	seed        uint64
+	size        uint32
+	elementSize int
+	groupCtrl   []uint64
+	groupSlot   [][set3groupSize]T
+}
+
+/*
+OpenMapped opens the file with the given path, which must have been written by [Set3.WriteMapped] with the same element type T on a platform with the same byte order.
+The checksum of the file is verified.
+
+Returns an error wrapping [ErrInvalidFormat] if the file is not a valid mapped Set3 file, or [ErrUnsupportedType] if T does not match the file or is not a plain data type.
+
+Example:
+
+	set, err := OpenMapped[uint64]("blocklist.set3")
+	if err != nil {
+		// handle error
+	}
+	defer set.Close()
+	b := set.Contains(42)
+*/
+func OpenMapped[T comparable](path string) (*MappedSet3[T], error) {
+	elementSize, ok := plainDataSize[T]()
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a plain data type", ErrUnsupportedType, *new(T))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < mappedHeaderSize {
+		return nil, fmt.Errorf("%w: file too short", ErrInvalidFormat)
+	}
+	data, unmap, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	result, err := newMappedSet3[T](data, elementSize)
+	if err != nil {
+		_ = unmap()
+		return nil, err
+	}
+	result.unmap = unmap
+	return result, nil
+}
+
+func newMappedSet3[T comparable](data []byte, elementSize int) (*MappedSet3[T], error) {
+	header, err := parseMappedHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if header.flags != mappedHostFlags() {
+		return nil, fmt.Errorf("%w: byte order of file does not match this platform", ErrInvalidFormat)
+	}
+	if header.elementSize != uint32(elementSize) { //nolint:gosec
+		return nil, fmt.Errorf("%w: file contains elements of %d bytes, %T has %d bytes", ErrUnsupportedType, header.elementSize, *new(T), elementSize)
+	}
+	if header.numGroups == 0 || uint64(len(data)) != mappedHeaderSize+header.dataSize() {
+		return nil, fmt.Errorf("%w: file size does not match header", ErrInvalidFormat)
+	}
+	if header.size > uint64(calcElementLimit(header.numGroups, set3maxAvgGroupLoad)) {
+		return nil, fmt.Errorf("%w: too many elements for %d groups", ErrInvalidFormat, header.numGroups)
+	}
+	if crc64.Checksum(data[mappedHeaderSize:], mappedCRCTable) != header.checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidFormat)
+	}
+	numGroups := int(header.numGroups)
+	slotOffset := mappedHeaderSize + numGroups*8
+	groupCtrl := unsafe.Slice((*uint64)(unsafe.Pointer(&data[mappedHeaderSize])), numGroups)
+	if err := validateMappedCtrl(groupCtrl, header.size); err != nil {
+		return nil, err
+	}
+	return &MappedSet3[T]{
+		data:        data,
+		seed:        header.seed,
+		size:        uint32(header.size), //nolint:gosec
+		elementSize: elementSize,
+		groupCtrl:   groupCtrl,
+		groupSlot:   unsafe.Slice((*[set3groupSize]T)(unsafe.Pointer(&data[slotOffset])), numGroups),
+	}, nil
+}
+
+// validateMappedCtrl checks that the control words hold exactly size elements and at least one empty slot.
+// The checksum does not protect against crafted files, and without an empty slot every unsuccessful probe would loop forever.
+func validateMappedCtrl(groupCtrl []uint64, size uint64) error {
+	live := uint64(0)
+	hasEmpty := false
+	for _, ctrl := range groupCtrl {
+		// the high bit of a control byte is set for empty and deleted slots
+		live += uint64(set3groupSize - bits.OnesCount64(ctrl&set3hiBits))
+		if set3ctlrMatchEmpty(ctrl) != 0 {
+			hasEmpty = true
+		}
+	}
+	if live != size {
+		return fmt.Errorf("%w: control words hold %d elements, header says %d", ErrInvalidFormat, live, size)
+	}
+	if !hasEmpty {
+		return fmt.Errorf("%w: no empty slot", ErrInvalidFormat)
+	}
+	return nil
+}
+
+/*
+Close releases the memory mapping of thisSet. thisSet must not be used after Close.
+*/
+func (thisSet *MappedSet3[T]) Close() error {
+	thisSet.groupCtrl, thisSet.groupSlot, thisSet.data = nil, nil, nil
+	if thisSet.unmap == nil {
+		return nil
+	}
+	unmap := thisSet.unmap
+	thisSet.unmap = nil
+	return unmap()
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *MappedSet3[T]) Size() uint32 {
+	return thisSet.size
+}
+
+/*
+Contains returns true if the element is contained in thisSet.
+
+Example:
+
+	set, _ := OpenMapped[uint64]("blocklist.set3")
+	b := set.Contains(42)
+*/
+func (thisSet *MappedSet3[T]) Contains(element T) bool {
+	hash := stableHash(thisSet.seed, plainDataBytes(&element, thisSet.elementSize))
+	H2 := (hash & 0x0000_0000_0000_007f)
+	groupCount := uint64(len(thisSet.groupCtrl))
+	currentGroupIndex := getGroupIndex(hash, groupCount)
+	for {
+		ctrl := thisSet.groupCtrl[currentGroupIndex]
+		H2matches := set3ctlrMatchH2(ctrl, H2)
+		if H2matches != 0 {
+			slot := &(thisSet.groupSlot[currentGroupIndex])
+			for H2matches != 0 {
+				s := set3nextMatch(&H2matches)
+				if element == slot[s] {
+					return true
+				}
+			}
+		}
+		if set3ctlrMatchEmpty(ctrl) != 0 {
+			return false
+		}
+		currentGroupIndex++ // carousel through all groups
+		if currentGroupIndex >= groupCount {
+			currentGroupIndex = 0
+		}
+	}
+}
+
+/*
+ImmutableRange iterates over all elements in thisSet. As thisSet cannot be changed, no internal copy is required.
+
+Example:
+
+	for elem := range set.ImmutableRange() {
+		// do something with elem...
+	}
+*/
+func (thisSet *MappedSet3[T]) ImmutableRange() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i, ctrl := range thisSet.groupCtrl {
+			if ctrl&set3hiBits != set3hiBits { // not all empty or deleted
+				slot := &(thisSet.groupSlot[i])
+				for i := 0; i < set3groupSize; i++ {
+					if isAnElementAt(ctrl, i) {
+						if !yield(slot[i]) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+/*
+ToSet3 loads all elements of thisSet into a new Set3 on the heap.
+
+Example:
+
+	mapped, _ := OpenMapped[uint64]("blocklist.set3")
+	set := mapped.ToSet3() // set can be modified
+*/
+func (thisSet *MappedSet3[T]) ToSet3() *Set3[T] {
+	result := EmptyWithCapacity[T](thisSet.size)
+	for e := range thisSet.ImmutableRange() {
+		result.Add(e)
+	}
+	return result
+}
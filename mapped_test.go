@@ -0,0 +1,163 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 100, 10_000, 100_000} {
+		data := generateInt64Data(n)
+		set := FromArray(data)
+		path := filepath.Join(t.TempDir(), "set.set3")
+		require.NoError(t, set.WriteMappedFile(path))
+
+		mapped, err := OpenMapped[int64](path)
+		require.NoError(t, err)
+		assert.Equal(t, set.Size(), mapped.Size())
+		for _, e := range data {
+			assert.True(t, mapped.Contains(e), "mapped set shall contain %v", e)
+		}
+		for _, e := range data {
+			assert.False(t, mapped.Contains(-e-1), "mapped set shall not contain %v", -e-1)
+		}
+		assert.True(t, set.Equals(mapped.ToSet3()))
+		count := 0
+		for e := range mapped.ImmutableRange() {
+			assert.True(t, set.Contains(e))
+			count++
+		}
+		assert.Equal(t, n, count)
+		require.NoError(t, mapped.Close())
+		require.NoError(t, mapped.Close(), "closing twice shall not fail")
+	}
+}
+
+type mappedTestKey struct {
+	A uint32
+	B [4]uint8
+	C int64
+}
+
+func TestMappedStruct(t *testing.T) {
+	set := Empty[mappedTestKey]()
+	for i := range 1000 {
+		set.Add(mappedTestKey{A: uint32(i), B: [4]uint8{1, 2, 3, uint8(i)}, C: int64(-i)})
+	}
+	path := filepath.Join(t.TempDir(), "struct.set3")
+	require.NoError(t, set.WriteMappedFile(path))
+	mapped, err := OpenMapped[mappedTestKey](path)
+	require.NoError(t, err)
+	defer mapped.Close()
+	for e := range set.MutableRange() {
+		assert.True(t, mapped.Contains(e))
+	}
+	assert.False(t, mapped.Contains(mappedTestKey{A: 1}))
+}
+
+func TestMappedUnsupportedType(t *testing.T) {
+	var buf bytes.Buffer
+	err := From("a", "b").WriteMapped(&buf)
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "strings contain pointers")
+	err = From(1.0, 2.0).WriteMapped(&buf)
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "floats cannot be compared bitwise")
+	type padded struct {
+		A uint8
+		B uint64
+	}
+	err = From(padded{1, 2}).WriteMapped(&buf)
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "padding bytes cannot be hashed")
+	assert.Equal(t, 0, buf.Len())
+
+	path := filepath.Join(t.TempDir(), "int32.set3")
+	require.NoError(t, From[int32](1, 2, 3).WriteMappedFile(path))
+	_, err = OpenMapped[int64](path)
+	assert.True(t, errors.Is(err, ErrUnsupportedType), "element size shall be checked")
+	_, err = OpenMapped[string](path)
+	assert.True(t, errors.Is(err, ErrUnsupportedType))
+}
+
+func TestMappedCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "set.set3")
+	require.NoError(t, FromArray(generateInt64Data(1000)).WriteMappedFile(path))
+	valid, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	corrupt := func(name string, modify func([]byte) []byte) {
+		data := modify(bytes.Clone(valid))
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, data, 0o600))
+		_, err := OpenMapped[int64](p)
+		assert.True(t, errors.Is(err, ErrInvalidFormat), "%s: expected ErrInvalidFormat, got %v", name, err)
+	}
+	corrupt("magic", func(b []byte) []byte { b[0] = 'X'; return b })
+	corrupt("version", func(b []byte) []byte { b[8] = 99; return b })
+	corrupt("truncated", func(b []byte) []byte { return b[:len(b)-1] })
+	corrupt("header only", func(b []byte) []byte { return b[:mappedHeaderSize-1] })
+	corrupt("payload", func(b []byte) []byte { b[len(b)-1] ^= 0xFF; return b })
+	corrupt("groups", func(b []byte) []byte { b[20]++; return b })
+
+	// crafted files with a valid checksum
+	numGroups := int(binary.LittleEndian.Uint32(valid[20:]))
+	recrc := func(b []byte) []byte {
+		binary.LittleEndian.PutUint64(b[40:], crc64.Checksum(b[mappedHeaderSize:], mappedCRCTable))
+		return b
+	}
+	corrupt("size", func(b []byte) []byte {
+		binary.LittleEndian.PutUint64(b[24:], binary.LittleEndian.Uint64(b[24:])-1)
+		return recrc(b)
+	})
+	corrupt("no empty slot", func(b []byte) []byte {
+		for i := mappedHeaderSize; i < mappedHeaderSize+numGroups*8; i++ {
+			if b[i] == byte(set3Empty) {
+				b[i] = byte(set3Deleted)
+			}
+		}
+		return recrc(b)
+	})
+	corrupt("all slots used", func(b []byte) []byte {
+		for i := mappedHeaderSize; i < mappedHeaderSize+numGroups*8; i++ {
+			b[i] = 0x01
+		}
+		return recrc(b)
+	})
+
+	_, err = OpenMapped[int64](filepath.Join(dir, "does not exist"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestMappedDeterministicLayout(t *testing.T) {
+	// the layout only depends on the seed and the elements, not on the hash seed of the Set3
+	set := FromArray(generateInt64Data(500))
+	var buf bytes.Buffer
+	require.NoError(t, set.WriteMapped(&buf))
+	mapped, err := newMappedSet3[int64](buf.Bytes(), 8)
+	require.NoError(t, err)
+	set.Rehash()
+	for e := range set.MutableRange() {
+		assert.True(t, mapped.Contains(e))
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"math"
+)
+
+/*
+MinHashSignature is a compact summary of a set, computed by a [MinHasher]. The fraction of equal components of two signatures
+is an unbiased estimate of the Jaccard similarity of the underlying sets.
+*/
+type MinHashSignature []uint64
+
+/*
+Similarity returns the estimated Jaccard similarity of the sets of thisSignature and thatSignature.
+Both signatures must have been computed by the same [MinHasher]. Panics if the signatures have different lengths.
+*/
+func (thisSignature MinHashSignature) Similarity(thatSignature MinHashSignature) float64 {
+	if len(thisSignature) != len(thatSignature) {
+		panic(fmt.Sprintf("set3: signatures have different lengths %d and %d", len(thisSignature), len(thatSignature)))
+	}
+	if len(thisSignature) == 0 {
+		return 1
+	}
+	equal := 0
+	for i, v := range thisSignature {
+		if v == thatSignature[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(thisSignature))
+}
+
+/*
+MinHasher computes [MinHashSignature]s of sets with k hash functions. The standard error of the estimated similarity is about 1/sqrt(k).
+Signatures are only comparable if they have been computed by MinHashers with the same k and seed.
+For plain data types and string types, the signatures are the same in every process.
+*/
+type MinHasher[T comparable] struct {
+	hasher sketchHasher[T]
+	seeds  []uint64
+}
+
+/*
+NewMinHasher creates a new MinHasher with k hash functions derived from seed. Panics if k is not positive.
+
+Example:
+
+	minHasher := NewMinHasher[string](128, 42)
+	signature := minHasher.Signature(tokens)
+*/
+func NewMinHasher[T comparable](k int, seed uint64) *MinHasher[T] {
+	if k <= 0 {
+		panic(fmt.Sprintf("set3: number of hash functions must be positive, got %d", k))
+	}
+	seeds := make([]uint64, k)
+	for i := range seeds {
+		// splitmix64 sequence
+		seed += stablePrime1
+		seeds[i] = stableFinalize(seed)
+	}
+	return &MinHasher[T]{hasher: newSketchHasher[T](), seeds: seeds}
+}
+
+// NumHashes returns the number of hash functions of thisMinHasher, i.e., the length of its signatures.
+func (thisMinHasher *MinHasher[T]) NumHashes() int {
+	return len(thisMinHasher.seeds)
+}
+
+/*
+Signature computes the MinHashSignature of set. nil is interpreted as empty set.
+*/
+func (thisMinHasher *MinHasher[T]) Signature(set *Set3[T]) MinHashSignature {
+	result := make(MinHashSignature, len(thisMinHasher.seeds))
+	for i := range result {
+		result[i] = math.MaxUint64
+	}
+	if set == nil {
+		return result
+	}
+	for e := range set.MutableRange() {
+		h := thisMinHasher.hasher.hash(e, 0)
+		for i, seed := range thisMinHasher.seeds {
+			result[i] = min(result[i], stableFinalize(h^seed))
+		}
+	}
+	return result
+}
+
+/*
+LSHPair is a pair of keys returned by [LSHIndex.CandidatePairs] along with the estimated similarity of their sets.
+*/
+type LSHPair[K comparable] struct {
+	A, B       K
+	Similarity float64
+}
+
+/*
+LSHIndex finds pairs of similar sets among many sets without comparing every pair (locality sensitive hashing).
+The signatures are split into bands of rows; two sets become candidates if their signatures agree in all rows of at least one band.
+The number of bands and rows is chosen such that pairs with a similarity above the threshold are very likely to become candidates.
+*/
+type LSHIndex[K comparable] struct {
+	threshold  float64
+	numHashes  int
+	bands      int
+	rows       int
+	keys       []K
+	signatures []MinHashSignature
+	buckets    []map[uint64][]uint32 // per band: hash of the rows -> indices of keys
+}
+
+/*
+NewLSHIndex creates a new and empty LSHIndex for signatures with numHashes components that finds pairs with a similarity of at least threshold.
+Panics if numHashes is not positive or threshold is not in (0,1].
+
+Example:
+
+	minHasher := NewMinHasher[string](128, 42)
+	index := NewLSHIndex[int](minHasher.NumHashes(), 0.8)
+	for id, tokens := range documents {
+		index.Add(id, minHasher.Signature(tokens))
+	}
+	for _, pair := range index.CandidatePairs() {
+		// pair.A and pair.B are near duplicates
+	}
+*/
+func NewLSHIndex[K comparable](numHashes int, threshold float64) *LSHIndex[K] {
+	if numHashes <= 0 {
+		panic(fmt.Sprintf("set3: number of hash functions must be positive, got %d", numHashes))
+	}
+	if !(threshold > 0 && threshold <= 1) {
+		panic(fmt.Sprintf("set3: threshold must be in (0,1], got %v", threshold))
+	}
+	bands, rows := lshBands(numHashes, threshold)
+	buckets := make([]map[uint64][]uint32, bands)
+	for i := range buckets {
+		buckets[i] = make(map[uint64][]uint32)
+	}
+	return &LSHIndex[K]{threshold: threshold, numHashes: numHashes, bands: bands, rows: rows, buckets: buckets}
+}
+
+// lshBands chooses the number of bands and rows such that the similarity (1/bands)^(1/rows),
+// at which the probability to become a candidate rises steeply, is just below threshold.
+func lshBands(numHashes int, threshold float64) (bands, rows int) {
+	bands, rows = numHashes, 1
+	best := math.Inf(1)
+	for r := 1; r <= numHashes; r++ {
+		b := numHashes / r
+		s := math.Pow(1/float64(b), 1/float64(r))
+		if s <= threshold && threshold-s < best {
+			best = threshold - s
+			bands, rows = b, r
+		}
+	}
+	return bands, rows
+}
+
+// Bands returns the number of bands and rows per band of thisIndex.
+func (thisIndex *LSHIndex[K]) Bands() (bands, rows int) {
+	return thisIndex.bands, thisIndex.rows
+}
+
+/*
+Add adds the signature of the set identified by key to thisIndex. Panics if the length of the signature differs from the numHashes thisIndex has been created with.
+*/
+func (thisIndex *LSHIndex[K]) Add(key K, signature MinHashSignature) {
+	thisIndex.checkSignature(signature)
+	id := uint32(len(thisIndex.keys)) //nolint:gosec
+	thisIndex.keys = append(thisIndex.keys, key)
+	thisIndex.signatures = append(thisIndex.signatures, signature)
+	for band, buckets := range thisIndex.buckets {
+		h := thisIndex.bandHash(signature, band)
+		buckets[h] = append(buckets[h], id)
+	}
+}
+
+func (thisIndex *LSHIndex[K]) checkSignature(signature MinHashSignature) {
+	if len(signature) != thisIndex.numHashes {
+		panic(fmt.Sprintf("set3: signature has %d components, need %d", len(signature), thisIndex.numHashes))
+	}
+}
+
+func (thisIndex *LSHIndex[K]) bandHash(signature MinHashSignature, band int) uint64 {
+	h := uint64(band)
+	for _, v := range signature[band*thisIndex.rows : (band+1)*thisIndex.rows] {
+		h = stableMix(h, v)
+	}
+	return stableFinalize(h)
+}
+
+/*
+Query returns the keys of all sets in thisIndex that share at least one band with signature and have an estimated similarity of at least the threshold.
+Panics if the length of the signature differs from the numHashes thisIndex has been created with.
+*/
+func (thisIndex *LSHIndex[K]) Query(signature MinHashSignature) []K {
+	thisIndex.checkSignature(signature)
+	seen := Empty[uint32]()
+	var result []K
+	for band, buckets := range thisIndex.buckets {
+		for _, id := range buckets[thisIndex.bandHash(signature, band)] {
+			if seen.Contains(id) {
+				continue
+			}
+			seen.Add(id)
+			if thisIndex.signatures[id].Similarity(signature) >= thisIndex.threshold {
+				result = append(result, thisIndex.keys[id])
+			}
+		}
+	}
+	return result
+}
+
+/*
+CandidatePairs returns all pairs of sets in thisIndex that share at least one band and have an estimated similarity of at least the threshold.
+Every pair is returned once, with A added before B.
+*/
+func (thisIndex *LSHIndex[K]) CandidatePairs() []LSHPair[K] {
+	seen := Empty[uint64]()
+	var result []LSHPair[K]
+	for _, buckets := range thisIndex.buckets {
+		for _, ids := range buckets {
+			for i, a := range ids {
+				for _, b := range ids[i+1:] {
+					pairID := uint64(a)<<32 | uint64(b)
+					if seen.Contains(pairID) {
+						continue
+					}
+					seen.Add(pairID)
+					similarity := thisIndex.signatures[a].Similarity(thisIndex.signatures[b])
+					if similarity >= thisIndex.threshold {
+						result = append(result, LSHPair[K]{A: thisIndex.keys[a], B: thisIndex.keys[b], Similarity: similarity})
+					}
+				}
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenSet returns a set of n tokens, of which the first shared tokens are shared by all sets with the same prefix.
+func tokenSet(prefix string, shared int, unique string, n int) *Set3[string] {
+	result := EmptyWithCapacity[string](uint32(n)) //nolint:gosec
+	for i := range shared {
+		result.Add(fmt.Sprintf("%s-%d", prefix, i))
+	}
+	for i := shared; i < n; i++ {
+		result.Add(fmt.Sprintf("%s-%s-%d", prefix, unique, i))
+	}
+	return result
+}
+
+func TestMinHashSimilarity(t *testing.T) {
+	minHasher := NewMinHasher[string](256, 1)
+	assert.Equal(t, 256, minHasher.NumHashes())
+	for _, shared := range []int{0, 200, 500, 800, 1000} {
+		a := tokenSet("doc", shared, "a", 1000)
+		b := tokenSet("doc", shared, "b", 1000)
+		exact := Jaccard(a, b)
+		estimate := minHasher.Signature(a).Similarity(minHasher.Signature(b))
+		assert.InDelta(t, exact, estimate, 3/math.Sqrt(256), "shared %d", shared)
+	}
+	empty := minHasher.Signature(nil)
+	assert.InDelta(t, 1.0, empty.Similarity(minHasher.Signature(Empty[string]())), 1e-12)
+	assert.Panics(t, func() { empty.Similarity(empty[:10]) })
+	assert.PanicsWithValue(t, "set3: number of hash functions must be positive, got 0", func() { NewMinHasher[string](0, 1) })
+}
+
+func TestMinHashDeterministic(t *testing.T) {
+	set := From[uint64](1, 2, 3, 4, 5)
+	s1 := NewMinHasher[uint64](16, 7).Signature(set)
+	s2 := NewMinHasher[uint64](16, 7).Signature(set)
+	s3 := NewMinHasher[uint64](16, 8).Signature(set)
+	assert.Equal(t, s1, s2, "signatures with the same seed shall be equal")
+	assert.NotEqual(t, s1, s3, "signatures with different seeds shall differ")
+}
+
+func TestLSHBands(t *testing.T) {
+	for _, tc := range []struct {
+		numHashes int
+		threshold float64
+	}{{128, 0.8}, {128, 0.5}, {100, 0.9}, {16, 0.3}, {2, 0.5}} {
+		index := NewLSHIndex[int](tc.numHashes, tc.threshold)
+		bands, rows := index.Bands()
+		assert.LessOrEqual(t, bands*rows, tc.numHashes)
+		assert.LessOrEqual(t, math.Pow(1/float64(bands), 1/float64(rows)), tc.threshold)
+	}
+	assert.Panics(t, func() { NewLSHIndex[int](0, 0.5) })
+	assert.Panics(t, func() { NewLSHIndex[int](10, 0) })
+	assert.Panics(t, func() { NewLSHIndex[int](10, 1.1) })
+}
+
+func TestLSHIndexCandidatePairs(t *testing.T) {
+	minHasher := NewMinHasher[string](128, 42)
+	index := NewLSHIndex[int](minHasher.NumHashes(), 0.8)
+	rng := rand.New(rand.NewPCG(1, 2)) //nolint:gosec
+	documents := make(map[int]*Set3[string])
+	// documents 2i and 2i+1 are near duplicates for i < 10, all others are unrelated
+	for id := range 200 {
+		var doc *Set3[string]
+		if id < 20 {
+			doc = tokenSet(fmt.Sprintf("dup%d", id/2), 190, fmt.Sprint(id), 200)
+		} else {
+			doc = tokenSet(fmt.Sprintf("doc%d", id), 0, fmt.Sprint(rng.Int()), 200)
+		}
+		documents[id] = doc
+		index.Add(id, minHasher.Signature(doc))
+	}
+	pairs := index.CandidatePairs()
+	found := Empty[[2]int]()
+	for _, pair := range pairs {
+		assert.Less(t, pair.A, pair.B, "pairs shall be ordered by insertion")
+		assert.GreaterOrEqual(t, pair.Similarity, 0.8)
+		found.Add([2]int{pair.A, pair.B})
+	}
+	expected := Empty[[2]int]()
+	for i := range 10 {
+		expected.Add([2]int{2 * i, 2*i + 1})
+	}
+	assert.True(t, expected.Equals(found), "expected %v, found %v", expected, found)
+
+	query := index.Query(minHasher.Signature(documents[4]))
+	assert.ElementsMatch(t, []int{4, 5}, query)
+	require.Panics(t, func() { index.Query(MinHashSignature{1, 2}) })
+	require.Panics(t, func() { index.Add(1000, MinHashSignature{1, 2}) })
+}
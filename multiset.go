@@ -0,0 +1,417 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/dolthub/maphash"
+)
+
+/*
+MultiSet3 is a multiset (bag) that counts the occurrences of its elements, like a map[T]uint64 that drops entries when their count drops to zero.
+It uses the same Swiss table layout as Set3 with a parallel array of counts per group, so lookups and updates are as fast as for a Set3.
+*/
+type MultiSet3[T comparable] struct {
+	set3table
+	hashFunction maphash.Hasher[T]
+	total        uint64
+	groupSlot    [][set3groupSize]T
+	groupCount   [][set3groupSize]uint64
+}
+
+/*
+MultiSetEntry is an element of a [MultiSet3] along with its number of occurrences.
+*/
+type MultiSetEntry[T comparable] struct {
+	Element T
+	Count   uint64
+}
+
+/*
+EmptyMultiSet3 creates a new and empty MultiSet3 with a reasonable default initial capacity.
+
+Example:
+
+	bag := EmptyMultiSet3[string]()
+	bag.Add("error", 1)
+*/
+func EmptyMultiSet3[T comparable]() *MultiSet3[T] {
+	return EmptyMultiSet3WithCapacity[T](21)
+}
+
+/*
+EmptyMultiSet3WithCapacity creates a new and empty MultiSet3 that can hold initialCapacity distinct elements without being reorganized.
+
+Example:
+
+	bag := EmptyMultiSet3WithCapacity[string](1000)
+*/
+func EmptyMultiSet3WithCapacity[T comparable](initialCapacity uint32) *MultiSet3[T] {
+	result := &MultiSet3[T]{hashFunction: maphash.NewHasher[T]()}
+	result.allocate(calcReqNrOfGroups(initialCapacity))
+	return result
+}
+
+/*
+MultiSet3From creates a new MultiSet3 that contains every argument as often as it is passed.
+
+Example:
+
+	bag := MultiSet3From("a", "b", "a") // "a" will be counted twice
+*/
+func MultiSet3From[T comparable](args ...T) *MultiSet3[T] {
+	return MultiSet3FromArray(args)
+}
+
+/*
+MultiSet3FromArray creates a new MultiSet3 that counts the elements of data.
+
+Example:
+
+	bag := MultiSet3FromArray([]string{"a", "b", "a"}) // "a" will be counted twice
+*/
+func MultiSet3FromArray[T comparable](data []T) *MultiSet3[T] {
+	result := EmptyMultiSet3[T]()
+	for _, e := range data {
+		result.Add(e, 1)
+	}
+	return result
+}
+
+func (thisSet *MultiSet3[T]) allocate(numGroups uint32) {
+	thisSet.set3table.allocate(numGroups)
+	thisSet.groupSlot = make([][set3groupSize]T, numGroups)
+	thisSet.groupCount = make([][set3groupSize]uint64, numGroups)
+}
+
+/*
+Returns a string representation of the elements of thisSet and their counts, e.g. "{a:2,b:1}". The order of the elements in the result is arbitrary.
+*/
+func (thisSet *MultiSet3[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	entries := func(yield func(MultiSetEntry[T]) bool) {
+		for e, count := range thisSet.All() {
+			if !yield(MultiSetEntry[T]{e, count}) {
+				return
+			}
+		}
+	}
+	return set3roster(entries, func(entry MultiSetEntry[T]) string {
+		return fmt.Sprintf("%v:%d", entry.Element, entry.Count)
+	})
+}
+
+/*
+Size returns the total number of occurrences of all elements in thisSet, i.e., the sum of all counts.
+*/
+func (thisSet *MultiSet3[T]) Size() uint64 {
+	return thisSet.total
+}
+
+/*
+DistinctSize returns the number of distinct elements in thisSet.
+*/
+func (thisSet *MultiSet3[T]) DistinctSize() uint32 {
+	return thisSet.size()
+}
+
+func (thisSet *MultiSet3[T]) find(element T) (uint64, int, bool) {
+	return thisSet.probe(thisSet.hashFunction.Hash(element), func(g uint64, s int) bool {
+		return element == thisSet.groupSlot[g][s]
+	})
+}
+
+/*
+Count returns the number of occurrences of the element in thisSet, or 0 if the element is not in thisSet.
+*/
+func (thisSet *MultiSet3[T]) Count(element T) uint64 {
+	g, s, found := thisSet.find(element)
+	if !found {
+		return 0
+	}
+	return thisSet.groupCount[g][s]
+}
+
+/*
+Contains returns true if the element occurs at least once in thisSet.
+*/
+func (thisSet *MultiSet3[T]) Contains(element T) bool {
+	_, _, found := thisSet.find(element)
+	return found
+}
+
+/*
+Add adds n occurrences of the element to thisSet. Adding 0 occurrences does nothing.
+
+Example:
+
+	bag := EmptyMultiSet3[string]()
+	bag.Add("a", 2)
+	bag.Add("a", 1) // bag.Count("a") will be 3
+*/
+func (thisSet *MultiSet3[T]) Add(element T, n uint64) {
+	if n == 0 {
+		return
+	}
+	if g, s, found := thisSet.find(element); found {
+		thisSet.groupCount[g][s] += n
+		thisSet.total += n
+		return
+	}
+	if thisSet.full() {
+		thisSet.rehashToNumGroups(thisSet.nextGroupCount())
+	}
+	thisSet.insertNew(element, n)
+	thisSet.total += n
+}
+
+// insertNew stores an element that is known not to be in thisSet in the first empty slot of its probe sequence.
+func (thisSet *MultiSet3[T]) insertNew(element T, n uint64) {
+	g, s := thisSet.claim(thisSet.hashFunction.Hash(element))
+	thisSet.groupSlot[g][s] = element
+	thisSet.groupCount[g][s] = n
+}
+
+/*
+Remove removes up to n occurrences of the element from thisSet and returns the number of removed occurrences.
+The element is removed completely once its count drops to zero.
+
+Example:
+
+	bag := MultiSet3From("a", "a", "a")
+	removed := bag.Remove("a", 2) // removed will be 2, bag.Count("a") will be 1
+	removed = bag.Remove("a", 5)  // removed will be 1, bag will be empty
+*/
+func (thisSet *MultiSet3[T]) Remove(element T, n uint64) uint64 {
+	g, s, found := thisSet.find(element)
+	if !found || n == 0 {
+		return 0
+	}
+	count := thisSet.groupCount[g][s]
+	if n < count {
+		thisSet.groupCount[g][s] -= n
+		thisSet.total -= n
+		return n
+	}
+	thisSet.release(g, s)
+	var k T
+	thisSet.groupSlot[g][s] = k
+	thisSet.groupCount[g][s] = 0
+	thisSet.total -= count
+	return count
+}
+
+/*
+Clear removes all elements from thisSet.
+*/
+func (thisSet *MultiSet3[T]) Clear() {
+	clear(thisSet.groupSlot)
+	clear(thisSet.groupCount)
+	thisSet.reset()
+	thisSet.total = 0
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *MultiSet3[T]) Clone() *MultiSet3[T] {
+	return &MultiSet3[T]{
+		set3table:    thisSet.clone(),
+		hashFunction: thisSet.hashFunction,
+		total:        thisSet.total,
+		groupSlot:    slices.Clone(thisSet.groupSlot),
+		groupCount:   slices.Clone(thisSet.groupCount),
+	}
+}
+
+func (thisSet *MultiSet3[T]) rehashToNumGroups(newNumGroups uint32) {
+	oldTable, oldGroupSlot, oldGroupCount := thisSet.set3table, thisSet.groupSlot, thisSet.groupCount
+	thisSet.hashFunction = maphash.NewSeed(thisSet.hashFunction)
+	thisSet.allocate(newNumGroups)
+	for g, s := range oldTable.slots() {
+		thisSet.insertNew(oldGroupSlot[g][s], oldGroupCount[g][s])
+	}
+}
+
+/*
+All iterates over all distinct elements in thisSet along with their counts, in arbitrary order.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable.
+
+Example:
+
+	for element, count := range bag.All() {
+		fmt.Println(element, count)
+	}
+*/
+func (thisSet *MultiSet3[T]) All() iter.Seq2[T, uint64] {
+	return func(yield func(T, uint64) bool) {
+		for g, s := range thisSet.slots() {
+			if !yield(thisSet.groupSlot[g][s], thisSet.groupCount[g][s]) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Distinct creates a new Set3 containing the distinct elements of thisSet.
+
+Example:
+
+	bag := MultiSet3From("a", "b", "a")
+	set := bag.Distinct() // set will contain "a" and "b"
+*/
+func (thisSet *MultiSet3[T]) Distinct() *Set3[T] {
+	result := EmptyWithCapacity[T](thisSet.DistinctSize())
+	for e := range thisSet.All() {
+		result.Add(e)
+	}
+	return result
+}
+
+/*
+MostCommon returns the k elements with the highest counts, ordered by descending count. The order of elements with the same count is arbitrary.
+If thisSet contains less than k distinct elements, all elements are returned.
+
+Example:
+
+	bag := MultiSet3From("a", "b", "a", "c", "a", "b")
+	top := bag.MostCommon(2) // top will be [{a 3} {b 2}]
+*/
+func (thisSet *MultiSet3[T]) MostCommon(k int) []MultiSetEntry[T] {
+	if k <= 0 {
+		return nil
+	}
+	result := make([]MultiSetEntry[T], 0, thisSet.DistinctSize())
+	for e, count := range thisSet.All() {
+		result = append(result, MultiSetEntry[T]{Element: e, Count: count})
+	}
+	slices.SortFunc(result, func(a, b MultiSetEntry[T]) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	return result[:min(k, len(result))]
+}
+
+/*
+Returns true if thisSet and thatSet contain the same elements with the same counts. If thatSet is nil, Equals returns true if and only if thisSet is empty.
+*/
+func (thisSet *MultiSet3[T]) Equals(thatSet *MultiSet3[T]) bool {
+	if thatSet == nil {
+		return thisSet.total == 0
+	}
+	if thisSet.total != thatSet.total || thisSet.DistinctSize() != thatSet.DistinctSize() {
+		return false
+	}
+	for e, count := range thatSet.All() {
+		if thisSet.Count(e) != count {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Union creates a new MultiSet3 in which every element occurs as often as in thisSet or thatSet, whichever is more (maximum of the counts).
+If thatSet is nil, Union returns a clone of thisSet.
+
+Example:
+
+	a := MultiSet3From("x", "x", "y")
+	b := MultiSet3From("x", "y", "y", "z")
+	u := a.Union(b) // u will contain x:2, y:2, z:1
+*/
+func (thisSet *MultiSet3[T]) Union(thatSet *MultiSet3[T]) *MultiSet3[T] {
+	result := thisSet.Clone()
+	if thatSet != nil {
+		for e, count := range thatSet.All() {
+			if own := result.Count(e); count > own {
+				result.Add(e, count-own)
+			}
+		}
+	}
+	return result
+}
+
+/*
+Intersect creates a new MultiSet3 in which every element occurs as often as in thisSet or thatSet, whichever is less (minimum of the counts).
+If thatSet is nil, Intersect returns an empty MultiSet3.
+
+Example:
+
+	a := MultiSet3From("x", "x", "y")
+	b := MultiSet3From("x", "y", "y", "z")
+	i := a.Intersect(b) // i will contain x:1, y:1
+*/
+func (thisSet *MultiSet3[T]) Intersect(thatSet *MultiSet3[T]) *MultiSet3[T] {
+	if thatSet == nil {
+		return EmptyMultiSet3[T]()
+	}
+	smallerSet, biggerSet := thisSet, thatSet
+	if thatSet.DistinctSize() < thisSet.DistinctSize() {
+		smallerSet, biggerSet = thatSet, thisSet
+	}
+	result := EmptyMultiSet3WithCapacity[T](smallerSet.DistinctSize())
+	for e, count := range smallerSet.All() {
+		result.Add(e, min(count, biggerSet.Count(e)))
+	}
+	return result
+}
+
+/*
+Sum creates a new MultiSet3 in which every element occurs as often as in thisSet and thatSet together (sum of the counts).
+If thatSet is nil, Sum returns a clone of thisSet.
+
+Example:
+
+	a := MultiSet3From("x", "x", "y")
+	b := MultiSet3From("x", "y", "y", "z")
+	s := a.Sum(b) // s will contain x:3, y:3, z:1
+*/
+func (thisSet *MultiSet3[T]) Sum(thatSet *MultiSet3[T]) *MultiSet3[T] {
+	result := thisSet.Clone()
+	if thatSet != nil {
+		for e, count := range thatSet.All() {
+			result.Add(e, count)
+		}
+	}
+	return result
+}
+
+/*
+Subtract creates a new MultiSet3 in which the counts of thatSet are subtracted from the counts of thisSet. Elements whose count drops to zero or below are removed.
+If thatSet is nil, Subtract returns a clone of thisSet.
+
+Example:
+
+	a := MultiSet3From("x", "x", "y")
+	b := MultiSet3From("x", "y", "y", "z")
+	d := a.Subtract(b) // d will contain x:1
+*/
+func (thisSet *MultiSet3[T]) Subtract(thatSet *MultiSet3[T]) *MultiSet3[T] {
+	result := thisSet.Clone()
+	if thatSet != nil {
+		for e, count := range thatSet.All() {
+			result.Remove(e, count)
+		}
+	}
+	return result
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertMultiSetEqualsMap[T comparable](t *testing.T, expected map[T]uint64, bag *MultiSet3[T]) {
+	t.Helper()
+	total := uint64(0)
+	for e, count := range expected {
+		assert.Equal(t, count, bag.Count(e), "count of %v", e)
+		total += count
+	}
+	assert.Equal(t, total, bag.Size())
+	assert.Equal(t, uint32(len(expected)), bag.DistinctSize()) //nolint:gosec
+	for e, count := range bag.All() {
+		assert.Equal(t, expected[e], count)
+	}
+}
+
+func TestMultiSetMatchesMap(t *testing.T) {
+	rng := rand.New(rand.NewPCG(9, 10)) //nolint:gosec
+	bag := EmptyMultiSet3[int]()
+	expected := make(map[int]uint64)
+	for range 100_000 {
+		e := rng.IntN(5000)
+		n := uint64(rng.IntN(4)) //nolint:gosec
+		if rng.IntN(3) == 0 {
+			removed := bag.Remove(e, n)
+			assert.Equal(t, min(n, expected[e]), removed)
+			expected[e] -= removed
+			if expected[e] == 0 {
+				delete(expected, e)
+			}
+		} else {
+			bag.Add(e, n)
+			if n > 0 {
+				expected[e] += n
+			}
+		}
+	}
+	assertMultiSetEqualsMap(t, expected, bag)
+	assert.Equal(t, uint64(0), bag.Count(-1))
+	assert.False(t, bag.Contains(-1))
+}
+
+func TestMultiSetMostCommon(t *testing.T) {
+	bag := MultiSet3From("a", "b", "a", "c", "a", "b")
+	assert.Equal(t, []MultiSetEntry[string]{{"a", 3}, {"b", 2}}, bag.MostCommon(2))
+	assert.Len(t, bag.MostCommon(10), 3)
+	assert.Nil(t, bag.MostCommon(0))
+	assert.True(t, From("a", "b", "c").Equals(bag.Distinct()))
+	assert.Equal(t, "{a:3}", MultiSet3From("a", "a", "a").String())
+	var nilBag *MultiSet3[string]
+	assert.Equal(t, "{nil}", nilBag.String())
+}
+
+func TestMultiSetOperations(t *testing.T) {
+	a := MultiSet3From("x", "x", "y")
+	b := MultiSet3From("x", "y", "y", "z")
+	assertMultiSetEqualsMap(t, map[string]uint64{"x": 2, "y": 2, "z": 1}, a.Union(b))
+	assertMultiSetEqualsMap(t, map[string]uint64{"x": 1, "y": 1}, a.Intersect(b))
+	assertMultiSetEqualsMap(t, map[string]uint64{"x": 1, "y": 1}, b.Intersect(a))
+	assertMultiSetEqualsMap(t, map[string]uint64{"x": 3, "y": 3, "z": 1}, a.Sum(b))
+	assertMultiSetEqualsMap(t, map[string]uint64{"x": 1}, a.Subtract(b))
+	assertMultiSetEqualsMap(t, map[string]uint64{"y": 1, "z": 1}, b.Subtract(a))
+	assertMultiSetEqualsMap(t, map[string]uint64{"x": 2, "y": 1}, a) // operands are not altered
+	assert.True(t, a.Union(nil).Equals(a))
+	assert.True(t, a.Sum(nil).Equals(a))
+	assert.True(t, a.Subtract(nil).Equals(a))
+	assert.Equal(t, uint64(0), a.Intersect(nil).Size())
+	assert.False(t, a.Equals(b))
+	assert.False(t, a.Equals(nil))
+	assert.True(t, EmptyMultiSet3[string]().Equals(nil))
+}
+
+func TestMultiSetCloneAndClear(t *testing.T) {
+	bag := EmptyMultiSet3WithCapacity[int](10)
+	for i := range 1000 {
+		bag.Add(i, uint64(i%3)) //nolint:gosec
+	}
+	clone := bag.Clone()
+	bag.Clear()
+	assert.Equal(t, uint64(0), bag.Size())
+	assert.Equal(t, uint32(0), bag.DistinctSize())
+	assert.Equal(t, uint64(2), clone.Count(2), "clone shall be independent")
+	assert.Equal(t, uint64(999), clone.Size())
+	bag.Add(5, 1)
+	assert.Equal(t, uint64(1), bag.Count(5))
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	set3defaultGrowthFactor = 2.0
+	set3maxGrowthFactor     = 16.0
+	set3maxMaxAvgGroupLoad  = 7.0
+)
+
+// set3Options holds the tuning parameters of a Set3 instance. They are set once
+// by the constructor and carried over by Clone.
+type set3Options struct {
+	maxAvgGroupLoad float64
+	growthFactor    float64
+	shrinkThreshold float64
+	minNumGroups    uint32 // the set never shrinks automatically below this number of groups
+}
+
+func defaultOptions() set3Options {
+	return set3Options{
+		maxAvgGroupLoad: set3maxAvgGroupLoad,
+		growthFactor:    set3defaultGrowthFactor,
+		shrinkThreshold: 0, // never shrink automatically
+	}
+}
+
+// buildOptions applies the options to the defaults and validates the combination of them,
+// which the single options cannot do as they may be passed in any order.
+func buildOptions(options []Option) set3Options {
+	result := defaultOptions()
+	for _, o := range options {
+		o(&result)
+	}
+	if result.shrinkThreshold*result.growthFactor >= 1 {
+		// right after growing, the set is filled to 1/growthFactor of its capacity, so it would shrink again on the next remove
+		panic(fmt.Sprintf("set3: shrink threshold must be below 1/growth factor = %v, got %v", 1/result.growthFactor, result.shrinkThreshold))
+	}
+	return result
+}
+
+/*
+Option configures a Set3 when passed to [EmptyWithOptions]. Options let you trade speed for space per instance, e.g., run latency-sensitive
+sets at a lower load and memory-sensitive sets at a higher load.
+
+Example:
+
+	set := EmptyWithOptions[int](1000, WithMaxLoad(4.0), WithGrowthFactor(1.5))
+*/
+type Option func(*set3Options)
+
+/*
+WithMaxLoad sets the maximum average number of elements per group of 8 slots before thisSet grows. The default is 6.5.
+Lower values mean shorter probe sequences (faster lookups) at the cost of memory, higher values mean less memory at the cost of speed.
+
+WithMaxLoad panics if maxLoad is not in the range (0, 7].
+
+Example:
+
+	fast := EmptyWithOptions[int](1000, WithMaxLoad(4.0))
+	small := EmptyWithOptions[int](1000, WithMaxLoad(7.0))
+*/
+func WithMaxLoad(maxLoad float64) Option {
+	if !(maxLoad > 0 && maxLoad <= set3maxMaxAvgGroupLoad) {
+		panic(fmt.Sprintf("set3: max load must be in (0, %v], got %v", set3maxMaxAvgGroupLoad, maxLoad))
+	}
+	return func(o *set3Options) {
+		o.maxAvgGroupLoad = maxLoad
+	}
+}
+
+/*
+WithGrowthFactor sets the factor by which the number of groups is multiplied when thisSet has to grow. The default is 2.0.
+Smaller values waste less memory right after growing but cause more frequent rehashing.
+
+WithGrowthFactor panics if growthFactor is not in the range (1, 16].
+
+Example:
+
+	set := EmptyWithOptions[int](1000, WithGrowthFactor(1.25))
+*/
+func WithGrowthFactor(growthFactor float64) Option {
+	if !(growthFactor > 1 && growthFactor <= set3maxGrowthFactor) {
+		panic(fmt.Sprintf("set3: growth factor must be in (1, %v], got %v", set3maxGrowthFactor, growthFactor))
+	}
+	return func(o *set3Options) {
+		o.growthFactor = growthFactor
+	}
+}
+
+/*
+WithShrinkOnRemove lets thisSet shrink automatically. Whenever [Set3.Remove], [Set3.RemoveAll], [Set3.RemoveAllOf], [Set3.RemoveAllFromArray] or [Set3.Clear]
+let the number of elements fall below threshold times the current capacity, the set is rehashed to a smaller capacity.
+The new capacity leaves the set half way between threshold and full, so alternating adds and removes do not cause repeated rehashing.
+The set never shrinks below its initial capacity. By default, a Set3 never shrinks automatically (see [Set3.Rehash]).
+To avoid growing and shrinking in turns, a set with this option grows at most to the same load it shrinks to, which may be less than the growth factor.
+
+WithShrinkOnRemove panics if threshold is not in the range (0, 1). The constructor panics if threshold is not below 1/growth factor
+(0.5 with the default growth factor, see [WithGrowthFactor]), as a set filled to less than that right after growing would shrink again on the next remove.
+
+Example:
+
+	set := EmptyWithOptions[int](1_000_000, WithShrinkOnRemove(0.25))
+	// ... add and remove lots of elements, set will release memory once it becomes sparse
+*/
+func WithShrinkOnRemove(threshold float64) Option {
+	if !(threshold > 0 && threshold < 1) {
+		panic(fmt.Sprintf("set3: shrink threshold must be in (0, 1), got %v", threshold))
+	}
+	return func(o *set3Options) {
+		o.shrinkThreshold = threshold
+	}
+}
+
+// shrinkTargetLoad returns the fraction of the capacity a set is filled to after
+// shrinking. It is half way between the shrink threshold and a full set.
+func (o *set3Options) shrinkTargetLoad() float64 {
+	return (1 + o.shrinkThreshold) / 2
+}
+
+// clampToUint32 converts f to uint32, saturating at the bounds of uint32 instead of
+// relying on the implementation-defined conversion of out-of-range values.
+func clampToUint32(f float64) uint32 {
+	if !(f > 0) {
+		return 0
+	}
+	if f >= math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(f)
+}
+
+func calcElementLimit(numGroups uint32, maxAvgGroupLoad float64) uint32 {
+	limit := clampToUint32(float64(numGroups) * maxAvgGroupLoad)
+	if limit == 0 {
+		limit = 1
+	}
+	return limit
+}
@@ -0,0 +1,293 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsDefault(t *testing.T) {
+	set1 := EmptyWithCapacity[int](100)
+	set2 := EmptyWithOptions[int](100)
+	assert.Equal(t, set1.options, set2.options)
+	assert.Equal(t, set3maxAvgGroupLoad, set1.options.maxAvgGroupLoad)
+	assert.Equal(t, set3defaultGrowthFactor, set1.options.growthFactor)
+	assert.Equal(t, 0.0, set1.options.shrinkThreshold)
+	assert.Equal(t, len(set1.groupCtrl), len(set2.groupCtrl), "both sets shall have the same number of groups")
+	assert.Equal(t, set1.elementLimit, set2.elementLimit, "both sets shall have the same element limit")
+}
+
+func TestOptionsMaxLoad(t *testing.T) {
+	low := EmptyWithOptions[int](100, WithMaxLoad(2.0))
+	high := EmptyWithOptions[int](100, WithMaxLoad(7.0))
+	assert.Equal(t, 50, len(low.groupCtrl), "low load set shall contain 50 groups")
+	assert.Equal(t, 15, len(high.groupCtrl), "high load set shall contain 15 groups")
+	for i := range 1000 {
+		low.Add(i)
+		high.Add(i)
+	}
+	for i := range 1000 {
+		assert.True(t, low.Contains(i), "low load set shall contain %v", i)
+		assert.True(t, high.Contains(i), "high load set shall contain %v", i)
+	}
+	assert.LessOrEqual(t, float64(low.resident)/float64(len(low.groupCtrl)), 2.0)
+	assert.LessOrEqual(t, float64(high.resident)/float64(len(high.groupCtrl)), 7.0)
+	assert.Greater(t, len(low.groupCtrl), len(high.groupCtrl))
+}
+
+func TestOptionsTinyMaxLoad(t *testing.T) {
+	set := EmptyWithOptions[int](0, WithMaxLoad(0.1))
+	assert.Equal(t, uint32(1), set.elementLimit, "element limit shall be at least 1")
+	for i := range 100 {
+		set.Add(i)
+	}
+	assert.Equal(t, uint32(100), set.Size())
+	assert.False(t, set.Contains(100))
+}
+
+func TestOptionsGrowthFactor(t *testing.T) {
+	set := EmptyWithOptions[int](65, WithGrowthFactor(1.5))
+	assert.Equal(t, 10, len(set.groupCtrl))
+	for i := range 66 {
+		set.Add(i)
+	}
+	assert.Equal(t, 15, len(set.groupCtrl), "set shall have grown by factor 1.5")
+
+	tiny := EmptyWithOptions[int](0, WithGrowthFactor(1.01))
+	for i := range 7 {
+		tiny.Add(i)
+	}
+	assert.Equal(t, 2, len(tiny.groupCtrl), "set shall grow by at least one group")
+}
+
+func TestOptionsShrinkOnRemove(t *testing.T) {
+	set := EmptyWithOptions[int](0, WithShrinkOnRemove(0.25))
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	grown := len(set.groupCtrl)
+	for i := range 9_900 {
+		assert.True(t, set.Remove(i))
+	}
+	assert.Less(t, len(set.groupCtrl), grown/10, "set shall have shrunk")
+	assert.Equal(t, uint32(100), set.Size())
+	for i := 9_900; i < 10_000; i++ {
+		assert.True(t, set.Contains(i), "set shall contain %v", i)
+	}
+
+	noShrink := EmptyWithCapacity[int](0)
+	for i := range 10_000 {
+		noShrink.Add(i)
+	}
+	grown = len(noShrink.groupCtrl)
+	for i := range 9_900 {
+		noShrink.Remove(i)
+	}
+	assert.Equal(t, grown, len(noShrink.groupCtrl), "set without shrink option shall not shrink")
+}
+
+func TestOptionsShrinkOnRemoveAll(t *testing.T) {
+	set := EmptyWithOptions[int](0, WithShrinkOnRemove(0.25))
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	grown := len(set.groupCtrl)
+	set.RemoveAll(set.Clone())
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Less(t, len(set.groupCtrl), grown, "set shall have shrunk")
+
+	set.AddAllOf(1, 2, 3)
+	set.RemoveAll(set)
+	assert.Equal(t, uint32(0), set.Size(), "removing all elements of a set from itself shall empty the set")
+}
+
+func TestOptionsInherited(t *testing.T) {
+	set1 := EmptyWithOptions[int](10, WithMaxLoad(3.0), WithGrowthFactor(1.5))
+	set1.AddAllOf(1, 2, 3)
+	set2 := From(3, 4, 5)
+	assert.Equal(t, set1.options, set1.Clone().options)
+	for _, result := range []*Set3[int]{set1.Unite(set2), set1.Intersect(set2), set1.Subtract(set2), set1.IntersectWithArray([]int{1})} {
+		assert.Equal(t, set1.options.maxAvgGroupLoad, result.options.maxAvgGroupLoad)
+		assert.Equal(t, set1.options.growthFactor, result.options.growthFactor)
+		assert.Equal(t, set1.options.shrinkThreshold, result.options.shrinkThreshold)
+	}
+}
+
+func TestOptionsInvalid(t *testing.T) {
+	assert.Panics(t, func() { WithMaxLoad(0) })
+	assert.Panics(t, func() { WithMaxLoad(-1) })
+	assert.Panics(t, func() { WithMaxLoad(7.5) })
+	assert.Panics(t, func() { WithGrowthFactor(1) })
+	assert.Panics(t, func() { WithGrowthFactor(0.5) })
+	assert.Panics(t, func() { WithGrowthFactor(1e12) })
+	assert.PanicsWithValue(t, "set3: growth factor must be in (1, 16], got +Inf", func() { WithGrowthFactor(math.Inf(1)) })
+	assert.Panics(t, func() { WithGrowthFactor(math.NaN()) })
+	assert.Panics(t, func() { WithShrinkOnRemove(0) })
+	assert.Panics(t, func() { WithShrinkOnRemove(1) })
+	assert.NotPanics(t, func() { WithMaxLoad(7) })
+	assert.NotPanics(t, func() { WithGrowthFactor(1.1) })
+	assert.NotPanics(t, func() { WithGrowthFactor(16) })
+	assert.NotPanics(t, func() { WithShrinkOnRemove(0.5) })
+}
+
+func TestOptionsGroupCountSaturates(t *testing.T) {
+	assert.Equal(t, uint32(math.MaxUint32), calcReqNrOfGroupsForLoad(math.MaxUint32, 0.1))
+	assert.Equal(t, uint32(math.MaxUint32), calcElementLimit(math.MaxUint32, 7))
+	assert.Equal(t, uint32(0), clampToUint32(math.NaN()))
+	assert.Equal(t, uint32(0), clampToUint32(-1))
+	assert.Equal(t, uint32(42), clampToUint32(42.9))
+}
+
+func TestOptionsShrinkHysteresis(t *testing.T) {
+	set := EmptyWithOptions[int](0, WithShrinkOnRemove(0.25))
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	for i := range 9_000 {
+		set.Remove(i)
+	}
+	shrunk := len(set.groupCtrl)
+	limit := set.elementLimit
+	assert.Greater(t, float64(set.Size()), 0.25*float64(limit), "set shall not be close to the shrink threshold after shrinking")
+	assert.Less(t, float64(set.Size()), 0.75*float64(limit), "set shall not be close to the growth limit after shrinking")
+
+	// oscillating around the current size shall not cause any rehashing
+	for round := range 100 {
+		for i := range 200 {
+			set.Add(20_000 + round*1000 + i)
+		}
+		for i := range 200 {
+			set.Remove(20_000 + round*1000 + i)
+		}
+		assert.Equal(t, shrunk, len(set.groupCtrl), "set shall not rehash in round %d", round)
+	}
+	assert.Equal(t, uint32(1000), set.Size())
+}
+
+type growthAndShrink struct {
+	growthFactor, threshold float64
+}
+
+var validGrowthAndShrink = []growthAndShrink{{16, 0.06}, {4, 0.2}, {2, 0.25}, {2, 0.45}, {1.25, 0.5}, {1.25, 0.75}}
+
+func TestOptionsGrowthDoesNotUndercutShrinkThreshold(t *testing.T) {
+	for _, options := range validGrowthAndShrink {
+		threshold := options.threshold
+		set := EmptyWithOptions[int](0, WithGrowthFactor(options.growthFactor), WithShrinkOnRemove(threshold))
+		groups := len(set.groupCtrl)
+		for i := range 20_000 {
+			set.Add(i)
+			if len(set.groupCtrl) != groups {
+				groups = len(set.groupCtrl)
+				probe := set.Clone()
+				probe.Remove(i)
+				require.Equal(t, groups, len(probe.groupCtrl), "%v, size %d: removing one element right after growing shall not shrink the set", options, set.Size())
+				if groups >= 64 { // small sets can only grow by whole groups
+					require.GreaterOrEqual(t, float64(set.Size()), threshold*float64(set.elementLimit), "%v: the set shall not be sparse right after growing", options)
+				}
+			}
+		}
+	}
+}
+
+func TestOptionsShrinkThresholdBelowInverseGrowthFactor(t *testing.T) {
+	assert.PanicsWithValue(t, "set3: shrink threshold must be below 1/growth factor = 0.5, got 0.5", func() { EmptyWithOptions[int](0, WithShrinkOnRemove(0.5)) })
+	assert.Panics(t, func() { EmptyWithOptions[int](0, WithShrinkOnRemove(0.3), WithGrowthFactor(4)) }, "the order of the options shall not matter")
+	assert.Panics(t, func() { EmptyWithOptions[int](0, WithGrowthFactor(4), WithShrinkOnRemove(0.3)) })
+	assert.Panics(t, func() { RequiredGroups(10, WithGrowthFactor(16), WithShrinkOnRemove(0.1)) })
+	assert.NotPanics(t, func() { EmptyWithOptions[int](0, WithShrinkOnRemove(0.49)) })
+}
+
+func TestOptionsAddRemoveAtBoundaryDoesNotRehash(t *testing.T) {
+	for _, options := range validGrowthAndShrink {
+		set := EmptyWithOptions[int](0, WithGrowthFactor(options.growthFactor), WithShrinkOnRemove(options.threshold))
+		alternate := func(e int, what string) {
+			groups := len(set.groupCtrl)
+			for range 10 {
+				set.Remove(e)
+				set.Add(e)
+				require.Equal(t, groups, len(set.groupCtrl), "%v, size %d: alternating Add and Remove right after %s shall not rehash", options, set.Size(), what)
+			}
+		}
+		groups := len(set.groupCtrl)
+		for i := range 20_000 {
+			set.Add(i)
+			if len(set.groupCtrl) != groups {
+				alternate(i, "growing")
+				groups = len(set.groupCtrl)
+			}
+		}
+		for i := range 20_000 {
+			set.Remove(i)
+			if len(set.groupCtrl) != groups && i+1 < 20_000 {
+				alternate(i+1, "shrinking") // i+1 is the next element still in the set
+				groups = len(set.groupCtrl)
+			}
+		}
+	}
+}
+
+func TestOptionsShrinkFloor(t *testing.T) {
+	set := EmptyWithOptions[int](1000, WithShrinkOnRemove(0.4))
+	initial := len(set.groupCtrl)
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	for i := range 10_000 {
+		set.Remove(i)
+	}
+	assert.Equal(t, initial, len(set.groupCtrl), "set shall not shrink below its initial capacity")
+
+	set.AddAllOf(1, 2, 3)
+	set.RemoveAllOf(1, 2, 3)
+	assert.Equal(t, initial, len(set.groupCtrl), "set shall not shrink below its initial capacity")
+}
+
+func TestOptionsShrinkOnClear(t *testing.T) {
+	set := EmptyWithOptions[int](10, WithShrinkOnRemove(0.25))
+	initial := len(set.groupCtrl)
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, initial, len(set.groupCtrl), "cleared set shall shrink to its initial capacity")
+
+	noShrink := EmptyWithCapacity[int](10)
+	for i := range 10_000 {
+		noShrink.Add(i)
+	}
+	grown := len(noShrink.groupCtrl)
+	noShrink.Clear()
+	assert.Equal(t, grown, len(noShrink.groupCtrl), "set without shrink option shall keep its capacity")
+}
+
+func TestOptionsShrinkRemoveAllFromArray(t *testing.T) {
+	set := EmptyWithOptions[int](0, WithShrinkOnRemove(0.25))
+	data := make([]int, 10_000)
+	for i := range data {
+		data[i] = i
+	}
+	set.AddAllFromArray(data)
+	grown := len(set.groupCtrl)
+	set.RemoveAllFromArray(data[:9_500])
+	assert.Less(t, len(set.groupCtrl), grown, "set shall have shrunk")
+	assert.True(t, set.ContainsAllFromArray(data[9_500:]))
+	assert.False(t, set.ContainsAnyFromArray(data[:9_500]))
+}
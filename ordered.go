@@ -0,0 +1,375 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"iter"
+	"math/bits"
+
+	"github.com/dolthub/maphash"
+)
+
+/*
+OrderedSet3 is a set that remembers the order in which its elements have been added: [OrderedSet3.Range], [OrderedSet3.ToArray] and
+[OrderedSet3.String] list the elements in insertion order. Adding an element that is already in the set does not change its position.
+
+The elements are stored in a dense array in insertion order, and a Swiss table with the same layout as Set3 stores the positions of the elements in this array.
+Removing an element leaves a gap in the array, which is closed by a compaction once half of the array consists of gaps, so removals take amortized constant time.
+A Fenwick tree counts the gaps, so [OrderedSet3.IndexOf] and [OrderedSet3.At] take logarithmic time. None of the methods that only read thisSet change it.
+*/
+type OrderedSet3[T comparable] struct {
+	set3table
+	hashFunction maphash.Hasher[T]
+	groupIndex   [][set3groupSize]uint32 // positions in entries
+	entries      []orderedEntry[T]
+	gaps         []uint32 // Fenwick tree: gaps[i-1] is the number of removed entries among entries[i-(i&-i):i]
+	removed      int      // number of removed entries that have not been compacted yet
+}
+
+type orderedEntry[T comparable] struct {
+	element T
+	removed bool
+}
+
+/*
+EmptyOrderedSet3 creates a new and empty OrderedSet3 with a reasonable default initial capacity.
+
+Example:
+
+	set := EmptyOrderedSet3[string]()
+	set.Add("b")
+	set.Add("a") // set.ToArray() will be ["b", "a"]
+*/
+func EmptyOrderedSet3[T comparable]() *OrderedSet3[T] {
+	return EmptyOrderedSet3WithCapacity[T](21)
+}
+
+/*
+EmptyOrderedSet3WithCapacity creates a new and empty OrderedSet3 that can hold initialCapacity elements without being reorganized.
+
+Example:
+
+	set := EmptyOrderedSet3WithCapacity[string](1000)
+*/
+func EmptyOrderedSet3WithCapacity[T comparable](initialCapacity uint32) *OrderedSet3[T] {
+	result := &OrderedSet3[T]{
+		hashFunction: maphash.NewHasher[T](),
+		entries:      make([]orderedEntry[T], 0, initialCapacity),
+		gaps:         make([]uint32, 0, initialCapacity),
+	}
+	result.allocate(calcReqNrOfGroups(initialCapacity))
+	return result
+}
+
+/*
+OrderedSet3From creates a new OrderedSet3 containing the arguments in the given order. Duplicates keep the position of their first occurrence.
+
+Example:
+
+	set := OrderedSet3From("c", "a", "c", "b") // set.ToArray() will be ["c", "a", "b"]
+*/
+func OrderedSet3From[T comparable](args ...T) *OrderedSet3[T] {
+	return OrderedSet3FromArray(args)
+}
+
+/*
+OrderedSet3FromArray creates a new OrderedSet3 containing the elements of data in the given order. Duplicates keep the position of their first occurrence.
+*/
+func OrderedSet3FromArray[T comparable](data []T) *OrderedSet3[T] {
+	result := EmptyOrderedSet3WithCapacity[T](uint32(len(data))) //nolint:gosec
+	for _, e := range data {
+		result.Add(e)
+	}
+	return result
+}
+
+func (thisSet *OrderedSet3[T]) allocate(numGroups uint32) {
+	thisSet.set3table.allocate(numGroups)
+	thisSet.groupIndex = make([][set3groupSize]uint32, numGroups)
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation, in insertion order.
+
+Example:
+
+	set := OrderedSet3From(3, 1, 2)
+	fmt.Println(set) // will print "{3,1,2}"
+*/
+func (thisSet *OrderedSet3[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.Range(), set3formatValue)
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *OrderedSet3[T]) Size() uint32 {
+	return uint32(len(thisSet.entries) - thisSet.removed) //nolint:gosec
+}
+
+func (thisSet *OrderedSet3[T]) find(element T) (uint64, int, bool) {
+	return thisSet.probe(thisSet.hashFunction.Hash(element), func(g uint64, s int) bool {
+		return element == thisSet.entries[thisSet.groupIndex[g][s]].element
+	})
+}
+
+/*
+Checks if thisSet contains the element.
+*/
+func (thisSet *OrderedSet3[T]) Contains(element T) bool {
+	_, _, found := thisSet.find(element)
+	return found
+}
+
+/*
+Inserts the element at the end of thisSet if it is not yet in thisSet. If it is already in thisSet, its position does not change.
+*/
+func (thisSet *OrderedSet3[T]) Add(element T) {
+	if _, _, found := thisSet.find(element); found {
+		return
+	}
+	if thisSet.full() {
+		thisSet.rehashToNumGroups(thisSet.nextGroupCount())
+	}
+	thisSet.entries = append(thisSet.entries, orderedEntry[T]{element: element})
+	n := len(thisSet.entries)
+	// the new node covers entries[n-(n&-n):n], whose gaps all lie before the new entry
+	thisSet.gaps = append(thisSet.gaps, uint32(thisSet.gapsBefore(n-1)-thisSet.gapsBefore(n-(n&-n)))) //nolint:gosec
+	thisSet.insertIndex(element, uint32(n-1))                                                         //nolint:gosec
+}
+
+/*
+Inserts all parameter values that are not yet in thisSet at the end of thisSet, in the given order.
+*/
+func (thisSet *OrderedSet3[T]) AddAllOf(args ...T) {
+	for _, e := range args {
+		thisSet.Add(e)
+	}
+}
+
+// insertIndex stores the position of an element that is known not to be in the table in the first empty slot of its probe sequence.
+func (thisSet *OrderedSet3[T]) insertIndex(element T, index uint32) {
+	g, s := thisSet.claim(thisSet.hashFunction.Hash(element))
+	thisSet.groupIndex[g][s] = index
+}
+
+/*
+Removes the element from thisSet if it is in thisSet, returns whether or not the element was in thisSet. The order of the other elements does not change.
+*/
+func (thisSet *OrderedSet3[T]) Remove(element T) bool {
+	g, s, found := thisSet.find(element)
+	if !found {
+		return false
+	}
+	index := int(thisSet.groupIndex[g][s])
+	thisSet.release(g, s)
+	var k T
+	thisSet.entries[index] = orderedEntry[T]{element: k, removed: true}
+	thisSet.removed++
+	for i := index + 1; i <= len(thisSet.gaps); i += i & -i {
+		thisSet.gaps[i-1]++
+	}
+	// trailing gaps can be dropped right away, the remaining nodes of the Fenwick tree only cover the remaining entries
+	for n := len(thisSet.entries); n > 0 && thisSet.entries[n-1].removed; n-- {
+		thisSet.entries = thisSet.entries[:n-1]
+		thisSet.gaps = thisSet.gaps[:n-1]
+		thisSet.removed--
+	}
+	if thisSet.removed > 0 && 2*thisSet.removed >= len(thisSet.entries) {
+		thisSet.compact()
+	}
+	return true
+}
+
+// compact closes the gaps in entries and updates the positions in the table accordingly.
+func (thisSet *OrderedSet3[T]) compact() {
+	newIndex := make([]uint32, len(thisSet.entries))
+	n := 0
+	for i, entry := range thisSet.entries {
+		if !entry.removed {
+			newIndex[i] = uint32(n) //nolint:gosec
+			thisSet.entries[n] = entry
+			n++
+		}
+	}
+	clear(thisSet.entries[n:])
+	thisSet.entries = thisSet.entries[:n]
+	thisSet.gaps = thisSet.gaps[:n]
+	clear(thisSet.gaps)
+	thisSet.removed = 0
+	for g, s := range thisSet.slots() {
+		thisSet.groupIndex[g][s] = newIndex[thisSet.groupIndex[g][s]]
+	}
+}
+
+func (thisSet *OrderedSet3[T]) rehashToNumGroups(newNumGroups uint32) {
+	thisSet.hashFunction = maphash.NewSeed(thisSet.hashFunction)
+	thisSet.allocate(newNumGroups)
+	for i, entry := range thisSet.entries {
+		if !entry.removed {
+			thisSet.insertIndex(entry.element, uint32(i)) //nolint:gosec
+		}
+	}
+}
+
+/*
+Clear removes all elements from thisSet.
+*/
+func (thisSet *OrderedSet3[T]) Clear() {
+	thisSet.reset()
+	clear(thisSet.entries)
+	thisSet.entries = thisSet.entries[:0]
+	thisSet.gaps = thisSet.gaps[:0]
+	thisSet.removed = 0
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *OrderedSet3[T]) Clone() *OrderedSet3[T] {
+	result := EmptyOrderedSet3WithCapacity[T](thisSet.Size())
+	for e := range thisSet.Range() {
+		result.Add(e)
+	}
+	return result
+}
+
+/*
+Range iterates over all elements in thisSet in insertion order.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, iterate over [OrderedSet3.ToArray].
+
+Example:
+
+	for elem := range set.Range() {
+		// do something with elem...
+	}
+*/
+func (thisSet *OrderedSet3[T]) Range() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for _, entry := range thisSet.entries {
+			if !entry.removed && !yield(entry.element) {
+				return
+			}
+		}
+	}
+}
+
+/*
+ToArray allocates an array of type T and adds all elements of thisSet to it in insertion order.
+*/
+func (thisSet *OrderedSet3[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.Size())
+	for e := range thisSet.Range() {
+		result = append(result, e)
+	}
+	return result
+}
+
+/*
+ToSet3 creates a new Set3 containing all elements of thisSet.
+*/
+func (thisSet *OrderedSet3[T]) ToSet3() *Set3[T] {
+	result := EmptyWithCapacity[T](thisSet.Size())
+	for e := range thisSet.Range() {
+		result.Add(e)
+	}
+	return result
+}
+
+/*
+First returns the element that has been added first of all elements in thisSet. Returns false if thisSet is empty.
+*/
+func (thisSet *OrderedSet3[T]) First() (T, bool) {
+	if thisSet.Size() == 0 {
+		var zero T
+		return zero, false
+	}
+	return thisSet.entries[thisSet.position(0)].element, true
+}
+
+/*
+Last returns the element that has been added last of all elements in thisSet. Returns false if thisSet is empty.
+*/
+func (thisSet *OrderedSet3[T]) Last() (T, bool) {
+	// removing the last entry drops all trailing gaps, so the last entry is never a gap
+	if len(thisSet.entries) == 0 {
+		var zero T
+		return zero, false
+	}
+	return thisSet.entries[len(thisSet.entries)-1].element, true
+}
+
+/*
+IndexOf returns the position of the element in the insertion order of thisSet, starting at 0, or -1 if the element is not in thisSet.
+IndexOf takes logarithmic time.
+
+Example:
+
+	set := OrderedSet3From("a", "b", "c")
+	set.Remove("a")
+	i := set.IndexOf("c") // i will be 1
+*/
+func (thisSet *OrderedSet3[T]) IndexOf(element T) int {
+	g, s, found := thisSet.find(element)
+	if !found {
+		return -1
+	}
+	index := int(thisSet.groupIndex[g][s])
+	return index - thisSet.gapsBefore(index)
+}
+
+/*
+At returns the element at the given position in the insertion order of thisSet, starting at 0. Panics if index is out of range.
+At takes logarithmic time.
+
+Example:
+
+	set := OrderedSet3From("a", "b", "c")
+	e := set.At(1) // e will be "b"
+*/
+func (thisSet *OrderedSet3[T]) At(index int) T {
+	if index < 0 || index >= int(thisSet.Size()) {
+		panic(fmt.Sprintf("set3: index %d out of range [0,%d)", index, thisSet.Size()))
+	}
+	return thisSet.entries[thisSet.position(index)].element
+}
+
+// gapsBefore returns the number of removed entries among entries[:n].
+func (thisSet *OrderedSet3[T]) gapsBefore(n int) int {
+	sum := 0
+	for ; n > 0; n &= n - 1 {
+		sum += int(thisSet.gaps[n-1])
+	}
+	return sum
+}
+
+// position returns the position in entries of the element at the given index, which must be in range.
+// It descends the Fenwick tree, whose node i covers i&-i entries.
+func (thisSet *OrderedSet3[T]) position(index int) int {
+	pos, rest := 0, index+1 // rest is the number of elements still to skip, including the one at index
+	for step := 1 << (bits.Len(uint(len(thisSet.gaps))) - 1); step > 0; step >>= 1 {
+		if next := pos + step; next <= len(thisSet.gaps) {
+			if elements := step - int(thisSet.gaps[next-1]); elements < rest {
+				pos, rest = next, rest-elements
+			}
+		}
+	}
+	return pos
+}
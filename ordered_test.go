@@ -0,0 +1,133 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedSetMatchesSlice(t *testing.T) {
+	rng := rand.New(rand.NewPCG(11, 12)) //nolint:gosec
+	set := EmptyOrderedSet3[int]()
+	expected := []int{}
+	for i := range 50_000 {
+		e := rng.IntN(2000)
+		if rng.IntN(2) == 0 {
+			set.Add(e)
+			if !slices.Contains(expected, e) {
+				expected = append(expected, e)
+			}
+		} else {
+			idx := slices.Index(expected, e)
+			assert.Equal(t, idx >= 0, set.Remove(e))
+			if idx >= 0 {
+				expected = slices.Delete(expected, idx, idx+1)
+			}
+		}
+		assert.LessOrEqual(t, len(set.entries), 2*len(expected)+1, "gaps shall be compacted")
+		if i%1000 == 0 {
+			require.Equal(t, expected, set.ToArray())
+			first, ok := set.First()
+			assert.Equal(t, len(expected) > 0, ok)
+			last, _ := set.Last()
+			if ok {
+				assert.Equal(t, expected[0], first)
+				assert.Equal(t, expected[len(expected)-1], last)
+			}
+			for j := 0; j < len(expected); j += 97 {
+				assert.Equal(t, j, set.IndexOf(expected[j]))
+				assert.Equal(t, expected[j], set.At(j))
+			}
+		}
+	}
+	assert.Equal(t, uint32(len(expected)), set.Size()) //nolint:gosec
+	assert.Equal(t, expected, slices.Collect(set.Range()))
+	assert.Equal(t, -1, set.IndexOf(-1))
+}
+
+func TestOrderedSetBasics(t *testing.T) {
+	set := OrderedSet3From("c", "a", "c", "b")
+	assert.Equal(t, "{c,a,b}", set.String())
+	set.Add("c")
+	assert.Equal(t, []string{"c", "a", "b"}, set.ToArray(), "adding an existing element shall not move it")
+	assert.True(t, set.Contains("a"))
+	assert.True(t, set.Remove("c"))
+	assert.False(t, set.Remove("c"))
+	first, ok := set.First()
+	assert.True(t, ok)
+	assert.Equal(t, "a", first)
+	assert.Equal(t, 1, set.IndexOf("b"))
+	set.AddAllOf("d", "c")
+	assert.Equal(t, []string{"a", "b", "d", "c"}, set.ToArray())
+	assert.True(t, From("a", "b", "c", "d").Equals(set.ToSet3()))
+
+	clone := set.Clone()
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+	_, ok = set.First()
+	assert.False(t, ok)
+	_, ok = set.Last()
+	assert.False(t, ok)
+	assert.Equal(t, "{}", set.String())
+	assert.Equal(t, []string{"a", "b", "d", "c"}, clone.ToArray(), "clone shall be independent")
+	set.Add("x")
+	assert.Equal(t, []string{"x"}, set.ToArray())
+
+	var nilSet *OrderedSet3[string]
+	assert.Equal(t, "{nil}", nilSet.String())
+	assert.Panics(t, func() { set.At(1) })
+}
+
+func TestOrderedSetIndexOfAfterRemoveDoesNotCompact(t *testing.T) {
+	// alternating Remove and IndexOf/At used to compact on every read, which made this loop quadratic
+	const n = 200_000
+	set := EmptyOrderedSet3WithCapacity[int](n)
+	for i := range n {
+		set.Add(i)
+	}
+	for j := 0; 2*j < n/2; j++ {
+		require.True(t, set.Remove(2*j))
+		// the odd elements before 2j+1 are the only ones left in front of it
+		require.Equal(t, j, set.IndexOf(2*j+1))
+		require.Equal(t, 2*j+1, set.At(j))
+		require.Equal(t, n-j-2, set.IndexOf(n-1))
+		first, _ := set.First()
+		require.Equal(t, 1, first)
+		require.Equal(t, j+1, set.removed, "reading shall not change thisSet")
+	}
+	assert.Equal(t, n-n/4, int(set.Size()))
+	assert.PanicsWithValue(t, "set3: index -1 out of range [0,150000)", func() { set.At(-1) })
+}
+
+func TestOrderedSetRemoveFront(t *testing.T) {
+	// a FIFO queue pattern: add at the end, remove from the front
+	set := EmptyOrderedSet3[int]()
+	for i := range 100_000 {
+		set.Add(i)
+		if i >= 10 {
+			first, ok := set.First()
+			require.True(t, ok)
+			require.Equal(t, i-10, first)
+			set.Remove(first)
+		}
+	}
+	assert.Equal(t, []int{99_990, 99_991, 99_992, 99_993, 99_994, 99_995, 99_996, 99_997, 99_998, 99_999}, set.ToArray())
+	assert.LessOrEqual(t, len(set.entries), 21)
+}
@@ -0,0 +1,428 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+)
+
+/*
+A PersistentSet3 keeps its state in a directory with two files:
+
+The snapshot file contains the magic "SET3SNAP", the set encoded by [Set3.AppendEncoded] and the CRC-32 (IEEE, little endian) of both.
+It is replaced atomically by writing a temporary file and renaming it.
+
+The log file contains the magic "SET3WAL\x00" followed by one record per successful Add or Remove:
+
+	op      1 byte          persistentOpAdd or persistentOpRemove
+	length  varint          length of the encoded element
+	element length bytes    element encoded by the codec
+	crc     4 bytes         CRC-32 (IEEE, little endian) of op, length and element
+
+On open, the snapshot is loaded and the log is replayed on top of it. An incomplete or corrupt last record, e.g., after a crash during a write,
+is discarded and the log is truncated to the last complete record. A corrupt record followed by more data is not the result of a crash, so
+opening fails instead of dropping the records after it. As Add and Remove are idempotent, replaying a log that has already been
+included in the snapshot (e.g. after a crash during [PersistentSet3.Snapshot]) yields the same state.
+*/
+const (
+	persistentSnapshotFile = "snapshot"
+	persistentLogFile      = "log"
+	persistentTempSuffix   = ".tmp"
+	persistentSnapMagic    = "SET3SNAP"
+	persistentLogMagic     = "SET3WAL\x00"
+
+	persistentOpAdd    byte = 1
+	persistentOpRemove byte = 2
+)
+
+// SyncPolicy determines when a [PersistentSet3] forces its log to stable storage (fsync).
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs the log after every record. Every successful Add or Remove survives a power loss. This is the safest and the slowest policy.
+	SyncAlways SyncPolicy = iota
+	// SyncEveryN syncs the log after every [PersistentOptions.SyncEvery] records.
+	SyncEveryN
+	// SyncNever leaves syncing to the operating system, the log is only synced by [PersistentSet3.Sync], [PersistentSet3.Snapshot] and [PersistentSet3.Close].
+	// Records survive a crash of the process, but not necessarily a crash of the operating system.
+	SyncNever
+)
+
+// PersistentOptions configure a [PersistentSet3]. The zero value syncs every record and never snapshots automatically.
+type PersistentOptions struct {
+	// Sync is the fsync policy for the log.
+	Sync SyncPolicy
+	// SyncEvery is the number of records between two syncs if Sync is SyncEveryN.
+	SyncEvery int
+	// SnapshotEvery is the number of log records after which a snapshot is written automatically. If zero, snapshots are only written by [PersistentSet3.Snapshot].
+	SnapshotEvery int
+}
+
+/*
+PersistentSet3 is a Set3 that survives restarts. Every Add and Remove that changes the set is appended to a write-ahead log before it returns.
+Snapshots of the whole set are written periodically (see [PersistentOptions]) or on demand, which truncates the log.
+
+A PersistentSet3 is not safe for concurrent use, and a directory must not be opened by more than one PersistentSet3 at a time.
+*/
+type PersistentSet3[T comparable] struct {
+	set        *Set3[T]
+	codec      Codec[T]
+	options    PersistentOptions
+	dir        string
+	log        *os.File
+	logEnd     int64 // end of the last complete record in the log
+	logRecords int
+	unsynced   int
+	// buffers reused for encoding log records
+	elementBuffer []byte
+	recordBuffer  []byte
+}
+
+/*
+OpenPersistent opens the PersistentSet3 stored in dir, or creates a new and empty one if dir does not contain a set yet. dir is created if necessary.
+The elements are serialized by codec, which must be the same every time the directory is opened.
+
+Returns an error wrapping [ErrInvalidFormat] if the snapshot is corrupt, the log is not a log file or the log contains a corrupt record
+that is followed by more data. An incomplete or corrupt last record of the log is discarded.
+
+Example:
+
+	set, err := OpenPersistent("processed-ids", IntegerCodec[uint64](), PersistentOptions{Sync: SyncEveryN, SyncEvery: 100, SnapshotEvery: 100_000})
+	if err != nil {
+		// handle error
+	}
+	defer set.Close()
+	err = set.Add(42)
+*/
+func OpenPersistent[T comparable](dir string, codec Codec[T], options PersistentOptions) (*PersistentSet3[T], error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	set, err := readPersistentSnapshot(filepath.Join(dir, persistentSnapshotFile), codec)
+	if err != nil {
+		return nil, err
+	}
+	result := &PersistentSet3[T]{
+		set:     set,
+		codec:   codec,
+		options: options,
+		dir:     dir,
+	}
+	if err := result.replayLog(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func readPersistentSnapshot[T comparable](path string, codec Codec[T]) (*Set3[T], error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Empty[T](), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(persistentSnapMagic)+4 || string(data[:len(persistentSnapMagic)]) != persistentSnapMagic {
+		return nil, fmt.Errorf("%w: not a snapshot file", ErrInvalidFormat)
+	}
+	payload, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("%w: snapshot checksum mismatch", ErrInvalidFormat)
+	}
+	set, n, err := FromEncoded(payload[len(persistentSnapMagic):], codec)
+	if err != nil {
+		return nil, err
+	}
+	if len(persistentSnapMagic)+n != len(payload) {
+		return nil, fmt.Errorf("%w: trailing bytes in snapshot", ErrInvalidFormat)
+	}
+	return set, nil
+}
+
+// replayLog applies all complete records of the log to the set, truncates the
+// log after the last complete record and opens it for appending.
+func (thisSet *PersistentSet3[T]) replayLog() error {
+	path := filepath.Join(thisSet.dir, persistentLogFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	valid := 0
+	if len(data) >= len(persistentLogMagic) {
+		if string(data[:len(persistentLogMagic)]) != persistentLogMagic {
+			return fmt.Errorf("%w: not a log file", ErrInvalidFormat)
+		}
+		valid = len(persistentLogMagic)
+		for valid < len(data) {
+			n, end, ok := thisSet.applyRecord(data[valid:])
+			if !ok {
+				if valid+end < len(data) {
+					// a torn write can only affect the last record
+					return fmt.Errorf("%w: corrupt log record at offset %d", ErrInvalidFormat, valid)
+				}
+				break
+			}
+			valid += n
+			thisSet.logRecords++
+		}
+	}
+	log, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	if valid == 0 {
+		// new log, or the magic has not been written completely
+		err = log.Truncate(0)
+		if err == nil {
+			_, err = log.WriteAt([]byte(persistentLogMagic), 0)
+		}
+		valid = len(persistentLogMagic)
+	} else if valid < len(data) {
+		err = log.Truncate(int64(valid))
+	}
+	if err == nil {
+		_, err = log.Seek(int64(valid), io.SeekStart)
+	}
+	if err == nil {
+		err = log.Sync()
+	}
+	if err != nil {
+		_ = log.Close()
+		return err
+	}
+	thisSet.log = log
+	thisSet.logEnd = int64(valid)
+	return nil
+}
+
+// applyRecord applies the record at the beginning of data to the set. It returns
+// the length of the record and true if data starts with a complete and valid record.
+// Otherwise it returns false and the number of bytes the invalid record claims to
+// span, as far as they can be determined, so that the caller can tell whether
+// more data follows.
+func (thisSet *PersistentSet3[T]) applyRecord(data []byte) (int, int, bool) {
+	if len(data) < 1 {
+		return 0, 0, false
+	}
+	op := data[0]
+	length, n := binary.Uvarint(data[1:])
+	if n <= 0 || length > uint64(len(data)) {
+		return 0, len(data), false
+	}
+	end := 1 + n + int(length) //nolint:gosec
+	if end+4 > len(data) {
+		return 0, len(data), false
+	}
+	if crc32.ChecksumIEEE(data[:end]) != binary.LittleEndian.Uint32(data[end:]) {
+		return 0, end + 4, false
+	}
+	element, l, err := thisSet.codec.Decode(data[1+n : end])
+	if err != nil || l != int(length) { //nolint:gosec
+		return 0, end + 4, false
+	}
+	switch op {
+	case persistentOpAdd:
+		thisSet.set.Add(element)
+	case persistentOpRemove:
+		thisSet.set.Remove(element)
+	default:
+		return 0, end + 4, false
+	}
+	return end + 4, end + 4, true
+}
+
+// writeRecord appends a record to the log and syncs it if the sync policy requires it. If that fails,
+// the record is cut off again, so the log never contains an operation that has not been applied.
+func (thisSet *PersistentSet3[T]) writeRecord(op byte, element T) error {
+	encoded := thisSet.codec.Append(thisSet.elementBuffer[:0], element)
+	record := append(thisSet.recordBuffer[:0], op)
+	record = binary.AppendUvarint(record, uint64(len(encoded)))
+	record = append(record, encoded...)
+	record = binary.LittleEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+	thisSet.elementBuffer, thisSet.recordBuffer = encoded, record
+	_, err := thisSet.log.Write(record)
+	if err == nil {
+		thisSet.unsynced++
+		switch {
+		case thisSet.options.Sync == SyncAlways,
+			thisSet.options.Sync == SyncEveryN && thisSet.unsynced >= thisSet.options.SyncEvery:
+			err = thisSet.Sync()
+		}
+	}
+	if err != nil {
+		// best effort, replaying discards an incomplete last record anyway
+		if thisSet.log.Truncate(thisSet.logEnd) == nil {
+			_, _ = thisSet.log.Seek(thisSet.logEnd, io.SeekStart)
+		}
+		return err
+	}
+	thisSet.logEnd += int64(len(record))
+	thisSet.logRecords++
+	return nil
+}
+
+// snapshotIfDue writes a snapshot once the log has reached the length given by the options.
+func (thisSet *PersistentSet3[T]) snapshotIfDue() error {
+	if thisSet.options.SnapshotEvery > 0 && thisSet.logRecords >= thisSet.options.SnapshotEvery {
+		return thisSet.Snapshot()
+	}
+	return nil
+}
+
+/*
+Add inserts the element into thisSet if it is not yet in thisSet. The operation is logged (and synced, depending on the [SyncPolicy]) before it is applied,
+so if logging fails, Add returns the error and thisSet is unchanged. If an automatic snapshot fails, the element has been added and logged nevertheless.
+
+Example:
+
+	err := set.Add(42)
+*/
+func (thisSet *PersistentSet3[T]) Add(element T) error {
+	if thisSet.set.Contains(element) {
+		return nil
+	}
+	if err := thisSet.writeRecord(persistentOpAdd, element); err != nil {
+		return err
+	}
+	thisSet.set.Add(element)
+	return thisSet.snapshotIfDue()
+}
+
+/*
+Remove removes the element from thisSet if it is in thisSet. Returns whether or not the element was in thisSet. Like [PersistentSet3.Add],
+the operation is logged before it is applied, so if logging fails, Remove returns false and the error and thisSet is unchanged.
+
+Example:
+
+	removed, err := set.Remove(42)
+*/
+func (thisSet *PersistentSet3[T]) Remove(element T) (bool, error) {
+	if !thisSet.set.Contains(element) {
+		return false, nil
+	}
+	if err := thisSet.writeRecord(persistentOpRemove, element); err != nil {
+		return false, err
+	}
+	thisSet.set.Remove(element)
+	return true, thisSet.snapshotIfDue()
+}
+
+/*
+Contains returns true if the element is contained in thisSet.
+*/
+func (thisSet *PersistentSet3[T]) Contains(element T) bool {
+	return thisSet.set.Contains(element)
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *PersistentSet3[T]) Size() uint32 {
+	return thisSet.set.Size()
+}
+
+/*
+MutableRange iterates over all elements in thisSet. thisSet must not be changed during the iteration (see [Set3.MutableRange]).
+*/
+func (thisSet *PersistentSet3[T]) MutableRange() iter.Seq[T] {
+	return thisSet.set.MutableRange()
+}
+
+/*
+ToSet3 returns a copy of the current elements of thisSet as an independent, non-persistent Set3.
+*/
+func (thisSet *PersistentSet3[T]) ToSet3() *Set3[T] {
+	return thisSet.set.Clone()
+}
+
+/*
+Sync forces all logged operations to stable storage.
+*/
+func (thisSet *PersistentSet3[T]) Sync() error {
+	thisSet.unsynced = 0
+	return thisSet.log.Sync()
+}
+
+/*
+Snapshot writes the whole set to the snapshot file and truncates the log. The snapshot is written to a temporary file first and renamed afterwards,
+so a crash during Snapshot leaves either the old or the new snapshot.
+*/
+func (thisSet *PersistentSet3[T]) Snapshot() error {
+	data := []byte(persistentSnapMagic)
+	data = thisSet.set.AppendEncoded(data, thisSet.codec)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	path := filepath.Join(thisSet.dir, persistentSnapshotFile)
+	if err := writeFileSynced(path+persistentTempSuffix, data); err != nil {
+		return err
+	}
+	if err := os.Rename(path+persistentTempSuffix, path); err != nil {
+		return err
+	}
+	syncDir(thisSet.dir)
+	// the log is included in the snapshot now
+	if err := thisSet.log.Truncate(int64(len(persistentLogMagic))); err != nil {
+		return err
+	}
+	if _, err := thisSet.log.Seek(int64(len(persistentLogMagic)), io.SeekStart); err != nil {
+		return err
+	}
+	thisSet.logEnd = int64(len(persistentLogMagic))
+	thisSet.logRecords = 0
+	return thisSet.Sync()
+}
+
+/*
+Close syncs the log and closes thisSet. thisSet must not be used after Close.
+*/
+func (thisSet *PersistentSet3[T]) Close() error {
+	err := thisSet.Sync()
+	if closeErr := thisSet.log.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeFileSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncDir makes a rename in dir durable. Not all platforms support syncing
+// directories, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
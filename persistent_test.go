@@ -0,0 +1,257 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestPersistent(t *testing.T, dir string, options PersistentOptions) *PersistentSet3[uint64] {
+	set, err := OpenPersistent(dir, IntegerCodec[uint64](), options)
+	require.NoError(t, err)
+	return set
+}
+
+func TestPersistentReopen(t *testing.T) {
+	for _, options := range []PersistentOptions{
+		{Sync: SyncAlways},
+		{Sync: SyncEveryN, SyncEvery: 10},
+		{Sync: SyncNever, SnapshotEvery: 100},
+	} {
+		dir := t.TempDir()
+		set := openTestPersistent(t, dir, options)
+		assert.Equal(t, uint32(0), set.Size())
+		golden := Empty[uint64]()
+		for i := range uint64(1000) {
+			require.NoError(t, set.Add(i))
+			golden.Add(i)
+		}
+		for i := uint64(0); i < 1000; i += 3 {
+			removed, err := set.Remove(i)
+			require.NoError(t, err)
+			assert.True(t, removed)
+			golden.Remove(i)
+		}
+		removed, err := set.Remove(5000)
+		require.NoError(t, err)
+		assert.False(t, removed)
+		assert.True(t, golden.Equals(set.ToSet3()))
+		require.NoError(t, set.Close())
+
+		reopened := openTestPersistent(t, dir, options)
+		assert.True(t, golden.Equals(reopened.ToSet3()), "options %+v: reopened set shall equal the original set", options)
+		require.NoError(t, reopened.Add(5000))
+		require.NoError(t, reopened.Close())
+
+		again := openTestPersistent(t, dir, options)
+		assert.True(t, again.Contains(5000))
+		assert.Equal(t, golden.Size()+1, again.Size())
+		require.NoError(t, again.Close())
+	}
+}
+
+func TestPersistentSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{Sync: SyncNever})
+	for i := range uint64(100) {
+		require.NoError(t, set.Add(i))
+	}
+	require.NoError(t, set.Snapshot())
+	info, err := os.Stat(filepath.Join(dir, persistentLogFile))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(persistentLogMagic)), info.Size(), "snapshot shall truncate the log")
+	for i := range uint64(50) {
+		_, err := set.Remove(i)
+		require.NoError(t, err)
+	}
+	require.NoError(t, set.Close())
+
+	reopened := openTestPersistent(t, dir, PersistentOptions{})
+	assert.Equal(t, uint32(50), reopened.Size())
+	for i := range uint64(100) {
+		assert.Equal(t, i >= 50, reopened.Contains(i))
+	}
+	require.NoError(t, reopened.Close())
+}
+
+func TestPersistentIdempotentOperationsAreNotLogged(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	require.NoError(t, set.Add(1))
+	require.NoError(t, set.Add(1))
+	_, err := set.Remove(2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, set.logRecords)
+	require.NoError(t, set.Close())
+}
+
+func TestPersistentCrashRecoveryTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	for i := range uint64(10) {
+		require.NoError(t, set.Add(i*1000))
+	}
+	require.NoError(t, set.Close())
+	logPath := filepath.Join(dir, persistentLogFile)
+	complete, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+
+	// every record of 1000*i (i > 0) is 1 (op) + 1 (length) + 2 (varint) + 4 (crc) bytes long
+	recordSize := 8
+	for cut := 1; cut < recordSize; cut++ {
+		require.NoError(t, os.WriteFile(logPath, complete[:len(complete)-cut], 0o600))
+		recovered := openTestPersistent(t, dir, PersistentOptions{})
+		assert.Equal(t, uint32(9), recovered.Size(), "cut %d: incomplete last record shall be discarded", cut)
+		assert.False(t, recovered.Contains(9000))
+		// the log shall be usable after recovery
+		require.NoError(t, recovered.Add(42))
+		require.NoError(t, recovered.Close())
+
+		again := openTestPersistent(t, dir, PersistentOptions{})
+		assert.Equal(t, uint32(10), again.Size(), "cut %d: records after recovery shall be kept", cut)
+		assert.True(t, again.Contains(42))
+		require.NoError(t, again.Close())
+	}
+}
+
+func TestPersistentCrashRecoveryCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	for i := range uint64(10) {
+		require.NoError(t, set.Add(i*1000))
+	}
+	require.NoError(t, set.Close())
+	logPath := filepath.Join(dir, persistentLogFile)
+	complete, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+
+	data := bytes.Clone(complete)
+	data[len(data)-8*3+3] ^= 0xFF // corrupt the third last record
+	require.NoError(t, os.WriteFile(logPath, data, 0o600))
+	_, err = OpenPersistent(dir, IntegerCodec[uint64](), PersistentOptions{})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "records after a corrupt record shall not be dropped silently")
+	after, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, data, after, "the log shall not be truncated")
+
+	data = bytes.Clone(complete)
+	data[len(data)-8+3] ^= 0xFF // corrupt the last record, e.g. by a torn write
+	require.NoError(t, os.WriteFile(logPath, data, 0o600))
+	recovered := openTestPersistent(t, dir, PersistentOptions{})
+	assert.Equal(t, uint32(9), recovered.Size(), "a corrupt last record shall be discarded")
+	require.NoError(t, recovered.Close())
+}
+
+func TestPersistentFailedWriteLeavesSetUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	require.NoError(t, set.Add(1))
+	require.NoError(t, set.log.Close()) // let every further write fail
+	assert.Error(t, set.Add(2))
+	assert.False(t, set.Contains(2), "the element shall only be added after it has been logged")
+	removed, err := set.Remove(1)
+	assert.Error(t, err)
+	assert.False(t, removed)
+	assert.True(t, set.Contains(1), "the element shall only be removed after it has been logged")
+
+	reopened := openTestPersistent(t, dir, PersistentOptions{})
+	assert.True(t, reopened.ToSet3().Equals(From[uint64](1)))
+	require.NoError(t, reopened.Close())
+}
+
+func TestPersistentCrashDuringCreation(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, persistentLogFile), []byte(persistentLogMagic[:3]), 0o600))
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	require.NoError(t, set.Add(1))
+	require.NoError(t, set.Close())
+	reopened := openTestPersistent(t, dir, PersistentOptions{})
+	assert.True(t, reopened.Contains(1))
+	require.NoError(t, reopened.Close())
+}
+
+func TestPersistentCrashDuringSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	for i := range uint64(10) {
+		require.NoError(t, set.Add(i))
+	}
+	_, err := set.Remove(3)
+	require.NoError(t, err)
+	require.NoError(t, set.Close())
+	log, err := os.ReadFile(filepath.Join(dir, persistentLogFile))
+	require.NoError(t, err)
+
+	// simulate a crash after the snapshot was renamed but before the log was truncated
+	set = openTestPersistent(t, dir, PersistentOptions{})
+	require.NoError(t, set.Snapshot())
+	require.NoError(t, set.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, persistentLogFile), log, 0o600))
+	// and a left-over temporary snapshot file
+	require.NoError(t, os.WriteFile(filepath.Join(dir, persistentSnapshotFile+persistentTempSuffix), []byte("garbage"), 0o600))
+
+	recovered := openTestPersistent(t, dir, PersistentOptions{})
+	assert.Equal(t, uint32(9), recovered.Size())
+	assert.False(t, recovered.Contains(3))
+	require.NoError(t, recovered.Close())
+}
+
+func TestPersistentInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	set := openTestPersistent(t, dir, PersistentOptions{})
+	require.NoError(t, set.Add(1))
+	require.NoError(t, set.Snapshot())
+	require.NoError(t, set.Close())
+
+	snapPath := filepath.Join(dir, persistentSnapshotFile)
+	snap, err := os.ReadFile(snapPath)
+	require.NoError(t, err)
+	snap[len(snap)-5] ^= 0xFF
+	require.NoError(t, os.WriteFile(snapPath, snap, 0o600))
+	_, err = OpenPersistent(dir, IntegerCodec[uint64](), PersistentOptions{})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "corrupt snapshot shall be detected")
+
+	other := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(other, persistentLogFile), []byte("not a log file"), 0o600))
+	_, err = OpenPersistent(other, IntegerCodec[uint64](), PersistentOptions{})
+	assert.True(t, errors.Is(err, ErrInvalidFormat), "foreign log file shall not be overwritten")
+}
+
+func TestPersistentStrings(t *testing.T) {
+	dir := t.TempDir()
+	set, err := OpenPersistent(dir, StringCodec[string](), PersistentOptions{SnapshotEvery: 7})
+	require.NoError(t, err)
+	keys := genStringData(12, 100)
+	for _, k := range keys {
+		require.NoError(t, set.Add(k))
+	}
+	require.NoError(t, set.Close())
+	reopened, err := OpenPersistent(dir, StringCodec[string](), PersistentOptions{})
+	require.NoError(t, err)
+	assert.True(t, FromArray(keys).Equals(reopened.ToSet3()))
+	count := 0
+	for range reopened.MutableRange() {
+		count++
+	}
+	assert.Equal(t, len(keys), count)
+	require.NoError(t, reopened.Close())
+}
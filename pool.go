@@ -0,0 +1,115 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math/bits"
+	"sync"
+)
+
+/*
+Pool recycles Set3 instances to reduce allocations and GC churn on hot paths that build many short-lived sets.
+
+Sets are kept in capacity classes: class i holds sets with at least 2^i groups. [Pool.Get] hands out a cleared set from the smallest class that fits
+the requested capacity, [Pool.Put] clears a set and files it under the largest class it fits. Sets whose capacity exceeds the maximum capacity of
+the pool are not pooled but left to the garbage collector. Like [sync.Pool], a Pool may drop pooled sets at any time and is safe for concurrent use.
+
+Example:
+
+	pool := NewPool[uint64](10_000)
+	set := pool.Get(100)
+	set.Add(42)
+	// ... use set
+	pool.Put(set) // set must not be used after this call
+*/
+type Pool[T comparable] struct {
+	classes      [33]sync.Pool
+	maxNumGroups uint32
+}
+
+/*
+NewPool creates a new Pool. Sets that are considerably bigger than required for maxCapacity elements are not pooled.
+
+Example:
+
+	pool := NewPool[uint64](10_000)
+*/
+func NewPool[T comparable](maxCapacity uint32) *Pool[T] {
+	maxClass := bits.Len32(calcReqNrOfGroups(maxCapacity) - 1)
+	return &Pool[T]{
+		maxNumGroups: 1 << maxClass,
+	}
+}
+
+/*
+Get returns an empty Set3 that can hold at least capacity elements without rehashing. The set is either taken from the pool or newly allocated.
+Sets returned by Get use the default options (see [Empty]).
+
+Example:
+
+	pool := NewPool[uint64](10_000)
+	set := pool.Get(100)
+*/
+func (thisPool *Pool[T]) Get(capacity uint32) *Set3[T] {
+	reqNrOfGroups := calcReqNrOfGroups(capacity)
+	if calcElementLimit(reqNrOfGroups, set3maxAvgGroupLoad) < capacity {
+		reqNrOfGroups++ // calcReqNrOfGroups rounds to the nearest number of groups
+	}
+	if reqNrOfGroups > thisPool.maxNumGroups {
+		return EmptyWithCapacity[T](capacity)
+	}
+	class := bits.Len32(reqNrOfGroups - 1) // smallest class with 2^class >= reqNrOfGroups
+	if pooled := thisPool.classes[class].Get(); pooled != nil {
+		return pooled.(*Set3[T]) //nolint:forcetypeassert
+	}
+	return emptyWithNumGroups[T](1<<class, defaultOptions())
+}
+
+/*
+Put clears the given set and returns it to the pool. The set must not be used by the caller after this call.
+
+If set is nil, too big for this pool, or has been created with options (see [EmptyWithOptions]) or an allocator (see [EmptyWithBuffers]),
+Put does nothing, as [Pool.Get] must only hand out sets with the default options.
+
+Example:
+
+	pool := NewPool[uint64](10_000)
+	set := pool.Get(100)
+	// ... use set
+	pool.Put(set)
+*/
+func (thisPool *Pool[T]) Put(set *Set3[T]) {
+	if set == nil {
+		return
+	}
+	if len(set.groupCtrl) == 0 || uint32(len(set.groupCtrl)) > thisPool.maxNumGroups { //nolint:gosec
+		return
+	}
+	if set.allocator != nil || !hasDefaultOptions(set) {
+		return
+	}
+	set.Clear()
+	numGroups := uint32(len(set.groupCtrl)) //nolint:gosec
+	set.options.minNumGroups = numGroups    // like a set from Get, see emptyWithNumGroups
+	class := bits.Len32(numGroups) - 1      // largest class with 2^class <= numGroups
+	thisPool.classes[class].Put(set)
+}
+
+// hasDefaultOptions returns true if set has the default options. The initial capacity does not matter.
+func hasDefaultOptions[T comparable](set *Set3[T]) bool {
+	options := set.options
+	options.minNumGroups = 0
+	return options == defaultOptions()
+}
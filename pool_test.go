@@ -0,0 +1,135 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolGet(t *testing.T) {
+	pool := NewPool[uint64](10_000)
+	for _, capa := range []uint32{0, 1, 7, 100, 1000, 10_000} {
+		set := pool.Get(capa)
+		assert.Equal(t, uint32(0), set.Size())
+		assert.GreaterOrEqual(t, set.elementLimit, capa, "set shall hold %d elements without rehashing", capa)
+		numGroups := len(set.groupCtrl)
+		for i := range capa {
+			set.Add(uint64(i))
+		}
+		assert.Equal(t, numGroups, len(set.groupCtrl), "set shall not rehash for %d elements", capa)
+	}
+	huge := pool.Get(1_000_000)
+	assert.GreaterOrEqual(t, huge.elementLimit, uint32(1_000_000))
+}
+
+func TestPoolPutAndGet(t *testing.T) {
+	pool := NewPool[uint64](10_000)
+	set := pool.Get(100)
+	for i := range uint64(100) {
+		set.Add(i)
+	}
+	pool.Put(set)
+	assert.Equal(t, uint32(0), set.Size(), "set shall be cleared when put into the pool")
+
+	// sync.Pool may drop objects at any time, so we cannot rely on getting the same
+	// instance back, but whatever we get must be empty and big enough
+	for range 10 {
+		recycled := pool.Get(100)
+		assert.Equal(t, uint32(0), recycled.Size())
+		assert.GreaterOrEqual(t, recycled.elementLimit, uint32(100))
+		for i := range uint64(100) {
+			assert.False(t, recycled.Contains(i))
+		}
+		recycled.Add(7)
+		pool.Put(recycled)
+	}
+}
+
+func TestPoolClasses(t *testing.T) {
+	pool := NewPool[uint64](10_000)
+	grown := pool.Get(10)
+	for i := range uint64(1000) {
+		grown.Add(i)
+	}
+	pool.Put(grown)
+	for range 10 {
+		small := pool.Get(10)
+		assert.Less(t, len(small.groupCtrl), len(grown.groupCtrl), "a small request shall not receive a set from a bigger class")
+		pool.Put(small)
+	}
+	big := pool.Get(1000)
+	assert.GreaterOrEqual(t, big.elementLimit, uint32(1000))
+}
+
+func TestPoolNilAndOversized(t *testing.T) {
+	pool := NewPool[uint64](100)
+	pool.Put(nil)
+	huge := EmptyWithCapacity[uint64](1_000_000)
+	huge.Add(1)
+	pool.Put(huge)
+	assert.Equal(t, uint32(1), huge.Size(), "oversized sets shall not be touched by the pool")
+}
+
+func TestPoolRejectsCustomSets(t *testing.T) {
+	pool := NewPool[uint64](1000)
+	custom := EmptyWithOptions[uint64](100, WithMaxLoad(2.0))
+	custom.Add(1)
+	pool.Put(custom)
+	assert.Equal(t, uint32(1), custom.Size(), "sets with options shall not be touched by the pool")
+
+	numGroups := RequiredGroups(100)
+	allocated, err := EmptyWithBuffers(make([]uint64, numGroups), make([][GroupSize]uint64, numGroups), func(n uint32) ([]uint64, [][GroupSize]uint64) {
+		return make([]uint64, n), make([][GroupSize]uint64, n)
+	})
+	require.NoError(t, err)
+	allocated.Add(1)
+	pool.Put(allocated)
+	assert.Equal(t, uint32(1), allocated.Size(), "sets with an allocator shall not be touched by the pool")
+
+	for range 10 {
+		set := pool.Get(100)
+		assert.NotSame(t, custom, set)
+		assert.NotSame(t, allocated, set)
+		assert.GreaterOrEqual(t, set.elementLimit, uint32(100))
+	}
+
+	plain := EmptyWithCapacity[uint64](100)
+	pool.Put(plain)
+	assert.Equal(t, uint32(len(plain.groupCtrl)), plain.options.minNumGroups) //nolint:gosec
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	pool := NewPool[uint64](10_000)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := range 1000 {
+				set := pool.Get(uint32(round % 200))
+				assert.Equal(t, uint32(0), set.Size())
+				for i := range uint64(round % 200) {
+					set.Add(i + uint64(g))
+				}
+				pool.Put(set)
+			}
+		}()
+	}
+	wg.Wait()
+}
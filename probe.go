@@ -0,0 +1,172 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"slices"
+	"strings"
+)
+
+/*
+set3table holds the control words of the Swiss table variants of this package (MultiSet3, OrderedSet3, SetFunc, ...) along with
+the bookkeeping of their slots. The variants embed it next to their own slot arrays, which are indexed by the same group and slot,
+and use its methods for probing, claiming and releasing slots, growing and iterating.
+*/
+type set3table struct {
+	resident     uint32 // number of slots in use by elements or tombstones
+	dead         uint32 // number of tombstones
+	elementLimit uint32
+	groupCtrl    []uint64
+}
+
+// allocate replaces the control words by numGroups empty groups.
+func (thisTable *set3table) allocate(numGroups uint32) {
+	thisTable.elementLimit = calcElementLimit(numGroups, set3maxAvgGroupLoad)
+	thisTable.groupCtrl = make([]uint64, numGroups)
+	thisTable.reset()
+}
+
+// reset marks all slots as empty.
+func (thisTable *set3table) reset() {
+	for i := range thisTable.groupCtrl {
+		thisTable.groupCtrl[i] = set3AllEmpty
+	}
+	thisTable.resident, thisTable.dead = 0, 0
+}
+
+func (thisTable *set3table) clone() set3table {
+	result := *thisTable
+	result.groupCtrl = slices.Clone(thisTable.groupCtrl)
+	return result
+}
+
+func (thisTable *set3table) size() uint32 {
+	return thisTable.resident - thisTable.dead
+}
+
+// full returns true if the table has to be rehashed before another slot may be claimed.
+func (thisTable *set3table) full() bool {
+	return thisTable.resident >= thisTable.elementLimit
+}
+
+// nextGroupCount returns the number of groups to rehash a full table to. See Set3.calcNextGroupCount.
+func (thisTable *set3table) nextGroupCount() uint32 {
+	current := uint32(len(thisTable.groupCtrl)) //nolint:gosec
+	if thisTable.dead >= (thisTable.resident / 2) {
+		// enough tombstones to make room by rehashing in place
+		return current
+	}
+	return max(clampToUint32(math.Ceil(float64(current)*set3defaultGrowthFactor)), current)
+}
+
+// probe walks the probe sequence of hash and calls match for every slot whose control byte matches H2.
+// It returns the group and slot of the first match, or found == false once the probe sequence reaches
+// a group with an empty slot.
+func (thisTable *set3table) probe(hash uint64, match func(group uint64, slot int) bool) (group uint64, slot int, found bool) {
+	H2 := (hash & 0x0000_0000_0000_007f)
+	groupCount := uint64(len(thisTable.groupCtrl))
+	currentGroupIndex := getGroupIndex(hash, groupCount)
+	for {
+		ctrl := thisTable.groupCtrl[currentGroupIndex]
+		H2matches := set3ctlrMatchH2(ctrl, H2)
+		for H2matches != 0 {
+			s := set3nextMatch(&H2matches)
+			if match(currentGroupIndex, s) {
+				return currentGroupIndex, s, true
+			}
+		}
+		if set3ctlrMatchEmpty(ctrl) != 0 {
+			return 0, 0, false
+		}
+		currentGroupIndex++ // carousel through all groups
+		if currentGroupIndex >= groupCount {
+			currentGroupIndex = 0
+		}
+	}
+}
+
+// claim marks the first empty slot in the probe sequence of hash with H2 and returns its group and slot.
+// The caller must make sure that the table is not full.
+func (thisTable *set3table) claim(hash uint64) (group uint64, slot int) {
+	H2 := (hash & 0x0000_0000_0000_007f)
+	groupCount := uint64(len(thisTable.groupCtrl))
+	currentGroupIndex := getGroupIndex(hash, groupCount)
+	for {
+		ctrl := thisTable.groupCtrl[currentGroupIndex]
+		emptyMatches := set3ctlrMatchEmpty(ctrl)
+		if emptyMatches != 0 {
+			s := set3nextMatch(&emptyMatches)
+			thisTable.groupCtrl[currentGroupIndex] = setCTRLat(ctrl, H2, s)
+			thisTable.resident++
+			return currentGroupIndex, s
+		}
+		currentGroupIndex++ // carousel through all groups
+		if currentGroupIndex >= groupCount {
+			currentGroupIndex = 0
+		}
+	}
+}
+
+// release marks a slot as free after its element has been removed. See Set3.remove: a tombstone is only
+// needed if the group has no empty slot, as otherwise every probe sequence through this group stops here anyway.
+func (thisTable *set3table) release(group uint64, slot int) {
+	ctrl := thisTable.groupCtrl[group]
+	if set3ctlrMatchEmpty(ctrl) != 0 {
+		thisTable.groupCtrl[group] = setCTRLat(ctrl, set3Empty, slot)
+		thisTable.resident--
+		return
+	}
+	thisTable.groupCtrl[group] = setCTRLat(ctrl, set3Deleted, slot)
+	thisTable.dead++
+}
+
+// slots iterates over the group and slot of every element.
+func (thisTable *set3table) slots() iter.Seq2[uint64, int] {
+	return func(yield func(uint64, int) bool) {
+		for g, ctrl := range thisTable.groupCtrl {
+			if ctrl&set3hiBits != set3hiBits { // not all empty or deleted
+				for s := range set3groupSize {
+					if isAnElementAt(ctrl, s) && !yield(uint64(g), s) { //nolint:gosec
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// set3roster returns the elements in Roster notation, e.g. "{1,2,3}", each one formatted by format.
+func set3roster[E any](elements iter.Seq[E], format func(E) string) string {
+	var builder strings.Builder
+	builder.WriteString("{")
+	first := true
+	for e := range elements {
+		if !first {
+			builder.WriteString(",")
+		}
+		builder.WriteString(format(e))
+		first = false
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// set3formatValue formats an element in the default format, see [Set3.String].
+func set3formatValue[E any](e E) string {
+	return fmt.Sprintf("%v", e)
+}
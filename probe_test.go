@@ -0,0 +1,76 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet3TableClaimProbeRelease(t *testing.T) {
+	var table set3table
+	table.allocate(1)
+	slot := make([]uint64, set3groupSize)
+	hash := uint64(0x1234_5678_9abc_def0)
+	// all elements share H2 and the group, so they collide in every probe
+	for i := range uint64(5) {
+		g, s := table.claim(hash)
+		assert.Equal(t, uint64(0), g)
+		slot[s] = i
+	}
+	assert.Equal(t, uint32(5), table.size())
+	g, s, found := table.probe(hash, func(_ uint64, s int) bool { return slot[s] == 3 })
+	assert.True(t, found)
+	assert.Equal(t, uint64(3), slot[s])
+	table.release(g, s)
+	assert.Equal(t, uint32(4), table.size())
+	assert.Equal(t, uint32(0), table.dead, "the group has empty slots, so no tombstone is needed")
+	_, _, found = table.probe(hash, func(_ uint64, s int) bool { return slot[s] == 3 })
+	assert.False(t, found)
+	remaining := []uint64{}
+	for _, s := range table.slots() {
+		remaining = append(remaining, slot[s])
+	}
+	assert.ElementsMatch(t, []uint64{0, 1, 2, 4}, remaining)
+}
+
+func TestSet3TableTombstones(t *testing.T) {
+	var table set3table
+	table.allocate(2)
+	hash := uint64(42)
+	for range 2 * set3groupSize {
+		table.claim(hash)
+	}
+	g := getGroupIndex(hash, 2)
+	table.release(g, 0)
+	assert.Equal(t, uint32(1), table.dead, "a full group needs a tombstone")
+	assert.Equal(t, uint32(2*set3groupSize), table.resident)
+	assert.Equal(t, uint32(2*set3groupSize-1), table.size())
+	assert.Equal(t, uint32(4), table.nextGroupCount())
+
+	clone := table.clone()
+	clone.reset()
+	assert.Equal(t, uint32(0), clone.size())
+	assert.Equal(t, uint32(2*set3groupSize-1), table.size(), "the clone must not share the control words")
+}
+
+func TestSet3Roster(t *testing.T) {
+	assert.Equal(t, "{}", set3roster(slices.Values([]int{}), strconv.Itoa))
+	assert.Equal(t, "{1}", set3roster(slices.Values([]int{1}), strconv.Itoa))
+	assert.Equal(t, "{1,2,3}", set3roster(slices.Values([]int{1, 2, 3}), set3formatValue))
+}
@@ -0,0 +1,829 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+const (
+	roaringArray = iota
+	roaringBitmap
+	roaringRun
+
+	roaringMaxArraySize = 4096
+	roaringBitmapWords  = 1 << 16 / 64
+
+	roaringCookieNoRuns = 12346
+	roaringCookieRuns   = 12347
+	roaringNoOffsets    = 4 // containers with runs below which the format omits the offset header
+)
+
+/*
+RoaringSet32 is a compressed set of uint32 values in the style of Roaring bitmaps (https://roaringbitmap.org). The values are partitioned
+by their upper 16 bits into containers of up to 65536 values. Depending on its content, a container is a sorted array (up to 4096 values),
+a bitmap of 8 KiB, or a list of runs of consecutive values (see [RoaringSet32.RunOptimize]). For large and clustered sets, e.g. database ids,
+a RoaringSet32 needs only a fraction of the memory of a Set3, and And, Or and AndNot work on whole containers at a time.
+
+A RoaringSet32 iterates over its values in ascending order. It is serialized in the portable format that is shared by the Roaring implementations of other languages.
+*/
+type RoaringSet32 struct {
+	keys       []uint16
+	containers []*roaringContainer
+}
+
+type roaringContainer struct {
+	kind   uint8
+	card   int
+	values []uint16 // roaringArray: sorted values, roaringRun: pairs of start and length-1
+	bitmap []uint64 // roaringBitmap: roaringBitmapWords words
+}
+
+/*
+NewRoaringSet32 creates a new and empty RoaringSet32.
+
+Example:
+
+	set := NewRoaringSet32()
+	set.Add(1)
+*/
+func NewRoaringSet32() *RoaringSet32 {
+	return &RoaringSet32{}
+}
+
+/*
+RoaringSet32From creates a new RoaringSet32 containing all values passed as arguments.
+
+Example:
+
+	set := RoaringSet32From(1, 2, 3, 100_000)
+*/
+func RoaringSet32From(args ...uint32) *RoaringSet32 {
+	result := NewRoaringSet32()
+	for _, v := range args {
+		result.Add(v)
+	}
+	return result
+}
+
+/*
+RoaringSet32FromSet3 creates a new RoaringSet32 containing all elements of set. nil is interpreted as empty set.
+
+Example:
+
+	ids := From[uint32](1, 2, 3)
+	compressed := RoaringSet32FromSet3(ids)
+*/
+func RoaringSet32FromSet3(set *Set3[uint32]) *RoaringSet32 {
+	if set == nil {
+		return NewRoaringSet32()
+	}
+	// adding sorted values appends to the last container, which is much faster than random inserts
+	values := set.ToArray()
+	slices.Sort(values)
+	result := NewRoaringSet32()
+	for _, v := range values {
+		result.Add(v)
+	}
+	return result
+}
+
+/*
+ToSet3 creates a new Set3 containing all values of thisSet.
+
+Example:
+
+	ids := compressed.ToSet3()
+*/
+func (thisSet *RoaringSet32) ToSet3() *Set3[uint32] {
+	result := EmptyWithCapacity[uint32](uint32(min(thisSet.Cardinality(), math.MaxUint32)))
+	for v := range thisSet.MutableRange() {
+		result.Add(v)
+	}
+	return result
+}
+
+/*
+Cardinality returns the number of values in thisSet. Unlike Size of a Set3, the result may exceed the range of uint32 if thisSet contains all uint32 values.
+*/
+func (thisSet *RoaringSet32) Cardinality() uint64 {
+	result := uint64(0)
+	for _, c := range thisSet.containers {
+		result += uint64(c.card)
+	}
+	return result
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *RoaringSet32) Clone() *RoaringSet32 {
+	result := &RoaringSet32{
+		keys:       slices.Clone(thisSet.keys),
+		containers: make([]*roaringContainer, len(thisSet.containers)),
+	}
+	for i, c := range thisSet.containers {
+		result.containers[i] = c.clone()
+	}
+	return result
+}
+
+/*
+Checks if thisSet contains the value.
+*/
+func (thisSet *RoaringSet32) Contains(value uint32) bool {
+	i, found := slices.BinarySearch(thisSet.keys, uint16(value>>16))
+	return found && thisSet.containers[i].contains(uint16(value)) //nolint:gosec
+}
+
+/*
+Inserts the value into thisSet if it is not yet in thisSet.
+*/
+func (thisSet *RoaringSet32) Add(value uint32) {
+	key := uint16(value >> 16)
+	i, found := slices.BinarySearch(thisSet.keys, key)
+	if !found {
+		thisSet.keys = slices.Insert(thisSet.keys, i, key)
+		thisSet.containers = slices.Insert(thisSet.containers, i, &roaringContainer{kind: roaringArray})
+	}
+	thisSet.containers[i].add(uint16(value)) //nolint:gosec
+}
+
+/*
+Removes the value from thisSet if it is in thisSet. Returns true if the value was removed.
+*/
+func (thisSet *RoaringSet32) Remove(value uint32) bool {
+	i, found := slices.BinarySearch(thisSet.keys, uint16(value>>16))
+	if !found || !thisSet.containers[i].remove(uint16(value)) { //nolint:gosec
+		return false
+	}
+	if thisSet.containers[i].card == 0 {
+		thisSet.keys = slices.Delete(thisSet.keys, i, i+1)
+		thisSet.containers = slices.Delete(thisSet.containers, i, i+1)
+	}
+	return true
+}
+
+/*
+Returns true if thisSet and thatSet contain the same values. If thatSet is nil, Equals returns true if and only if thisSet is empty.
+*/
+func (thisSet *RoaringSet32) Equals(thatSet *RoaringSet32) bool {
+	if thatSet == nil {
+		return len(thisSet.keys) == 0
+	}
+	if !slices.Equal(thisSet.keys, thatSet.keys) {
+		return false
+	}
+	for i, c := range thisSet.containers {
+		if c.card != thatSet.containers[i].card || roaringAndNot(c, thatSet.containers[i]).card != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+And creates a new RoaringSet32 as a mathematical intersection between thisSet and thatSet. If thatSet is nil, And returns an empty set.
+
+Example:
+
+	a := RoaringSet32From(1, 2, 3)
+	b := RoaringSet32From(3, 4)
+	c := a.And(b) // a and b are not altered, c will contain 3
+*/
+func (thisSet *RoaringSet32) And(thatSet *RoaringSet32) *RoaringSet32 {
+	result := NewRoaringSet32()
+	if thatSet == nil {
+		return result
+	}
+	i, j := 0, 0
+	for i < len(thisSet.keys) && j < len(thatSet.keys) {
+		switch {
+		case thisSet.keys[i] < thatSet.keys[j]:
+			i++
+		case thisSet.keys[i] > thatSet.keys[j]:
+			j++
+		default:
+			result.appendContainer(thisSet.keys[i], roaringAnd(thisSet.containers[i], thatSet.containers[j]))
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+/*
+Or creates a new RoaringSet32 as a mathematical union of thisSet and thatSet. If thatSet is nil, Or returns a clone of thisSet.
+
+Example:
+
+	a := RoaringSet32From(1, 2, 3)
+	b := RoaringSet32From(3, 4)
+	c := a.Or(b) // a and b are not altered, c will contain 1, 2, 3, 4
+*/
+func (thisSet *RoaringSet32) Or(thatSet *RoaringSet32) *RoaringSet32 {
+	if thatSet == nil {
+		return thisSet.Clone()
+	}
+	result := NewRoaringSet32()
+	i, j := 0, 0
+	for i < len(thisSet.keys) || j < len(thatSet.keys) {
+		switch {
+		case j == len(thatSet.keys) || (i < len(thisSet.keys) && thisSet.keys[i] < thatSet.keys[j]):
+			result.appendContainer(thisSet.keys[i], thisSet.containers[i].clone())
+			i++
+		case i == len(thisSet.keys) || thisSet.keys[i] > thatSet.keys[j]:
+			result.appendContainer(thatSet.keys[j], thatSet.containers[j].clone())
+			j++
+		default:
+			result.appendContainer(thisSet.keys[i], roaringOr(thisSet.containers[i], thatSet.containers[j]))
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+/*
+AndNot creates a new RoaringSet32 as a mathematical difference between thisSet and thatSet, i.e., with the values of thisSet that are not in thatSet.
+If thatSet is nil, AndNot returns a clone of thisSet.
+
+Example:
+
+	a := RoaringSet32From(1, 2, 3)
+	b := RoaringSet32From(3, 4)
+	c := a.AndNot(b) // a and b are not altered, c will contain 1, 2
+*/
+func (thisSet *RoaringSet32) AndNot(thatSet *RoaringSet32) *RoaringSet32 {
+	if thatSet == nil {
+		return thisSet.Clone()
+	}
+	result := NewRoaringSet32()
+	j := 0
+	for i, key := range thisSet.keys {
+		for j < len(thatSet.keys) && thatSet.keys[j] < key {
+			j++
+		}
+		if j < len(thatSet.keys) && thatSet.keys[j] == key {
+			result.appendContainer(key, roaringAndNot(thisSet.containers[i], thatSet.containers[j]))
+		} else {
+			result.appendContainer(key, thisSet.containers[i].clone())
+		}
+	}
+	return result
+}
+
+func (thisSet *RoaringSet32) appendContainer(key uint16, c *roaringContainer) {
+	if c.card > 0 {
+		thisSet.keys = append(thisSet.keys, key)
+		thisSet.containers = append(thisSet.containers, c)
+	}
+}
+
+/*
+RunOptimize converts all containers of thisSet that consist of long runs of consecutive values into run containers, if this saves memory.
+Call it after a set has been built, e.g., before serializing it. Adding or removing values converts run containers back.
+*/
+func (thisSet *RoaringSet32) RunOptimize() {
+	for _, c := range thisSet.containers {
+		c.runOptimize()
+	}
+}
+
+/*
+Iterates over all values in thisSet in ascending order.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove values to or from thisSet during the itration, iterate over [RoaringSet32.ToArray].
+*/
+func (thisSet *RoaringSet32) MutableRange() iter.Seq[uint32] {
+	return func(yield func(uint32) bool) {
+		for i, c := range thisSet.containers {
+			high := uint32(thisSet.keys[i]) << 16
+			if !c.iterate(func(low uint16) bool { return yield(high | uint32(low)) }) {
+				return
+			}
+		}
+	}
+}
+
+/*
+ToArray allocates an array and adds all values of thisSet to it in ascending order.
+*/
+func (thisSet *RoaringSet32) ToArray() []uint32 {
+	result := make([]uint32, 0, thisSet.Cardinality())
+	for v := range thisSet.MutableRange() {
+		result = append(result, v)
+	}
+	return result
+}
+
+/*
+AppendEncoded appends thisSet in the portable Roaring serialization format to dst and returns the extended buffer.
+The format is specified at https://github.com/RoaringBitmap/RoaringFormatSpec and can be read by other Roaring implementations.
+
+Example:
+
+	buf := set.AppendEncoded(nil)
+*/
+func (thisSet *RoaringSet32) AppendEncoded(dst []byte) []byte {
+	n := len(thisSet.containers)
+	hasRuns := false
+	for _, c := range thisSet.containers {
+		hasRuns = hasRuns || c.kind == roaringRun
+	}
+	withOffsets := !hasRuns || n >= roaringNoOffsets
+	headerSize := 8 + 4*n
+	if hasRuns {
+		dst = binary.LittleEndian.AppendUint32(dst, roaringCookieRuns|uint32(n-1)<<16) //nolint:gosec
+		flags := make([]byte, (n+7)/8)
+		for i, c := range thisSet.containers {
+			if c.kind == roaringRun {
+				flags[i/8] |= 1 << (i % 8)
+			}
+		}
+		dst = append(dst, flags...)
+		headerSize = 4 + len(flags) + 4*n
+	} else {
+		dst = binary.LittleEndian.AppendUint32(dst, roaringCookieNoRuns)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(n)) //nolint:gosec
+	}
+	for i, c := range thisSet.containers {
+		dst = binary.LittleEndian.AppendUint16(dst, thisSet.keys[i])
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(c.card-1)) //nolint:gosec
+	}
+	if withOffsets {
+		headerSize += 4 * n
+		offset := headerSize
+		for _, c := range thisSet.containers {
+			dst = binary.LittleEndian.AppendUint32(dst, uint32(offset)) //nolint:gosec
+			offset += c.encodedSize()
+		}
+	}
+	for _, c := range thisSet.containers {
+		dst = c.appendEncoded(dst)
+	}
+	return dst
+}
+
+/*
+RoaringSet32FromEncoded restores a RoaringSet32 from the portable Roaring serialization format, as written by [RoaringSet32.AppendEncoded] or other Roaring implementations.
+It returns the set along with the number of bytes read from data.
+
+Returns an error wrapping [ErrInvalidFormat] if data does not start with a valid serialized set.
+
+Example:
+
+	set, _, err := RoaringSet32FromEncoded(buf)
+*/
+func RoaringSet32FromEncoded(data []byte) (*RoaringSet32, int, error) {
+	if len(data) < 4 {
+		return nil, 0, fmt.Errorf("%w: not a Roaring bitmap", ErrInvalidFormat)
+	}
+	cookie := binary.LittleEndian.Uint32(data)
+	var n int
+	hasRuns := false
+	pos := 4
+	switch {
+	case cookie&0xFFFF == roaringCookieRuns:
+		n = int(cookie>>16) + 1
+		hasRuns = true
+		pos += (n + 7) / 8
+	case cookie == roaringCookieNoRuns:
+		if len(data) < 8 {
+			return nil, 0, fmt.Errorf("%w: truncated header", ErrInvalidFormat)
+		}
+		n = int(binary.LittleEndian.Uint32(data[pos:]))
+		if n > 1<<16 {
+			return nil, 0, fmt.Errorf("%w: too many containers", ErrInvalidFormat)
+		}
+		pos += 4
+	default:
+		return nil, 0, fmt.Errorf("%w: not a Roaring bitmap", ErrInvalidFormat)
+	}
+	runFlags := pos - (n+7)/8
+	descriptive := pos
+	pos += 4 * n
+	if !hasRuns || n >= roaringNoOffsets {
+		pos += 4 * n // the offsets are not needed for sequential reading
+	}
+	if len(data) < pos {
+		return nil, 0, fmt.Errorf("%w: truncated header", ErrInvalidFormat)
+	}
+	result := &RoaringSet32{keys: make([]uint16, n), containers: make([]*roaringContainer, n)}
+	for i := range n {
+		key := binary.LittleEndian.Uint16(data[descriptive+4*i:])
+		card := int(binary.LittleEndian.Uint16(data[descriptive+4*i+2:])) + 1
+		if i > 0 && key <= result.keys[i-1] {
+			return nil, 0, fmt.Errorf("%w: keys not in ascending order", ErrInvalidFormat)
+		}
+		isRun := hasRuns && data[runFlags+i/8]&(1<<(i%8)) != 0
+		c, l, err := decodeRoaringContainer(data[pos:], card, isRun)
+		if err != nil {
+			return nil, 0, err
+		}
+		result.keys[i] = key
+		result.containers[i] = c
+		pos += l
+	}
+	return result, pos, nil
+}
+
+func (c *roaringContainer) clone() *roaringContainer {
+	return &roaringContainer{kind: c.kind, card: c.card, values: slices.Clone(c.values), bitmap: slices.Clone(c.bitmap)}
+}
+
+func (c *roaringContainer) contains(x uint16) bool {
+	switch c.kind {
+	case roaringArray:
+		_, found := slices.BinarySearch(c.values, x)
+		return found
+	case roaringBitmap:
+		return c.bitmap[x/64]&(1<<(x%64)) != 0
+	default:
+		// find the last run that starts at or before x
+		lo, hi := 0, len(c.values)/2
+		for lo < hi {
+			mid := int(uint(lo+hi) >> 1)
+			if c.values[2*mid] <= x {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		return lo > 0 && uint32(x) <= uint32(c.values[2*(lo-1)])+uint32(c.values[2*(lo-1)+1])
+	}
+}
+
+func (c *roaringContainer) add(x uint16) bool {
+	if c.kind == roaringRun {
+		if c.contains(x) {
+			return false
+		}
+		c.materialize()
+	}
+	if c.kind == roaringBitmap {
+		mask := uint64(1) << (x % 64)
+		if c.bitmap[x/64]&mask != 0 {
+			return false
+		}
+		c.bitmap[x/64] |= mask
+		c.card++
+		return true
+	}
+	i, found := slices.BinarySearch(c.values, x)
+	if found {
+		return false
+	}
+	c.values = slices.Insert(c.values, i, x)
+	c.card++
+	if c.card > roaringMaxArraySize {
+		c.convertToBitmap()
+	}
+	return true
+}
+
+func (c *roaringContainer) remove(x uint16) bool {
+	if !c.contains(x) {
+		return false
+	}
+	c.materialize()
+	c.card--
+	if c.kind == roaringBitmap {
+		c.bitmap[x/64] &^= 1 << (x % 64)
+		if c.card <= roaringMaxArraySize {
+			c.convertToArray()
+		}
+		return true
+	}
+	i, _ := slices.BinarySearch(c.values, x)
+	c.values = slices.Delete(c.values, i, i+1)
+	return true
+}
+
+// materialize converts a run container to an array or bitmap container.
+func (c *roaringContainer) materialize() {
+	if c.kind != roaringRun {
+		return
+	}
+	if c.card > roaringMaxArraySize {
+		c.bitmap = c.toBitmap()
+		c.values = nil
+		c.kind = roaringBitmap
+		return
+	}
+	values := make([]uint16, 0, c.card)
+	c.iterate(func(x uint16) bool {
+		values = append(values, x)
+		return true
+	})
+	c.values = values
+	c.kind = roaringArray
+}
+
+func (c *roaringContainer) convertToBitmap() {
+	c.bitmap = c.toBitmap()
+	c.values = nil
+	c.kind = roaringBitmap
+}
+
+func (c *roaringContainer) convertToArray() {
+	values := make([]uint16, 0, c.card)
+	c.iterate(func(x uint16) bool {
+		values = append(values, x)
+		return true
+	})
+	c.values = values
+	c.bitmap = nil
+	c.kind = roaringArray
+}
+
+// toBitmap returns the content of c as bitmap. The result must not be modified if c is a bitmap container.
+func (c *roaringContainer) toBitmap() []uint64 {
+	if c.kind == roaringBitmap {
+		return c.bitmap
+	}
+	result := make([]uint64, roaringBitmapWords)
+	if c.kind == roaringArray {
+		for _, x := range c.values {
+			result[x/64] |= 1 << (x % 64)
+		}
+		return result
+	}
+	for i := 0; i < len(c.values); i += 2 {
+		start, end := int(c.values[i]), int(c.values[i])+int(c.values[i+1])
+		for x := start; x <= end; x++ {
+			result[x/64] |= 1 << (x % 64)
+		}
+	}
+	return result
+}
+
+func (c *roaringContainer) iterate(yield func(uint16) bool) bool {
+	switch c.kind {
+	case roaringArray:
+		for _, x := range c.values {
+			if !yield(x) {
+				return false
+			}
+		}
+	case roaringBitmap:
+		for i, w := range c.bitmap {
+			for w != 0 {
+				if !yield(uint16(i*64 + bits.TrailingZeros64(w))) { //nolint:gosec
+					return false
+				}
+				w &= w - 1
+			}
+		}
+	default:
+		for i := 0; i < len(c.values); i += 2 {
+			start, end := int(c.values[i]), int(c.values[i])+int(c.values[i+1])
+			for x := start; x <= end; x++ {
+				if !yield(uint16(x)) { //nolint:gosec
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// newRoaringBitmapContainer returns a container for bitmap, which is converted to an array if it is sparse.
+func newRoaringBitmapContainer(bitmap []uint64) *roaringContainer {
+	card := 0
+	for _, w := range bitmap {
+		card += bits.OnesCount64(w)
+	}
+	result := &roaringContainer{kind: roaringBitmap, card: card, bitmap: bitmap}
+	if card <= roaringMaxArraySize {
+		result.convertToArray()
+	}
+	return result
+}
+
+func roaringAnd(a, b *roaringContainer) *roaringContainer {
+	if b.kind == roaringArray && a.kind != roaringArray {
+		a, b = b, a
+	}
+	if a.kind == roaringArray {
+		values := make([]uint16, 0, min(a.card, b.card))
+		for _, x := range a.values {
+			if b.contains(x) {
+				values = append(values, x)
+			}
+		}
+		return &roaringContainer{kind: roaringArray, card: len(values), values: values}
+	}
+	bitmapA, bitmapB := a.toBitmap(), b.toBitmap()
+	result := make([]uint64, roaringBitmapWords)
+	for i := range result {
+		result[i] = bitmapA[i] & bitmapB[i]
+	}
+	return newRoaringBitmapContainer(result)
+}
+
+func roaringOr(a, b *roaringContainer) *roaringContainer {
+	if a.kind == roaringArray && b.kind == roaringArray && a.card+b.card <= roaringMaxArraySize {
+		values := make([]uint16, 0, a.card+b.card)
+		i, j := 0, 0
+		for i < len(a.values) || j < len(b.values) {
+			switch {
+			case j == len(b.values) || (i < len(a.values) && a.values[i] < b.values[j]):
+				values = append(values, a.values[i])
+				i++
+			case i == len(a.values) || a.values[i] > b.values[j]:
+				values = append(values, b.values[j])
+				j++
+			default:
+				values = append(values, a.values[i])
+				i++
+				j++
+			}
+		}
+		return &roaringContainer{kind: roaringArray, card: len(values), values: values}
+	}
+	result := slices.Clone(a.toBitmap())
+	if b.kind == roaringArray {
+		for _, x := range b.values {
+			result[x/64] |= 1 << (x % 64)
+		}
+	} else {
+		for i, w := range b.toBitmap() {
+			result[i] |= w
+		}
+	}
+	return newRoaringBitmapContainer(result)
+}
+
+func roaringAndNot(a, b *roaringContainer) *roaringContainer {
+	if a.kind == roaringArray {
+		values := make([]uint16, 0, a.card)
+		for _, x := range a.values {
+			if !b.contains(x) {
+				values = append(values, x)
+			}
+		}
+		return &roaringContainer{kind: roaringArray, card: len(values), values: values}
+	}
+	result := slices.Clone(a.toBitmap())
+	if b.kind == roaringArray {
+		for _, x := range b.values {
+			result[x/64] &^= 1 << (x % 64)
+		}
+	} else {
+		for i, w := range b.toBitmap() {
+			result[i] &^= w
+		}
+	}
+	return newRoaringBitmapContainer(result)
+}
+
+func (c *roaringContainer) numRuns() int {
+	switch c.kind {
+	case roaringRun:
+		return len(c.values) / 2
+	case roaringArray:
+		runs := 0
+		for i, x := range c.values {
+			if i == 0 || x != c.values[i-1]+1 {
+				runs++
+			}
+		}
+		return runs
+	default:
+		runs := 0
+		prev := uint64(0)
+		for _, w := range c.bitmap {
+			runs += bits.OnesCount64(w &^ (w<<1 | prev>>63))
+			prev = w
+		}
+		return runs
+	}
+}
+
+func (c *roaringContainer) runOptimize() {
+	runSize := 2 + 4*c.numRuns()
+	plainSize := 8 * roaringBitmapWords
+	if c.card <= roaringMaxArraySize {
+		plainSize = 2 * c.card
+	}
+	switch {
+	case runSize < plainSize && c.kind != roaringRun:
+		runs := make([]uint16, 0, 2*c.numRuns())
+		c.iterate(func(x uint16) bool {
+			if n := len(runs); n > 0 && uint32(runs[n-2])+uint32(runs[n-1])+1 == uint32(x) {
+				runs[n-1]++
+			} else {
+				runs = append(runs, x, 0)
+			}
+			return true
+		})
+		c.values, c.bitmap, c.kind = runs, nil, roaringRun
+	case runSize >= plainSize && c.kind == roaringRun:
+		c.materialize()
+	}
+}
+
+func (c *roaringContainer) encodedSize() int {
+	switch c.kind {
+	case roaringArray:
+		return 2 * c.card
+	case roaringBitmap:
+		return 8 * roaringBitmapWords
+	default:
+		return 2 + 2*len(c.values)
+	}
+}
+
+func (c *roaringContainer) appendEncoded(dst []byte) []byte {
+	switch c.kind {
+	case roaringBitmap:
+		for _, w := range c.bitmap {
+			dst = binary.LittleEndian.AppendUint64(dst, w)
+		}
+		return dst
+	case roaringRun:
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(len(c.values)/2)) //nolint:gosec
+	}
+	for _, x := range c.values {
+		dst = binary.LittleEndian.AppendUint16(dst, x)
+	}
+	return dst
+}
+
+func decodeRoaringContainer(data []byte, card int, isRun bool) (*roaringContainer, int, error) {
+	switch {
+	case isRun:
+		if len(data) < 2 {
+			return nil, 0, fmt.Errorf("%w: truncated run container", ErrInvalidFormat)
+		}
+		numRuns := int(binary.LittleEndian.Uint16(data))
+		size := 2 + 4*numRuns
+		if len(data) < size {
+			return nil, 0, fmt.Errorf("%w: truncated run container", ErrInvalidFormat)
+		}
+		runs := make([]uint16, 2*numRuns)
+		total := 0
+		nextStart := 0
+		for i := range runs {
+			runs[i] = binary.LittleEndian.Uint16(data[2+2*i:])
+		}
+		for i := 0; i < len(runs); i += 2 {
+			start, length := int(runs[i]), int(runs[i+1])+1
+			if start < nextStart || start+length > 1<<16 {
+				return nil, 0, fmt.Errorf("%w: invalid runs", ErrInvalidFormat)
+			}
+			nextStart = start + length
+			total += length
+		}
+		if total != card {
+			return nil, 0, fmt.Errorf("%w: cardinality does not match runs", ErrInvalidFormat)
+		}
+		return &roaringContainer{kind: roaringRun, card: card, values: runs}, size, nil
+	case card > roaringMaxArraySize:
+		size := 8 * roaringBitmapWords
+		if len(data) < size {
+			return nil, 0, fmt.Errorf("%w: truncated bitmap container", ErrInvalidFormat)
+		}
+		bitmap := make([]uint64, roaringBitmapWords)
+		count := 0
+		for i := range bitmap {
+			bitmap[i] = binary.LittleEndian.Uint64(data[8*i:])
+			count += bits.OnesCount64(bitmap[i])
+		}
+		if count != card {
+			return nil, 0, fmt.Errorf("%w: cardinality does not match bitmap", ErrInvalidFormat)
+		}
+		return &roaringContainer{kind: roaringBitmap, card: card, bitmap: bitmap}, size, nil
+	default:
+		size := 2 * card
+		if len(data) < size {
+			return nil, 0, fmt.Errorf("%w: truncated array container", ErrInvalidFormat)
+		}
+		values := make([]uint16, card)
+		for i := range values {
+			values[i] = binary.LittleEndian.Uint16(data[2*i:])
+			if i > 0 && values[i] <= values[i-1] {
+				return nil, 0, fmt.Errorf("%w: array container not in ascending order", ErrInvalidFormat)
+			}
+		}
+		return &roaringContainer{kind: roaringArray, card: card, values: values}, size, nil
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clusteredIDs returns sparse values, dense clusters and long runs across several containers.
+func clusteredIDs(rng *rand.Rand) *Set3[uint32] {
+	result := Empty[uint32]()
+	for range 1 + rng.IntN(5) {
+		base := uint32(rng.IntN(8)) << 16 //nolint:gosec
+		switch rng.IntN(3) {
+		case 0: // sparse, array container
+			for range rng.IntN(3000) {
+				result.Add(base | uint32(rng.IntN(1<<16))) //nolint:gosec
+			}
+		case 1: // dense, bitmap container
+			for range 10_000 + rng.IntN(40_000) {
+				result.Add(base | uint32(rng.IntN(1<<16))) //nolint:gosec
+			}
+		default: // runs
+			start := uint32(rng.IntN(1 << 15)) //nolint:gosec
+			for v := start; v < start+uint32(rng.IntN(1<<15)); v++ {
+				result.Add(base | v)
+			}
+		}
+	}
+	return result
+}
+
+func TestRoaringSet32MatchesSet3(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6)) //nolint:gosec
+	for round := range 30 {
+		a := clusteredIDs(rng)
+		b := clusteredIDs(rng)
+		roaringA := RoaringSet32FromSet3(a)
+		roaringB := RoaringSet32FromSet3(b)
+		if round%2 == 1 {
+			roaringA.RunOptimize()
+			roaringB.RunOptimize()
+		}
+		assert.Equal(t, uint64(a.Size()), roaringA.Cardinality())
+		assert.True(t, a.Equals(roaringA.ToSet3()))
+		assert.True(t, a.Intersect(b).Equals(roaringA.And(roaringB).ToSet3()))
+		assert.True(t, a.Unite(b).Equals(roaringA.Or(roaringB).ToSet3()))
+		assert.True(t, a.Subtract(b).Equals(roaringA.AndNot(roaringB).ToSet3()))
+		assert.True(t, b.Subtract(a).Equals(roaringB.AndNot(roaringA).ToSet3()))
+		assert.Equal(t, a.Equals(b), roaringA.Equals(roaringB))
+		assert.True(t, roaringA.Equals(RoaringSet32FromSet3(a)))
+		values := roaringA.ToArray()
+		assert.True(t, slices.IsSorted(values))
+		for range 200 {
+			v := uint32(rng.IntN(8 << 16)) //nolint:gosec
+			assert.Equal(t, a.Contains(v), roaringA.Contains(v))
+		}
+	}
+}
+
+func TestRoaringSet32AddRemove(t *testing.T) {
+	set := NewRoaringSet32()
+	for v := range uint32(10_000) {
+		set.Add(v * 3)
+	}
+	assert.Equal(t, uint64(10_000), set.Cardinality())
+	assert.Equal(t, roaringBitmap, int(set.containers[0].kind), "dense container shall be a bitmap")
+	for v := range uint32(10_000) {
+		if v%4 != 0 {
+			assert.True(t, set.Remove(v*3))
+		}
+	}
+	assert.False(t, set.Remove(1))
+	assert.Equal(t, uint64(2500), set.Cardinality())
+	assert.Equal(t, roaringArray, int(set.containers[0].kind), "sparse container shall be an array")
+
+	runs := NewRoaringSet32()
+	for v := uint32(1000); v < 50_000; v++ {
+		runs.Add(v)
+	}
+	runs.RunOptimize()
+	assert.Equal(t, roaringRun, int(runs.containers[0].kind))
+	assert.True(t, runs.Contains(1000))
+	assert.True(t, runs.Contains(49_999))
+	assert.False(t, runs.Contains(999))
+	assert.False(t, runs.Contains(50_000))
+	runs.Add(500)
+	assert.True(t, runs.Remove(2000))
+	assert.Equal(t, uint64(49_000), runs.Cardinality())
+	assert.False(t, runs.Contains(2000))
+	assert.True(t, runs.Contains(500))
+
+	single := RoaringSet32From(1 << 20)
+	assert.True(t, single.Remove(1<<20))
+	assert.Empty(t, single.keys, "empty containers shall be removed")
+	assert.True(t, single.Equals(nil))
+}
+
+func TestRoaringSet32KnownEncoding(t *testing.T) {
+	// {1,2,3} without runs: cookie, number of containers, key, cardinality-1, offset, values
+	expected := []byte{
+		0x3a, 0x30, 0, 0, 1, 0, 0, 0,
+		0, 0, 2, 0,
+		16, 0, 0, 0,
+		1, 0, 2, 0, 3, 0,
+	}
+	set := RoaringSet32From(1, 2, 3)
+	assert.Equal(t, expected, set.AppendEncoded(nil))
+	set.RunOptimize()
+	assert.Equal(t, expected, set.AppendEncoded(nil), "a run container shall only be used if it is smaller")
+	// {1,...,10} as run container: cookie with number of containers-1, run flags, key, cardinality-1, number of runs, start, length-1
+	for v := range uint32(10) {
+		set.Add(v + 1)
+	}
+	set.RunOptimize()
+	expectedRuns := []byte{
+		0x3b, 0x30, 0, 0, 1,
+		0, 0, 9, 0,
+		1, 0, 1, 0, 9, 0,
+	}
+	assert.Equal(t, expectedRuns, set.AppendEncoded(nil))
+	decoded, n, err := RoaringSet32FromEncoded(expectedRuns)
+	require.NoError(t, err)
+	assert.Equal(t, len(expectedRuns), n)
+	assert.Equal(t, []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, decoded.ToArray())
+}
+
+func TestRoaringSet32Encoded(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8)) //nolint:gosec
+	for round := range 20 {
+		set := RoaringSet32FromSet3(clusteredIDs(rng))
+		if round%2 == 1 {
+			set.RunOptimize()
+		}
+		buf := set.AppendEncoded([]byte{0xff})
+		decoded, n, err := RoaringSet32FromEncoded(buf[1:])
+		require.NoError(t, err)
+		assert.Equal(t, len(buf)-1, n)
+		assert.True(t, set.Equals(decoded))
+		assert.Equal(t, set.ToArray(), decoded.ToArray())
+
+		_, _, err = RoaringSet32FromEncoded(buf[1 : len(buf)-1])
+		assert.True(t, errors.Is(err, ErrInvalidFormat), "truncated data shall be detected")
+	}
+	empty, n, err := RoaringSet32FromEncoded(NewRoaringSet32().AppendEncoded(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, uint64(0), empty.Cardinality())
+
+	_, _, err = RoaringSet32FromEncoded([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	unsorted := []byte{0x3a, 0x30, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 16, 0, 0, 0, 2, 0, 1, 0}
+	_, _, err = RoaringSet32FromEncoded(unsorted)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestRoaringSet32Conversions(t *testing.T) {
+	assert.Equal(t, uint64(0), RoaringSet32FromSet3(nil).Cardinality())
+	set := RoaringSet32From(7, 1<<31, 3)
+	assert.Equal(t, []uint32{3, 7, 1 << 31}, set.ToArray())
+	assert.True(t, From[uint32](3, 7, 1<<31).Equals(set.ToSet3()))
+	clone := set.Clone()
+	clone.Add(4)
+	assert.False(t, set.Contains(4), "clone shall be independent")
+	assert.True(t, set.Or(nil).Equals(set))
+	assert.True(t, set.AndNot(nil).Equals(set))
+	assert.Equal(t, uint64(0), set.And(nil).Cardinality())
+	for v := range set.MutableRange() {
+		if v > 3 {
+			break
+		}
+	}
+}
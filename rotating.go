@@ -0,0 +1,236 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"iter"
+	"slices"
+)
+
+/*
+RotatingSet3 is a set for sliding deduplication windows, e.g. "seen in the last N minutes", that is cheaper than a TTL per element.
+It consists of K generations, each a Set3. Add writes to the current generation, Contains checks all generations, and [RotatingSet3.Rotate]
+drops the oldest generation and makes it the new current one. An element survives K-1 to K rotations, so call Rotate every N/(K-1) minutes
+to forget the elements that have not been added for N to N+N/(K-1) minutes.
+
+Every element is stored in exactly one generation: adding an element moves it from an older generation to the current one.
+*/
+type RotatingSet3[T comparable] struct {
+	generations []*Set3[T]
+	current     int
+}
+
+/*
+EmptyRotatingSet3 creates a new and empty RotatingSet3 with the given number of generations.
+
+EmptyRotatingSet3 panics if numGenerations is 0.
+
+Example:
+
+	// call seen.Rotate() every minute to remember the keys of the last 10 to 11 minutes
+	seen := EmptyRotatingSet3[string](11)
+*/
+func EmptyRotatingSet3[T comparable](numGenerations uint32) *RotatingSet3[T] {
+	return EmptyRotatingSet3WithCapacity[T](numGenerations, 21)
+}
+
+/*
+EmptyRotatingSet3WithCapacity creates a new and empty RotatingSet3 with the given number of generations, each of which can hold
+capacityPerGeneration elements without being reorganized. See [EmptyRotatingSet3].
+*/
+func EmptyRotatingSet3WithCapacity[T comparable](numGenerations uint32, capacityPerGeneration uint32) *RotatingSet3[T] {
+	if numGenerations == 0 {
+		panic("set3: number of generations must be positive")
+	}
+	result := &RotatingSet3[T]{generations: make([]*Set3[T], numGenerations)}
+	for i := range result.generations {
+		result.generations[i] = EmptyWithCapacity[T](capacityPerGeneration)
+	}
+	return result
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation. The order of the elements in the result is arbitrary.
+*/
+func (thisSet *RotatingSet3[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), set3formatValue)
+}
+
+/*
+NumGenerations returns the number of generations of thisSet.
+*/
+func (thisSet *RotatingSet3[T]) NumGenerations() int {
+	return len(thisSet.generations)
+}
+
+// generation returns the i-th generation, counting from the current one (0) to the oldest one.
+func (thisSet *RotatingSet3[T]) generation(i int) *Set3[T] {
+	k := len(thisSet.generations)
+	return thisSet.generations[(thisSet.current-i+k)%k]
+}
+
+/*
+GenerationSize returns the number of elements in the i-th generation, counting from the current one (0) to the oldest one (NumGenerations()-1).
+*/
+func (thisSet *RotatingSet3[T]) GenerationSize(i int) uint32 {
+	return thisSet.generation(i).Size()
+}
+
+/*
+Size returns the number of elements in thisSet, i.e., the sum of the sizes of all generations.
+*/
+func (thisSet *RotatingSet3[T]) Size() uint32 {
+	result := uint32(0)
+	for _, g := range thisSet.generations {
+		result += g.Size()
+	}
+	return result
+}
+
+/*
+Contains returns true if any generation of thisSet contains the element.
+*/
+func (thisSet *RotatingSet3[T]) Contains(element T) bool {
+	for i := range thisSet.generations {
+		if thisSet.generation(i).Contains(element) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Add inserts the element into the current generation of thisSet and removes it from the older generations,
+so it stays in thisSet for NumGenerations() rotations from now on.
+*/
+func (thisSet *RotatingSet3[T]) Add(element T) {
+	for i := 1; i < len(thisSet.generations); i++ {
+		thisSet.generation(i).Remove(element)
+	}
+	thisSet.generation(0).Add(element)
+}
+
+/*
+Inserts all parameter values into thisSet, see [RotatingSet3.Add].
+*/
+func (thisSet *RotatingSet3[T]) AddAllOf(args ...T) {
+	for _, e := range args {
+		thisSet.Add(e)
+	}
+}
+
+/*
+Removes the element from thisSet, returns whether or not the element was in thisSet.
+*/
+func (thisSet *RotatingSet3[T]) Remove(element T) bool {
+	for _, g := range thisSet.generations {
+		if g.Remove(element) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Rotate drops the elements of the oldest generation, which becomes the new, empty current generation. It returns the number of dropped elements.
+The memory of the dropped generation is reused.
+
+Example:
+
+	seen := EmptyRotatingSet3[string](2)
+	seen.Add("a")
+	seen.Rotate()
+	seen.Add("b")
+	dropped := seen.Rotate() // dropped will be 1, seen will contain "b"
+*/
+func (thisSet *RotatingSet3[T]) Rotate() uint32 {
+	thisSet.current = (thisSet.current + 1) % len(thisSet.generations)
+	oldest := thisSet.generations[thisSet.current]
+	dropped := oldest.Size()
+	oldest.Clear()
+	return dropped
+}
+
+/*
+Clear removes all elements from all generations of thisSet.
+*/
+func (thisSet *RotatingSet3[T]) Clear() {
+	for _, g := range thisSet.generations {
+		g.Clear()
+	}
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *RotatingSet3[T]) Clone() *RotatingSet3[T] {
+	result := &RotatingSet3[T]{generations: make([]*Set3[T], len(thisSet.generations)), current: thisSet.current}
+	for i, g := range thisSet.generations {
+		result.generations[i] = g.Clone()
+	}
+	return result
+}
+
+/*
+ToSet3 creates a Set3 with the elements of all generations of thisSet.
+*/
+func (thisSet *RotatingSet3[T]) ToSet3() *Set3[T] {
+	result := EmptyWithCapacity[T](thisSet.Size())
+	for _, g := range thisSet.generations {
+		result.AddAll(g)
+	}
+	return result
+}
+
+/*
+Iterates over all elements in thisSet, from the current generation to the oldest one.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [RotatingSet3.ImmutableRange].
+*/
+func (thisSet *RotatingSet3[T]) MutableRange() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for i := range thisSet.generations {
+			for e := range thisSet.generation(i).MutableRange() {
+				if !yield(e) {
+					return
+				}
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet, from the current generation to the oldest one.
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *RotatingSet3[T]) ImmutableRange() iter.Seq[T] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray allocates an array of type T and adds all elements of thisSet to it, from the current generation to the oldest one.
+The order of the elements within a generation is arbitrary.
+*/
+func (thisSet *RotatingSet3[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
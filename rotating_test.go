@@ -0,0 +1,96 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingSetRotate(t *testing.T) {
+	set := EmptyRotatingSet3[string](3)
+	assert.Equal(t, 3, set.NumGenerations())
+	set.AddAllOf("a", "b")
+	assert.Equal(t, uint32(0), set.Rotate())
+	set.Add("c")
+	set.Add("a") // moves "a" to the current generation
+	assert.Equal(t, uint32(2), set.GenerationSize(0))
+	assert.Equal(t, uint32(1), set.GenerationSize(1))
+	assert.Equal(t, uint32(3), set.Size())
+	assert.Equal(t, uint32(0), set.Rotate())
+	assert.Equal(t, uint32(1), set.Rotate(), "b is dropped")
+	assert.False(t, set.Contains("b"))
+	assert.True(t, set.Contains("a"))
+	assert.ElementsMatch(t, []string{"a", "c"}, set.ToArray())
+	assert.Equal(t, uint32(2), set.Rotate())
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, "{}", set.String())
+}
+
+func TestRotatingSetMatchesModel(t *testing.T) {
+	rng := rand.New(rand.NewPCG(61, 62)) //nolint:gosec
+	const k = 4
+	set := EmptyRotatingSet3WithCapacity[int](k, 100)
+	lastAdded := map[int]int{} // element -> rotation count at the time of its last Add
+	rotations := 0
+	for i := range 50_000 {
+		e := rng.IntN(1000)
+		switch rng.IntN(10) {
+		case 0:
+			set.Rotate()
+			rotations++
+			for key, r := range lastAdded {
+				if rotations-r >= k {
+					delete(lastAdded, key)
+				}
+			}
+		case 1:
+			_, ok := lastAdded[e]
+			require.Equal(t, ok, set.Remove(e))
+			delete(lastAdded, e)
+		default:
+			set.Add(e)
+			lastAdded[e] = rotations
+		}
+		if i%500 == 0 {
+			require.Equal(t, uint32(len(lastAdded)), set.Size()) //nolint:gosec
+			for key := range lastAdded {
+				require.True(t, set.Contains(key))
+			}
+			require.True(t, set.ToSet3().Equals(set.Clone().ToSet3()))
+		}
+	}
+}
+
+func TestRotatingSetClear(t *testing.T) {
+	set := EmptyRotatingSet3[int](2)
+	set.Add(1)
+	set.Rotate()
+	set.Add(2)
+	for e := range set.ImmutableRange() {
+		set.Remove(e)
+		set.Add(e + 10)
+	}
+	assert.ElementsMatch(t, []int{11, 12}, set.ToArray())
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+	assert.False(t, set.Remove(11))
+	var nilSet *RotatingSet3[int]
+	assert.Equal(t, "{nil}", nilSet.String())
+	assert.Panics(t, func() { EmptyRotatingSet3[int](0) })
+}
@@ -17,6 +17,7 @@ package set3
 import (
 	"fmt"
 	"iter"
+	"math"
 	"math/bits"
 	"strings"
 
@@ -63,6 +64,8 @@ type Set3[T comparable] struct {
 	elementLimit uint32
 	groupCtrl    []uint64
 	groupSlot    [][set3groupSize]T
+	options      set3Options
+	allocator    Allocator[T]
 }
 
 /*
@@ -121,25 +124,64 @@ Example:
 	set2 := EmptyWithCapacity[int](2_000_000) // you can put 1 mio. ints in set2. set2 does not need to rehash itself while adding them
 */
 func EmptyWithCapacity[T comparable](initialCapacity uint32) *Set3[T] {
-	reqNrOfGroups := calcReqNrOfGroups(initialCapacity)
+	return EmptyWithOptions[T](initialCapacity)
+}
+
+/*
+EmptyWithOptions creates a new and empty Set3 with a given initial capacity and the given tuning options (see [Option]).
+Choose this constructor if the default trade-off between speed and memory consumption does not fit your needs.
+
+Example:
+
+	set1 := EmptyWithOptions[int](1000, WithMaxLoad(4.0)) // faster lookups, more memory
+	set2 := EmptyWithOptions[int](1000, WithMaxLoad(7.0), WithGrowthFactor(1.5)) // less memory, slower lookups
+*/
+func EmptyWithOptions[T comparable](initialCapacity uint32, options ...Option) *Set3[T] {
+	return emptyWithSet3Options[T](initialCapacity, buildOptions(options))
+}
+
+func emptyWithSet3Options[T comparable](initialCapacity uint32, opts set3Options) *Set3[T] {
+	reqNrOfGroups := calcReqNrOfGroupsForLoad(initialCapacity, opts.maxAvgGroupLoad)
+	return emptyWithNumGroups[T](reqNrOfGroups, opts)
+}
+
+func emptyWithNumGroups[T comparable](reqNrOfGroups uint32, opts set3Options) *Set3[T] {
 	result := &Set3[T]{
 		hashFunction: maphash.NewHasher[T](),
-		elementLimit: uint32(float64(reqNrOfGroups) * set3maxAvgGroupLoad),
+		elementLimit: calcElementLimit(reqNrOfGroups, opts.maxAvgGroupLoad),
 		groupCtrl:    make([]uint64, reqNrOfGroups),
 		groupSlot:    make([][set3groupSize]T, reqNrOfGroups),
+		options:      opts,
 	}
+	result.options.minNumGroups = reqNrOfGroups
 	for i := range reqNrOfGroups {
 		result.groupCtrl[i] = set3AllEmpty
 	}
 	return result
 }
 
+// emptyLike creates a new and empty Set3 with the given initial capacity that
+// shares the options and the allocator of thisSet.
+func (thisSet *Set3[T]) emptyLike(initialCapacity uint32) *Set3[T] {
+	result := &Set3[T]{
+		hashFunction: maphash.NewHasher[T](),
+		options:      thisSet.options,
+		allocator:    thisSet.allocator,
+	}
+	result.Reset(initialCapacity)
+	return result
+}
+
 func calcReqNrOfGroups(reqCapa uint32) uint32 {
-	reqNrOfGroups := uint32((float64(reqCapa) + set3maxAvgGroupLoad - 1) / set3maxAvgGroupLoad)
-	if reqNrOfGroups == 0 {
-		reqNrOfGroups = 1
+	return calcReqNrOfGroupsForLoad(reqCapa, set3maxAvgGroupLoad)
+}
+
+func calcReqNrOfGroupsForLoad(reqCapa uint32, maxAvgGroupLoad float64) uint32 {
+	reqNrOfGroups := (float64(reqCapa) + maxAvgGroupLoad - 1) / maxAvgGroupLoad
+	if reqNrOfGroups < 1 {
+		return 1
 	}
-	return reqNrOfGroups
+	return clampToUint32(reqNrOfGroups)
 }
 
 /*
@@ -209,9 +251,10 @@ func (thisSet *Set3[T]) Clone() *Set3[T] {
 		elementLimit: thisSet.elementLimit,
 		resident:     thisSet.resident,
 		dead:         thisSet.dead,
-		groupCtrl:    make([]uint64, len(thisSet.groupCtrl)),
-		groupSlot:    make([][set3groupSize]T, len(thisSet.groupSlot)),
+		options:      thisSet.options,
+		allocator:    thisSet.allocator,
 	}
+	result.groupCtrl, result.groupSlot = thisSet.allocate(uint32(len(thisSet.groupCtrl))) //nolint:gosec
 	copy(result.groupCtrl, thisSet.groupCtrl)
 	copy(result.groupSlot, thisSet.groupSlot)
 	return result
@@ -230,6 +273,32 @@ Example:
 	b2 := set.Contains(4) // b2 will be false
 */
 func (thisSet *Set3[T]) Contains(element T) bool {
+	_, _, found := thisSet.find(element)
+	return found
+}
+
+/*
+Lookup returns the element stored in thisSet that is equal to the given element, and true. If thisSet does not contain the element,
+Lookup returns the zero value and false. Equal elements can still differ, e.g., equal strings may be backed by different memory,
+so Lookup lets you retrieve the stored instance. See [Interner].
+
+Example:
+
+	set := From("a", "b")
+	stored, ok := set.Lookup("a") // stored will be the "a" stored in set, ok will be true
+	_, ok = set.Lookup("c")       // ok will be false
+*/
+func (thisSet *Set3[T]) Lookup(element T) (T, bool) {
+	g, s, found := thisSet.find(element)
+	if !found {
+		var zero T
+		return zero, false
+	}
+	return thisSet.groupSlot[g][s], true
+}
+
+// find returns the group and slot of the element, or found == false if thisSet does not contain the element.
+func (thisSet *Set3[T]) find(element T) (uint64, int, bool) {
 	hash := thisSet.hashFunction.Hash(element)
 	H2 := (hash & 0x0000_0000_0000_007f)
 	groupCount := uint64(len(thisSet.groupCtrl))
@@ -242,7 +311,7 @@ func (thisSet *Set3[T]) Contains(element T) bool {
 			for H2matches != 0 {
 				s := set3nextMatch(&H2matches)
 				if element == slot[s] {
-					return true
+					return currentGroupIndex, s, true
 				}
 			}
 		}
@@ -253,7 +322,7 @@ func (thisSet *Set3[T]) Contains(element T) bool {
 			// there is an empty slot - the element, if it had been added, hat either
 			// been found until now or it had been added in the next empty spot -
 			// well, this is the next empty spot...
-			return false
+			return 0, 0, false
 		}
 		currentGroupIndex++ // carousel through all groups
 		if currentGroupIndex >= groupCount {
@@ -604,7 +673,7 @@ func (thisSet *Set3[T]) Unite(thatSet *Set3[T]) *Set3[T] {
 		return thisSet.Clone()
 	}
 	potentialSize := thisSet.Size() + thatSet.Size()
-	result := EmptyWithCapacity[T](potentialSize)
+	result := thisSet.emptyLike(potentialSize)
 	for e := range thisSet.MutableRange() {
 		result.Add(e)
 	}
@@ -641,6 +710,14 @@ Example:
 	set.Remove(0)	// set will still be empty
 */
 func (thisSet *Set3[T]) Remove(element T) bool {
+	removed := thisSet.remove(element)
+	if removed {
+		thisSet.shrinkIfSparse()
+	}
+	return removed
+}
+
+func (thisSet *Set3[T]) remove(element T) bool {
 	hash := thisSet.hashFunction.Hash(element)
 	H2 := (hash & 0x0000_0000_0000_007f)
 	groupCount := uint64(len(thisSet.groupCtrl))
@@ -719,8 +796,9 @@ func (thisSet *Set3[T]) RemoveAll(thatSet *Set3[T]) {
 		return
 	}
 	for e := range thatSet.MutableRange() {
-		thisSet.Remove(e)
+		thisSet.remove(e)
 	}
+	thisSet.shrinkIfSparse()
 }
 
 /*
@@ -741,8 +819,9 @@ func (thisSet *Set3[T]) RemoveAllOf(args ...T) {
 		return
 	}
 	for _, e := range args {
-		thisSet.Remove(e)
+		thisSet.remove(e)
 	}
+	thisSet.shrinkIfSparse()
 }
 
 /*
@@ -763,8 +842,9 @@ func (thisSet *Set3[T]) RemoveAllFromArray(data []T) {
 		return
 	}
 	for _, e := range data {
-		thisSet.Remove(e)
+		thisSet.remove(e)
 	}
+	thisSet.shrinkIfSparse()
 }
 
 /*
@@ -788,7 +868,7 @@ func (thisSet *Set3[T]) Subtract(thatSet *Set3[T]) *Set3[T] {
 		return thisSet.Clone()
 	}
 	potentialSize := thisSet.Size()
-	result := EmptyWithCapacity[T](potentialSize)
+	result := thisSet.emptyLike(potentialSize)
 	for e := range thisSet.MutableRange() {
 		if !thatSet.Contains(e) {
 			result.Add(e)
@@ -808,14 +888,64 @@ Example:
 	set.Clear()  // set will be empty, Count() will return 0
 */
 func (thisSet *Set3[T]) Clear() {
-	var k T
-	for grpidx := range len(thisSet.groupCtrl) {
-		thisSet.groupCtrl[grpidx] = set3AllEmpty
-		for j := range set3groupSize {
-			thisSet.groupSlot[grpidx][j] = k
-		}
+	if thisSet.options.shrinkThreshold > 0 && uint32(len(thisSet.groupCtrl)) > thisSet.options.minNumGroups { //nolint:gosec
+		// see shrinkIfSparse - an empty set shrinks to its initial capacity
+		thisSet.resetToNumGroups(thisSet.options.minNumGroups)
+		return
 	}
+	thisSet.clearInPlace()
+}
+
+/*
+ClearAndShrink removes all elements from thisSet and releases its backend down to the capacity thisSet has been created with
+(or the capacity of the last [Set3.Reset]), regardless of the options of thisSet. Other than [Set3.Clear], it does not keep the
+memory of a set that has grown.
+
+Example:
+
+	set := EmptyWithCapacity[int](100)
+	// ... add lots of elements
+	set.ClearAndShrink() // set will be empty and only consume the memory required for 100 elements
+*/
+func (thisSet *Set3[T]) ClearAndShrink() {
+	thisSet.resetToNumGroups(max(thisSet.options.minNumGroups, 1))
+}
+
+func (thisSet *Set3[T]) clearInPlace() {
+	clear(thisSet.groupSlot) // bulk memclr instead of zeroing element by element
+	for i := range thisSet.groupCtrl {
+		thisSet.groupCtrl[i] = set3AllEmpty
+	}
+	thisSet.resident, thisSet.dead = 0, 0
+}
+
+/*
+Reset removes all elements from thisSet and reorganizes the backend of thisSet for the given capacity. Other than [Set3.Clear], which keeps the current backend,
+Reset releases the current backend and allocates a new one if the capacity changes. Choose Reset if thisSet will be refilled with a number of elements
+that is quite different from its current size, e.g., to release the memory of a huge set that will be refilled with a few elements only.
+
+The new capacity also becomes the capacity below which thisSet never shrinks automatically (see [WithShrinkOnRemove]).
+
+Example:
+
+	set := EmptyWithCapacity[int](1_000_000)
+	// ... add lots of elements
+	set.Reset(100) // set will be empty and only consume the memory required for 100 elements
+*/
+func (thisSet *Set3[T]) Reset(newCapacity uint32) {
+	newNumGroups := calcReqNrOfGroupsForLoad(newCapacity, thisSet.options.maxAvgGroupLoad)
+	thisSet.options.minNumGroups = newNumGroups
+	thisSet.resetToNumGroups(newNumGroups)
+}
+
+func (thisSet *Set3[T]) resetToNumGroups(newNumGroups uint32) {
+	if uint32(len(thisSet.groupCtrl)) == newNumGroups { //nolint:gosec
+		thisSet.clearInPlace()
+		return
+	}
+	thisSet.elementLimit = calcElementLimit(newNumGroups, thisSet.options.maxAvgGroupLoad)
 	thisSet.resident, thisSet.dead = 0, 0
+	thisSet.groupCtrl, thisSet.groupSlot = thisSet.allocate(newNumGroups)
 }
 
 /*
@@ -851,7 +981,7 @@ func (thisSet *Set3[T]) Intersect(thatSet *Set3[T]) *Set3[T] {
 	}
 
 	potentialSize := smallerSet.Size()
-	result := EmptyWithCapacity[T](potentialSize)
+	result := thisSet.emptyLike(potentialSize)
 	for e := range smallerSet.ImmutableRange() {
 		if biggerSet.Contains(e) {
 			result.Add(e)
@@ -886,7 +1016,7 @@ func (thisSet *Set3[T]) IntersectWithArray(data []T) *Set3[T] {
 		potentialSize = uint32(len(data)) //nolint:gosec
 	}
 
-	result := EmptyWithCapacity[T](potentialSize)
+	result := thisSet.emptyLike(potentialSize)
 	for _, e := range data {
 		if thisSet.Contains(e) {
 			result.Add(e)
@@ -1001,11 +1131,72 @@ func (thisSet *Set3[T]) Size() uint32 {
 }
 
 func (thisSet *Set3[T]) calcNextGroupCount() uint32 {
-	n := len(thisSet.groupCtrl) * 2
+	current := uint32(len(thisSet.groupCtrl)) //nolint:gosec
 	if thisSet.dead >= (thisSet.resident / 2) {
-		n = len(thisSet.groupCtrl)
+		// enough tombstones to make room by rehashing in place
+		return current
+	}
+	if thisSet.options.shrinkThreshold > 0 && float64(thisSet.Size()) < thisSet.options.shrinkTargetLoad()*float64(thisSet.elementLimit) {
+		// growing now would make the set sparse enough to shrink again soon
+		return current
+	}
+	if current == math.MaxUint32 {
+		return current
+	}
+	n := clampToUint32(math.Ceil(float64(current) * thisSet.options.growthFactor))
+	if thisSet.options.shrinkThreshold > 0 {
+		// a large growth factor would leave the set below the shrink threshold, so that a single remove
+		// would shrink it again - grow at most to the load a shrinking set ends up with (see shrinkIfSparse)
+		maxNumGroups := calcReqNrOfGroupsForLoad(clampToUint32(float64(thisSet.Size())/thisSet.options.shrinkTargetLoad()), thisSet.options.maxAvgGroupLoad)
+		n = min(n, maxNumGroups)
+	}
+	if n <= current {
+		n = current + 1
+	}
+	return n
+}
+
+// shrinkIfSparse rehashes thisSet to a smaller number of groups if the set has
+// been configured to shrink (see [WithShrinkOnRemove]) and the number of elements
+// fell below the configured fraction of its capacity.
+//
+// For hysteresis, the new capacity is chosen such that the load ends up halfway
+// between the shrink threshold and the growth limit. Thus, neither a few adds nor
+// a few removes right after shrinking trigger the next rehash. A small set that
+// cannot get away from both by whole groups does not shrink. The set never
+// shrinks below the number of groups it was created with.
+func (thisSet *Set3[T]) shrinkIfSparse() {
+	threshold := thisSet.options.shrinkThreshold
+	if threshold == 0 {
+		return
+	}
+	currentNumGroups := uint32(len(thisSet.groupCtrl)) //nolint:gosec
+	if currentNumGroups <= thisSet.options.minNumGroups {
+		return
+	}
+	size := float64(thisSet.Size())
+	if size >= threshold*float64(thisSet.elementLimit) {
+		return
+	}
+	targetLoad := thisSet.options.shrinkTargetLoad()
+	ideal := calcReqNrOfGroupsForLoad(uint32(size/targetLoad), thisSet.options.maxAvgGroupLoad)
+	// small sets can only shrink by whole groups, so the load may end up far from the target. Take the number of groups
+	// with the load closest to the target among those where neither the next add grows nor the next remove shrinks the set.
+	newNumGroups := currentNumGroups
+	bestDistance := math.Inf(1)
+	for numGroups := max(ideal, 2) - 1; numGroups <= ideal+1 && numGroups < currentNumGroups; numGroups++ {
+		limit := float64(calcElementLimit(numGroups, thisSet.options.maxAvgGroupLoad))
+		if size >= limit || (size > 0 && size-1 < threshold*limit) {
+			continue
+		}
+		if distance := math.Abs(size/limit - targetLoad); distance < bestDistance {
+			newNumGroups, bestDistance = numGroups, distance
+		}
+	}
+	newNumGroups = max(newNumGroups, thisSet.options.minNumGroups)
+	if newNumGroups < currentNumGroups {
+		thisSet.rehashToNumGroups(newNumGroups)
 	}
-	return uint32(n) //nolint:gosec
 }
 
 /*
@@ -1020,7 +1211,7 @@ Example:
 	set.Rehash() // saves memory consumed by set
 */
 func (thisSet *Set3[T]) Rehash() {
-	numGroups := calcReqNrOfGroups(thisSet.Size()) //nolint:gosec
+	numGroups := calcReqNrOfGroupsForLoad(thisSet.Size(), thisSet.options.maxAvgGroupLoad)
 	thisSet.rehashToNumGroups(numGroups)
 }
 
@@ -1041,25 +1232,20 @@ func (thisSet *Set3[T]) RehashToCapacity(newCapacity uint32) {
 	if newCapacity < thisSet.Size() {
 		return
 	}
-	newNumGroups := calcReqNrOfGroups(newCapacity)
+	newNumGroups := calcReqNrOfGroupsForLoad(newCapacity, thisSet.options.maxAvgGroupLoad)
 	thisSet.rehashToNumGroups(newNumGroups)
 }
 
 func (thisSet *Set3[T]) rehashToNumGroups(newNumGroups uint32) {
 	oldNumGroups := len(thisSet.groupCtrl)
-	oldGroupCtrl := make([]uint64, oldNumGroups)
-	oldGroupSlot := make([][set3groupSize]T, oldNumGroups)
-	copy(oldGroupCtrl, thisSet.groupCtrl)
-	copy(oldGroupSlot, thisSet.groupSlot)
+	// the new buffers are always fresh ones, so there is no need to copy the old ones
+	oldGroupCtrl := thisSet.groupCtrl
+	oldGroupSlot := thisSet.groupSlot
 
 	thisSet.hashFunction = maphash.NewSeed(thisSet.hashFunction)
-	thisSet.elementLimit = uint32(float64(newNumGroups) * set3maxAvgGroupLoad)
+	thisSet.elementLimit = calcElementLimit(newNumGroups, thisSet.options.maxAvgGroupLoad)
 	thisSet.resident, thisSet.dead = 0, 0
-	thisSet.groupCtrl = make([]uint64, newNumGroups)
-	thisSet.groupSlot = make([][set3groupSize]T, newNumGroups)
-	for i := range newNumGroups {
-		thisSet.groupCtrl[i] = set3AllEmpty
-	}
+	thisSet.groupCtrl, thisSet.groupSlot = thisSet.allocate(newNumGroups)
 	grpCnt := uint64(newNumGroups)
 	for oldGroupIndex := 0; oldGroupIndex < oldNumGroups; oldGroupIndex++ {
 		ctrl := oldGroupCtrl[oldGroupIndex]
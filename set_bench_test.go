@@ -134,3 +134,41 @@ func mean(samples []float64) (m float64) {
 	}
 	return m / float64(len(samples))
 }
+
+func BenchmarkClearVsReset(b *testing.B) {
+	sizes := []int{1024, 131072, 1048576}
+	for _, n := range sizes {
+		keys := generateInt64Data(n)
+		set := EmptyWithCapacity[int64](uint32(n))
+		b.Run("n="+strconv.Itoa(n), func(b *testing.B) {
+			b.Run("Clear", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					set.AddAllFromArray(keys)
+					b.StartTimer()
+					set.Clear()
+				}
+			})
+			b.Run("Reset same capacity", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					set.AddAllFromArray(keys)
+					b.StartTimer()
+					set.Reset(uint32(n))
+				}
+			})
+			b.Run("Reset small capacity", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					set.Reset(uint32(n))
+					set.AddAllFromArray(keys)
+					b.StartTimer()
+					set.Reset(21)
+				}
+			})
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package set3
 
 import (
+	"math"
 	"math/rand"
 	"regexp"
 	"testing"
@@ -945,3 +946,87 @@ func TestRemoveAllOf(t *testing.T) {
 		t.Errorf("RemoveAllOf incorrectly removed element 1 with nil arguments")
 	}
 }
+
+func TestSet3Reset(t *testing.T) {
+	set := EmptyWithCapacity[int](10)
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	set.Reset(100)
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, 16, len(set.groupCtrl), "set shall contain 16 groups")
+	for i := range 10_000 {
+		assert.False(t, set.Contains(i), "set shall not contain %v", i)
+	}
+	set.AddAllOf(1, 2, 3)
+	assert.True(t, set.ContainsAllOf(1, 2, 3))
+
+	groupCtrl := set.groupCtrl
+	set.Reset(100)
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, &groupCtrl[0], &set.groupCtrl[0], "set shall be cleared in place if the capacity does not change")
+	assert.False(t, set.ContainsAnyOf(1, 2, 3))
+
+	set.Reset(0)
+	assert.Equal(t, 1, len(set.groupCtrl), "set shall contain 1 group")
+	for i := range 100 {
+		set.Add(i)
+	}
+	assert.Equal(t, uint32(100), set.Size())
+}
+
+func TestSet3ResetShrinkFloor(t *testing.T) {
+	set := EmptyWithOptions[int](10, WithShrinkOnRemove(0.25))
+	set.Reset(1000)
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	set.Clear()
+	assert.Equal(t, 154, len(set.groupCtrl), "cleared set shall shrink to the capacity of the last reset")
+}
+
+func TestSet3ClearAndShrink(t *testing.T) {
+	set := EmptyWithCapacity[int](100)
+	initial := len(set.groupCtrl)
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	set.ClearAndShrink()
+	assert.Equal(t, uint32(0), set.Size())
+	assert.Equal(t, initial, len(set.groupCtrl), "set shall shrink to its initial capacity without shrink option")
+	assert.False(t, set.Contains(42))
+
+	groupCtrl := set.groupCtrl
+	set.Add(1)
+	set.ClearAndShrink()
+	assert.Equal(t, &groupCtrl[0], &set.groupCtrl[0], "set shall be cleared in place if it has not grown")
+
+	set.Reset(1000)
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	set.ClearAndShrink()
+	assert.Equal(t, 154, len(set.groupCtrl), "set shall shrink to the capacity of the last reset")
+	set.AddAllOf(1, 2, 3)
+	assert.Equal(t, uint32(3), set.Size())
+}
+
+func TestSet3Lookup(t *testing.T) {
+	set := From(1.0, 2.0)
+	negZero := math.Copysign(0, -1)
+	set.Add(negZero)
+	stored, ok := set.Lookup(0.0)
+	assert.True(t, ok, "0.0 == -0.0")
+	assert.True(t, math.Signbit(stored), "Lookup returns the stored -0.0")
+	_, ok = set.Lookup(3.0)
+	assert.False(t, ok)
+	for i := range 10_000 {
+		set.Add(float64(i) + 0.5)
+	}
+	v, ok := set.Lookup(9999.5)
+	assert.True(t, ok)
+	assert.Equal(t, 9999.5, v)
+	v, ok = set.Lookup(math.NaN())
+	assert.False(t, ok)
+	assert.Zero(t, v)
+}
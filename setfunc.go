@@ -0,0 +1,296 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"bytes"
+	"hash/maphash"
+	"iter"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+SetFunc is a set for element types that cannot be compared with ==, or that need a custom notion of equality, e.g. byte slices,
+case-insensitive strings or floats with a tolerance. The elements are compared by a user defined equal function, and hashed by a
+user defined hash function. It uses the same Swiss table layout as Set3.
+
+The functions must be consistent: if equal(a, b) is true, hash(a) must be equal to hash(b). The hash values are mixed before use,
+so they need not be well distributed, but collisions make the set slow. Elements must not be modified while they are in the set.
+See [EmptyBytesSetFunc] and [EmptyFoldStringSetFunc] for ready-to-use sets.
+*/
+type SetFunc[T any] struct {
+	hash  func(T) uint64
+	equal func(a, b T) bool
+	set3table
+	groupSlot [][set3groupSize]T
+}
+
+/*
+EmptySetFunc creates a new and empty SetFunc with a reasonable default initial capacity that uses the given hash and equal functions.
+
+Example:
+
+	// floats that are equal when rounded to two decimals
+	round := func(f float64) float64 { return math.Round(f * 100) }
+	set := EmptySetFunc(
+		func(f float64) uint64 { return math.Float64bits(round(f)) },
+		func(a, b float64) bool { return round(a) == round(b) },
+	)
+*/
+func EmptySetFunc[T any](hash func(T) uint64, equal func(a, b T) bool) *SetFunc[T] {
+	return EmptySetFuncWithCapacity(21, hash, equal)
+}
+
+/*
+EmptySetFuncWithCapacity creates a new and empty SetFunc that can hold initialCapacity elements without being reorganized and uses the given hash and equal functions.
+*/
+func EmptySetFuncWithCapacity[T any](initialCapacity uint32, hash func(T) uint64, equal func(a, b T) bool) *SetFunc[T] {
+	result := &SetFunc[T]{hash: hash, equal: equal}
+	result.allocate(calcReqNrOfGroups(initialCapacity))
+	return result
+}
+
+var setFuncSeed = maphash.MakeSeed()
+
+/*
+HashBytes is a hash function for byte slices to be used with [SetFunc] along with [bytes.Equal]. The hash values are seeded randomly per process.
+*/
+func HashBytes(b []byte) uint64 {
+	return maphash.Bytes(setFuncSeed, b)
+}
+
+/*
+EmptyBytesSetFunc creates a new and empty SetFunc for byte slices, which compares the contents of the slices.
+
+Example:
+
+	set := EmptyBytesSetFunc()
+	set.Add([]byte("key"))
+	b := set.Contains([]byte("key")) // b will be true
+*/
+func EmptyBytesSetFunc() *SetFunc[[]byte] {
+	return EmptySetFunc(HashBytes, bytes.Equal)
+}
+
+/*
+HashFoldString is a hash function for strings to be used with [SetFunc] along with [strings.EqualFold]: strings that are equal under
+simple Unicode case folding have the same hash value. The hash values are seeded randomly per process.
+*/
+func HashFoldString(s string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(setFuncSeed)
+	var buf [utf8.UTFMax]byte
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			if 'A' <= r && r <= 'Z' {
+				r += 'a' - 'A'
+			}
+			h.WriteByte(byte(r)) //nolint:errcheck
+			continue
+		}
+		// all runes of a case folding orbit are represented by the smallest one
+		canonical := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			canonical = min(canonical, f)
+		}
+		if canonical < utf8.RuneSelf && 'A' <= canonical && canonical <= 'Z' {
+			canonical += 'a' - 'A' // e.g. the Kelvin sign folds to 'K' and 'k'
+		}
+		n := utf8.EncodeRune(buf[:], canonical)
+		h.Write(buf[:n]) //nolint:errcheck
+	}
+	return h.Sum64()
+}
+
+/*
+EmptyFoldStringSetFunc creates a new and empty SetFunc for strings, which compares the strings case-insensitively (see [strings.EqualFold]).
+The set keeps the spelling of the element that has been added first.
+
+Example:
+
+	set := EmptyFoldStringSetFunc()
+	set.Add("Go")
+	b := set.Contains("GO") // b will be true
+*/
+func EmptyFoldStringSetFunc() *SetFunc[string] {
+	return EmptySetFunc(HashFoldString, strings.EqualFold)
+}
+
+func (thisSet *SetFunc[T]) allocate(numGroups uint32) {
+	thisSet.set3table.allocate(numGroups)
+	thisSet.groupSlot = make([][set3groupSize]T, numGroups)
+}
+
+// mixedHash spreads the bits of the user hash, as the Swiss table uses the lowest bits for H2 and the next ones for the group index.
+func (thisSet *SetFunc[T]) mixedHash(element T) uint64 {
+	return stableFinalize(thisSet.hash(element))
+}
+
+func (thisSet *SetFunc[T]) find(element T) (uint64, int, bool) {
+	return thisSet.probe(thisSet.mixedHash(element), func(g uint64, s int) bool {
+		return thisSet.equal(element, thisSet.groupSlot[g][s])
+	})
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation. The order of the elements in the result is arbitrary.
+*/
+func (thisSet *SetFunc[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), set3formatValue)
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *SetFunc[T]) Size() uint32 {
+	return thisSet.size()
+}
+
+/*
+Checks if thisSet contains an element that is equal to the given element.
+*/
+func (thisSet *SetFunc[T]) Contains(element T) bool {
+	_, _, found := thisSet.find(element)
+	return found
+}
+
+/*
+Returns true if thisSet contains all of the given argument values.
+*/
+func (thisSet *SetFunc[T]) ContainsAllOf(args ...T) bool {
+	for _, e := range args {
+		if !thisSet.Contains(e) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Inserts the element into thisSet if thisSet contains no element that is equal to it.
+*/
+func (thisSet *SetFunc[T]) Add(element T) {
+	if _, _, found := thisSet.find(element); found {
+		return
+	}
+	if thisSet.full() {
+		thisSet.rehashToNumGroups(thisSet.nextGroupCount())
+	}
+	thisSet.insertNew(element)
+}
+
+func (thisSet *SetFunc[T]) insertNew(element T) {
+	g, s := thisSet.claim(thisSet.mixedHash(element))
+	thisSet.groupSlot[g][s] = element
+}
+
+/*
+Inserts all parameter values into thisSet, see [SetFunc.Add].
+*/
+func (thisSet *SetFunc[T]) AddAllOf(args ...T) {
+	thisSet.AddAllFromArray(args)
+}
+
+/*
+Inserts all elements from the given data array into thisSet, see [SetFunc.Add].
+*/
+func (thisSet *SetFunc[T]) AddAllFromArray(data []T) {
+	for _, e := range data {
+		thisSet.Add(e)
+	}
+}
+
+/*
+Removes the element that is equal to the given element from thisSet, returns whether or not there was such an element in thisSet.
+*/
+func (thisSet *SetFunc[T]) Remove(element T) bool {
+	g, s, found := thisSet.find(element)
+	if !found {
+		return false
+	}
+	thisSet.release(g, s)
+	var k T
+	thisSet.groupSlot[g][s] = k
+	return true
+}
+
+/*
+Clear removes all elements from thisSet.
+*/
+func (thisSet *SetFunc[T]) Clear() {
+	clear(thisSet.groupSlot)
+	thisSet.reset()
+}
+
+/*
+Clone creates a copy of thisSet that uses the same hash and equal functions. The elements themselves are not copied.
+*/
+func (thisSet *SetFunc[T]) Clone() *SetFunc[T] {
+	return &SetFunc[T]{
+		hash:      thisSet.hash,
+		equal:     thisSet.equal,
+		set3table: thisSet.clone(),
+		groupSlot: slices.Clone(thisSet.groupSlot),
+	}
+}
+
+func (thisSet *SetFunc[T]) rehashToNumGroups(newNumGroups uint32) {
+	oldTable, oldGroupSlot := thisSet.set3table, thisSet.groupSlot
+	thisSet.allocate(newNumGroups)
+	for g, s := range oldTable.slots() {
+		thisSet.insertNew(oldGroupSlot[g][s])
+	}
+}
+
+/*
+Iterates over all elements in thisSet.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [SetFunc.ImmutableRange].
+*/
+func (thisSet *SetFunc[T]) MutableRange() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for g, s := range thisSet.slots() {
+			if !yield(thisSet.groupSlot[g][s]) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet.
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *SetFunc[T]) ImmutableRange() iter.Seq[T] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray allocates an array of type T and adds all elements of thisSet to it. The order of the elements in the resulting array is arbitrary.
+*/
+func (thisSet *SetFunc[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFuncBytesMatchesMap(t *testing.T) {
+	rng := rand.New(rand.NewPCG(21, 22)) //nolint:gosec
+	set := EmptyBytesSetFunc()
+	model := map[string]bool{}
+	for i := range 50_000 {
+		key := []byte{byte(rng.IntN(40)), byte(rng.IntN(40))}
+		if rng.IntN(3) != 0 {
+			set.Add(slices.Clone(key))
+			model[string(key)] = true
+		} else {
+			assert.Equal(t, model[string(key)], set.Remove(key))
+			delete(model, string(key))
+		}
+		if i%1000 == 0 {
+			require.Equal(t, uint32(len(model)), set.Size()) //nolint:gosec
+			for k := range model {
+				require.True(t, set.Contains([]byte(k)))
+			}
+		}
+	}
+	actual := []string{}
+	for _, b := range set.ToArray() {
+		actual = append(actual, string(b))
+	}
+	expected := []string{}
+	for k := range model {
+		expected = append(expected, k)
+	}
+	assert.ElementsMatch(t, expected, actual)
+}
+
+func TestSetFuncGrowAndClear(t *testing.T) {
+	set := EmptySetFuncWithCapacity(0, func(i int) uint64 { return uint64(i) }, func(a, b int) bool { return a == b }) //nolint:gosec
+	for i := range 10_000 {
+		set.Add(i)
+	}
+	assert.Equal(t, uint32(10_000), set.Size())
+	clone := set.Clone()
+	for i := range 10_000 {
+		if i%2 == 0 {
+			assert.True(t, set.Remove(i))
+		}
+	}
+	assert.Equal(t, uint32(5_000), set.Size())
+	assert.Equal(t, uint32(10_000), clone.Size())
+	assert.True(t, clone.ContainsAllOf(0, 2, 4))
+	assert.False(t, set.Contains(2))
+	assert.True(t, set.Contains(3))
+	for e := range set.ImmutableRange() {
+		set.Remove(e)
+	}
+	assert.Equal(t, uint32(0), set.Size())
+	clone.Clear()
+	assert.Equal(t, uint32(0), clone.Size())
+	assert.False(t, clone.Contains(1))
+	assert.Equal(t, "{}", clone.String())
+}
+
+func TestSetFuncFoldString(t *testing.T) {
+	set := EmptyFoldStringSetFunc()
+	set.AddAllOf("Go", "GO", "go", "Straße", "KELVIN")
+	assert.Equal(t, uint32(2+1), set.Size())
+	assert.True(t, set.Contains("gO"))
+	assert.True(t, set.Contains("STRAẞE"), "capital sharp s folds to ß")
+	assert.True(t, set.Contains("\u212Aelvin"), "Kelvin sign folds to k")
+	assert.False(t, set.Contains("Strasse"), "simple folding does not expand ß")
+	assert.ElementsMatch(t, []string{"Go", "Straße", "KELVIN"}, set.ToArray(), "first spelling wins")
+	assert.True(t, set.Remove("straße"))
+	assert.False(t, set.Contains("Straße"))
+}
+
+func TestHashFoldStringConsistentWithEqualFold(t *testing.T) {
+	words := []string{"a", "A", "k", "K", "\u212A", "s", "S", "ſ", "ß", "ẞ", "Σ", "σ", "ς", "Ǆ", "ǅ", "ǆ", "\xff", "\xfe", "İ", "i", "ı"}
+	for _, a := range words {
+		for _, b := range words {
+			if strings.EqualFold(a, b) {
+				assert.Equal(t, HashFoldString(a), HashFoldString(b), "%q and %q", a, b)
+			}
+		}
+	}
+	assert.NotEqual(t, HashFoldString("a"), HashFoldString("b"))
+}
+
+func TestSetFuncCustomEquality(t *testing.T) {
+	round := func(f float64) float64 { return math.Round(f * 100) }
+	set := EmptySetFunc(
+		func(f float64) uint64 { return math.Float64bits(round(f)) },
+		func(a, b float64) bool { return round(a) == round(b) },
+	)
+	set.AddAllFromArray([]float64{1.001, 1.002, 2.5})
+	assert.Equal(t, uint32(2), set.Size())
+	assert.True(t, set.Contains(0.999))
+	assert.False(t, set.Contains(1.1))
+}
+
+func TestSetFuncNilString(t *testing.T) {
+	var set *SetFunc[int]
+	assert.Equal(t, "{nil}", set.String())
+}
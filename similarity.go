@@ -0,0 +1,133 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+// The functions in this file compute sizes of derived sets and similarity coefficients without
+// building the derived sets: they iterate over the smaller set and probe the bigger one.
+// nil is interpreted as empty set everywhere.
+
+func sizeOf[T comparable](set *Set3[T]) uint32 {
+	if set == nil {
+		return 0
+	}
+	return set.Size()
+}
+
+/*
+IntersectionSize returns the number of elements that are in both a and b, i.e., the size of a.Intersect(b), without building the intersection.
+
+Example:
+
+	a := From(1, 2, 3)
+	b := From(2, 3, 4)
+	n := IntersectionSize(a, b) // n will be 2
+*/
+func IntersectionSize[T comparable](a, b *Set3[T]) uint32 {
+	if sizeOf(a) == 0 || sizeOf(b) == 0 {
+		return 0
+	}
+	smallerSet, biggerSet := a, b
+	if b.Size() < a.Size() {
+		smallerSet, biggerSet = b, a
+	}
+	result := uint32(0)
+	for e := range smallerSet.MutableRange() {
+		if biggerSet.Contains(e) {
+			result++
+		}
+	}
+	return result
+}
+
+/*
+UnionSize returns the number of elements that are in a or b, i.e., the size of a.Unite(b), without building the union.
+
+Example:
+
+	a := From(1, 2, 3)
+	b := From(2, 3, 4)
+	n := UnionSize(a, b) // n will be 4
+*/
+func UnionSize[T comparable](a, b *Set3[T]) uint32 {
+	return sizeOf(a) + sizeOf(b) - IntersectionSize(a, b)
+}
+
+/*
+DifferenceSize returns the number of elements that are in a but not in b, i.e., the size of a.Subtract(b), without building the difference.
+
+Example:
+
+	a := From(1, 2, 3)
+	b := From(2, 3, 4)
+	n := DifferenceSize(a, b) // n will be 1
+*/
+func DifferenceSize[T comparable](a, b *Set3[T]) uint32 {
+	return sizeOf(a) - IntersectionSize(a, b)
+}
+
+/*
+Jaccard returns the Jaccard similarity |a ∩ b| / |a ∪ b| of the sets a and b, without building the intersection or the union.
+Two empty sets are equal, so their similarity is 1.
+
+Example:
+
+	a := From("a", "b", "c")
+	b := From("b", "c", "d")
+	similarity := Jaccard(a, b) // similarity will be 0.5
+*/
+func Jaccard[T comparable](a, b *Set3[T]) float64 {
+	intersection := uint64(IntersectionSize(a, b))
+	union := uint64(sizeOf(a)) + uint64(sizeOf(b)) - intersection
+	if union == 0 {
+		return 1
+	}
+	return float64(intersection) / float64(union)
+}
+
+/*
+Dice returns the Sørensen–Dice coefficient 2|a ∩ b| / (|a| + |b|) of the sets a and b, without building the intersection.
+Two empty sets are equal, so their coefficient is 1.
+
+Example:
+
+	a := From("a", "b", "c")
+	b := From("b", "c", "d")
+	similarity := Dice(a, b) // similarity will be 0.6666...
+*/
+func Dice[T comparable](a, b *Set3[T]) float64 {
+	sum := uint64(sizeOf(a)) + uint64(sizeOf(b))
+	if sum == 0 {
+		return 1
+	}
+	return 2 * float64(IntersectionSize(a, b)) / float64(sum)
+}
+
+/*
+Overlap returns the overlap (Szymkiewicz–Simpson) coefficient |a ∩ b| / min(|a|, |b|) of the sets a and b, without building the intersection.
+The coefficient is 1 if one set is a subset of the other. As the empty set is a subset of every set, the coefficient is 1 if a or b is empty.
+
+Example:
+
+	a := From("a", "b", "c")
+	b := From("b", "c")
+	similarity := Overlap(a, b) // similarity will be 1
+*/
+func Overlap[T comparable](a, b *Set3[T]) float64 {
+	smallerSize := min(sizeOf(a), sizeOf(b))
+	if smallerSize == 0 {
+		return 1
+	}
+	return float64(IntersectionSize(a, b)) / float64(smallerSize)
+}
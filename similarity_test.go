@@ -0,0 +1,90 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizesWithoutMaterialization(t *testing.T) {
+	a := From(1, 2, 3, 4)
+	b := From(3, 4, 5)
+	for _, tc := range []struct {
+		a, b *Set3[int]
+	}{{a, b}, {b, a}, {a, a}, {a, nil}, {nil, b}, {nil, nil}, {a, Empty[int]()}} {
+		expectedIntersection, expectedUnion, expectedDifference := uint32(0), uint32(0), uint32(0)
+		if tc.a != nil {
+			expectedIntersection = tc.a.Intersect(tc.b).Size()
+			expectedUnion = tc.a.Unite(tc.b).Size()
+			expectedDifference = tc.a.Subtract(tc.b).Size()
+		} else if tc.b != nil {
+			expectedUnion = tc.b.Size()
+		}
+		assert.Equal(t, expectedIntersection, IntersectionSize(tc.a, tc.b))
+		assert.Equal(t, expectedUnion, UnionSize(tc.a, tc.b))
+		assert.Equal(t, expectedDifference, DifferenceSize(tc.a, tc.b))
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	a := From("a", "b", "c")
+	b := From("b", "c", "d")
+	assert.InDelta(t, 0.5, Jaccard(a, b), 1e-12)
+	assert.InDelta(t, 0.5, Jaccard(b, a), 1e-12)
+	assert.InDelta(t, 1.0, Jaccard(a, a), 1e-12)
+	assert.InDelta(t, 0.0, Jaccard(a, From("x")), 1e-12)
+	assert.InDelta(t, 0.0, Jaccard(a, nil), 1e-12)
+	assert.InDelta(t, 1.0, Jaccard[string](nil, Empty[string]()), 1e-12)
+
+	big := Empty[int]()
+	for i := range 10_000 {
+		big.Add(i)
+	}
+	small := Empty[int]()
+	for i := range 100 {
+		small.Add(i)
+	}
+	assert.InDelta(t, 0.01, Jaccard(small, big), 1e-12)
+	allocs := testing.AllocsPerRun(10, func() { Jaccard(small, big) })
+	assert.Equal(t, 0.0, allocs, "Jaccard shall not allocate")
+}
+
+func TestDiceAndOverlap(t *testing.T) {
+	a := From("a", "b", "c")
+	b := From("b", "c", "d")
+	assert.InDelta(t, 2.0/3.0, Dice(a, b), 1e-12)
+	assert.InDelta(t, 2.0/3.0, Overlap(a, b), 1e-12)
+	assert.InDelta(t, 1.0, Overlap(a, From("b", "c")), 1e-12, "a subset shall have overlap 1")
+	assert.InDelta(t, 0.8, Dice(a, From("b", "c")), 1e-12)
+	assert.InDelta(t, 0.0, Dice(a, nil), 1e-12)
+	assert.InDelta(t, 1.0, Dice[string](nil, nil), 1e-12)
+	assert.InDelta(t, 1.0, Overlap(a, nil), 1e-12)
+	assert.InDelta(t, 0.0, Overlap(a, From("x")), 1e-12)
+}
+
+func TestSimilarityDoesNotAllocate(t *testing.T) {
+	a := FromArray(generateInt64Data(1000))
+	b := FromArray(generateInt64Data(5000))
+	allocs := testing.AllocsPerRun(10, func() {
+		IntersectionSize(a, b)
+		UnionSize(a, b)
+		DifferenceSize(b, a)
+		Dice(a, b)
+		Overlap(a, b)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+
+	"github.com/dolthub/maphash"
+)
+
+// The probabilistic data structures of this package (filters, sketches) need hash values
+// that are consistent across all instances, so that they can be merged or compared.
+// For plain data types and strings, sketchHasher uses stableHash, which yields the same
+// values in every process, so these sketches can be serialized. For all other types it
+// falls back to a maphash.Hasher that is shared by all sketches of the same element type
+// within this process.
+
+type sketchHashKind uint32
+
+const (
+	sketchHashLocal sketchHashKind = iota
+	sketchHashPlain
+	sketchHashString
+)
+
+var sketchLocalHashers sync.Map // reflect.Type -> maphash.Hasher[T]
+
+type sketchHasher[T comparable] struct {
+	kind  sketchHashKind
+	size  int
+	local maphash.Hasher[T]
+}
+
+func newSketchHasher[T comparable]() sketchHasher[T] {
+	if size, ok := plainDataSize[T](); ok {
+		return sketchHasher[T]{kind: sketchHashPlain, size: size}
+	}
+	t := reflect.TypeFor[T]()
+	if t.Kind() == reflect.String {
+		return sketchHasher[T]{kind: sketchHashString}
+	}
+	h, _ := sketchLocalHashers.LoadOrStore(t, maphash.NewHasher[T]())
+	return sketchHasher[T]{kind: sketchHashLocal, local: h.(maphash.Hasher[T])} //nolint:forcetypeassert
+}
+
+func (h *sketchHasher[T]) hash(element T, seed uint64) uint64 {
+	switch h.kind {
+	case sketchHashPlain:
+		return stableHash(seed, plainDataBytes(&element, h.size))
+	case sketchHashString:
+		s := *(*string)(unsafe.Pointer(&element))
+		return stableHash(seed, unsafe.Slice(unsafe.StringData(s), len(s)))
+	default:
+		return stableFinalize(h.local.Hash(element) ^ seed)
+	}
+}
+
+// formatTag identifies the hash values of h in serialized data structures. The hash
+// values of plain data types depend on the byte order of the platform. Returns false
+// if the hash values are only valid within this process.
+func (h *sketchHasher[T]) formatTag() (uint32, bool) {
+	switch h.kind {
+	case sketchHashPlain:
+		return uint32(h.kind) | mappedHostFlags()<<8 | uint32(h.size)<<16, true //nolint:gosec
+	case sketchHashString:
+		return uint32(h.kind), true
+	default:
+		return 0, false
+	}
+}
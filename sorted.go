@@ -0,0 +1,561 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+)
+
+const sortedMaxLevel = 16 // with a branching factor of 4, enough for 4^16 = 2^32 elements
+
+/*
+SortedSet is a set of ordered elements that supports the queries a hash set cannot answer: [SortedSet.Floor], [SortedSet.Ceiling],
+[SortedSet.RangeBetween] and rank queries ([SortedSet.Rank], [SortedSet.At]). It iterates over its elements in ascending order.
+
+SortedSet is an indexable skip list: every link stores the number of elements it skips, so rank queries take O(log n) time like lookups and updates.
+It has the same method vocabulary as [Set3]. Use [SortedSetFromSet3] and [SortedSet.ToSet3] to switch between the representations.
+*/
+type SortedSet[T cmp.Ordered] struct {
+	head sortedNode[T]
+	size uint32
+}
+
+type sortedNode[T cmp.Ordered] struct {
+	element T
+	next    []sortedLink[T]
+}
+
+// sortedLink points to the next node on a level. width is the distance to this node on the lowest level.
+// Links to the end of the list (node == nil) point to the position after the last element.
+type sortedLink[T cmp.Ordered] struct {
+	node  *sortedNode[T]
+	width uint32
+}
+
+/*
+EmptySortedSet creates a new and empty SortedSet.
+
+Example:
+
+	set := EmptySortedSet[int]()
+	set.Add(3)
+	set.Add(1) // set.ToArray() will be [1, 3]
+*/
+func EmptySortedSet[T cmp.Ordered]() *SortedSet[T] {
+	result := &SortedSet[T]{}
+	result.head.next = make([]sortedLink[T], sortedMaxLevel)
+	for i := range result.head.next {
+		result.head.next[i].width = 1
+	}
+	return result
+}
+
+/*
+SortedSetFrom creates a new SortedSet containing all arguments.
+
+Example:
+
+	set := SortedSetFrom(3, 1, 2) // set.ToArray() will be [1, 2, 3]
+*/
+func SortedSetFrom[T cmp.Ordered](args ...T) *SortedSet[T] {
+	return SortedSetFromArray(args)
+}
+
+/*
+SortedSetFromArray creates a new SortedSet containing all elements of data. It sorts a copy of data and builds the set in linear time.
+*/
+func SortedSetFromArray[T cmp.Ordered](data []T) *SortedSet[T] {
+	sorted := slices.Clone(data)
+	slices.Sort(sorted)
+	return sortedSetFromSorted(sortedCompact(sorted))
+}
+
+// sortedCompact removes duplicates from sorted elements. Unlike ==, cmp.Compare considers NaNs to be equal.
+func sortedCompact[T cmp.Ordered](sorted []T) []T {
+	return slices.CompactFunc(sorted, func(a, b T) bool { return cmp.Compare(a, b) == 0 })
+}
+
+/*
+SortedSetFromSet3 creates a new SortedSet containing all elements of set. nil is interpreted as empty set.
+
+Example:
+
+	set := From(3, 1, 2)
+	sorted := SortedSetFromSet3(set)
+	sorted.Floor(2) // 2, true
+*/
+func SortedSetFromSet3[T cmp.Ordered](set *Set3[T]) *SortedSet[T] {
+	if set == nil {
+		return EmptySortedSet[T]()
+	}
+	sorted := set.ToArray()
+	slices.Sort(sorted)
+	return sortedSetFromSorted(sortedCompact(sorted))
+}
+
+// sortedSetFromSorted builds a SortedSet from strictly ascending elements by appending them at the end of the list.
+func sortedSetFromSorted[T cmp.Ordered](sorted []T) *SortedSet[T] {
+	result := EmptySortedSet[T]()
+	var tails [sortedMaxLevel]*sortedNode[T]
+	var tailPos [sortedMaxLevel]uint32
+	for i := range tails {
+		tails[i] = &result.head
+	}
+	for i, e := range sorted {
+		pos := uint32(i + 1) //nolint:gosec
+		node := &sortedNode[T]{element: e, next: make([]sortedLink[T], sortedRandomLevel())}
+		for l := range node.next {
+			tails[l].next[l] = sortedLink[T]{node: node, width: pos - tailPos[l]}
+			tails[l], tailPos[l] = node, pos
+		}
+	}
+	end := uint32(len(sorted) + 1) //nolint:gosec
+	for l := range tails {
+		tails[l].next[l] = sortedLink[T]{width: end - tailPos[l]}
+	}
+	result.size = uint32(len(sorted)) //nolint:gosec
+	return result
+}
+
+// sortedRandomLevel returns a level in [1, sortedMaxLevel], where each level is 4 times less likely than the previous one.
+func sortedRandomLevel() int {
+	return min(bits.TrailingZeros64(rand.Uint64())/2+1, sortedMaxLevel) //nolint:gosec
+}
+
+/*
+ToSet3 creates a new Set3 containing all elements of thisSet.
+*/
+func (thisSet *SortedSet[T]) ToSet3() *Set3[T] {
+	result := EmptyWithCapacity[T](thisSet.size)
+	for e := range thisSet.MutableRange() {
+		result.Add(e)
+	}
+	return result
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation, in ascending order.
+*/
+func (thisSet *SortedSet[T]) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return set3roster(thisSet.MutableRange(), set3formatValue)
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *SortedSet[T]) Size() uint32 {
+	return thisSet.size
+}
+
+// search returns the last node per level whose element is less than element, and its position.
+func (thisSet *SortedSet[T]) search(element T, update *[sortedMaxLevel]*sortedNode[T], positions *[sortedMaxLevel]uint32) {
+	x := &thisSet.head
+	pos := uint32(0)
+	for l := sortedMaxLevel - 1; l >= 0; l-- {
+		for x.next[l].node != nil && cmp.Less(x.next[l].node.element, element) {
+			pos += x.next[l].width
+			x = x.next[l].node
+		}
+		update[l], positions[l] = x, pos
+	}
+}
+
+// lowerBound returns the last node whose element is less than element (or the head) and its position.
+func (thisSet *SortedSet[T]) lowerBound(element T) (*sortedNode[T], uint32) {
+	x := &thisSet.head
+	pos := uint32(0)
+	for l := sortedMaxLevel - 1; l >= 0; l-- {
+		for x.next[l].node != nil && cmp.Less(x.next[l].node.element, element) {
+			pos += x.next[l].width
+			x = x.next[l].node
+		}
+	}
+	return x, pos
+}
+
+/*
+Checks if thisSet contains the element.
+*/
+func (thisSet *SortedSet[T]) Contains(element T) bool {
+	x, _ := thisSet.lowerBound(element)
+	next := x.next[0].node
+	return next != nil && cmp.Compare(next.element, element) == 0
+}
+
+/*
+Inserts the element into thisSet if it is not yet in thisSet.
+*/
+func (thisSet *SortedSet[T]) Add(element T) {
+	var update [sortedMaxLevel]*sortedNode[T]
+	var positions [sortedMaxLevel]uint32
+	thisSet.search(element, &update, &positions)
+	if next := update[0].next[0].node; next != nil && cmp.Compare(next.element, element) == 0 {
+		return
+	}
+	newPos := positions[0] + 1
+	node := &sortedNode[T]{element: element, next: make([]sortedLink[T], sortedRandomLevel())}
+	for l := range sortedMaxLevel {
+		prev := update[l]
+		if l < len(node.next) {
+			node.next[l] = sortedLink[T]{node: prev.next[l].node, width: prev.next[l].width - (newPos - positions[l]) + 1}
+			prev.next[l] = sortedLink[T]{node: node, width: newPos - positions[l]}
+		} else {
+			prev.next[l].width++
+		}
+	}
+	thisSet.size++
+}
+
+/*
+Inserts all parameter values that are not yet in thisSet into thisSet.
+*/
+func (thisSet *SortedSet[T]) AddAllOf(args ...T) {
+	for _, e := range args {
+		thisSet.Add(e)
+	}
+}
+
+/*
+Removes the element from thisSet if it is in thisSet, returns whether or not the element was in thisSet.
+*/
+func (thisSet *SortedSet[T]) Remove(element T) bool {
+	var update [sortedMaxLevel]*sortedNode[T]
+	var positions [sortedMaxLevel]uint32
+	thisSet.search(element, &update, &positions)
+	target := update[0].next[0].node
+	if target == nil || cmp.Compare(target.element, element) != 0 {
+		return false
+	}
+	for l := range sortedMaxLevel {
+		prev := update[l]
+		if prev.next[l].node == target {
+			prev.next[l] = sortedLink[T]{node: target.next[l].node, width: prev.next[l].width + target.next[l].width - 1}
+		} else {
+			prev.next[l].width--
+		}
+	}
+	thisSet.size--
+	return true
+}
+
+/*
+Clear removes all elements from thisSet.
+*/
+func (thisSet *SortedSet[T]) Clear() {
+	for i := range thisSet.head.next {
+		thisSet.head.next[i] = sortedLink[T]{width: 1}
+	}
+	thisSet.size = 0
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *SortedSet[T]) Clone() *SortedSet[T] {
+	return sortedSetFromSorted(thisSet.ToArray())
+}
+
+/*
+Floor returns the greatest element in thisSet that is less than or equal to element. Returns false if there is no such element.
+
+Example:
+
+	set := SortedSetFrom(10, 20, 30)
+	f, ok := set.Floor(25) // f will be 20, ok will be true
+*/
+func (thisSet *SortedSet[T]) Floor(element T) (T, bool) {
+	x, _ := thisSet.lowerBound(element)
+	if next := x.next[0].node; next != nil && cmp.Compare(next.element, element) == 0 {
+		return element, true
+	}
+	if x == &thisSet.head {
+		var zero T
+		return zero, false
+	}
+	return x.element, true
+}
+
+/*
+Ceiling returns the least element in thisSet that is greater than or equal to element. Returns false if there is no such element.
+
+Example:
+
+	set := SortedSetFrom(10, 20, 30)
+	c, ok := set.Ceiling(25) // c will be 30, ok will be true
+*/
+func (thisSet *SortedSet[T]) Ceiling(element T) (T, bool) {
+	x, _ := thisSet.lowerBound(element)
+	if next := x.next[0].node; next != nil {
+		return next.element, true
+	}
+	var zero T
+	return zero, false
+}
+
+/*
+Min returns the least element in thisSet. Returns false if thisSet is empty.
+*/
+func (thisSet *SortedSet[T]) Min() (T, bool) {
+	if next := thisSet.head.next[0].node; next != nil {
+		return next.element, true
+	}
+	var zero T
+	return zero, false
+}
+
+/*
+Max returns the greatest element in thisSet. Returns false if thisSet is empty.
+*/
+func (thisSet *SortedSet[T]) Max() (T, bool) {
+	if thisSet.size == 0 {
+		var zero T
+		return zero, false
+	}
+	return thisSet.At(int(thisSet.size - 1)), true
+}
+
+/*
+Rank returns the number of elements in thisSet that are less than element. If element is in thisSet, this is its position in ascending order, starting at 0.
+
+Example:
+
+	set := SortedSetFrom(10, 20, 30)
+	r := set.Rank(25) // r will be 2
+*/
+func (thisSet *SortedSet[T]) Rank(element T) int {
+	_, pos := thisSet.lowerBound(element)
+	return int(pos)
+}
+
+/*
+At returns the element at the given position in ascending order, starting at 0. Panics if index is out of range.
+
+Example:
+
+	set := SortedSetFrom(10, 20, 30)
+	e := set.At(1) // e will be 20
+*/
+func (thisSet *SortedSet[T]) At(index int) T {
+	if index < 0 || index >= int(thisSet.size) {
+		panic(fmt.Sprintf("set3: index %d out of range [0,%d)", index, thisSet.size))
+	}
+	target := uint32(index + 1) //nolint:gosec
+	x := &thisSet.head
+	pos := uint32(0)
+	for l := sortedMaxLevel - 1; l >= 0; l-- {
+		for x.next[l].node != nil && pos+x.next[l].width <= target {
+			pos += x.next[l].width
+			x = x.next[l].node
+		}
+	}
+	return x.element
+}
+
+/*
+RangeBetween iterates in ascending order over all elements in thisSet that are greater than or equal to lo and less than or equal to hi.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable.
+
+Example:
+
+	set := SortedSetFrom(10, 20, 30, 40)
+	for e := range set.RangeBetween(15, 30) {
+		// e will be 20 and 30
+	}
+*/
+func (thisSet *SortedSet[T]) RangeBetween(lo, hi T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		x, _ := thisSet.lowerBound(lo)
+		for x = x.next[0].node; x != nil && cmp.Compare(x.element, hi) <= 0; x = x.next[0].node {
+			if !yield(x.element) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet in ascending order.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [SortedSet.ImmutableRange].
+*/
+func (thisSet *SortedSet[T]) MutableRange() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for x := thisSet.head.next[0].node; x != nil; x = x.next[0].node {
+			if !yield(x.element) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet in ascending order.
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *SortedSet[T]) ImmutableRange() iter.Seq[T] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray allocates an array of type T and adds all elements of thisSet to it in ascending order.
+*/
+func (thisSet *SortedSet[T]) ToArray() []T {
+	result := make([]T, 0, thisSet.size)
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
+
+/*
+Returns true if thisSet and thatSet contain the same elements. If thatSet is nil, Equals returns true if and only if thisSet is empty.
+*/
+func (thisSet *SortedSet[T]) Equals(thatSet *SortedSet[T]) bool {
+	if thatSet == nil {
+		return thisSet.size == 0
+	}
+	if thisSet.size != thatSet.size {
+		return false
+	}
+	x, y := thisSet.head.next[0].node, thatSet.head.next[0].node
+	for ; x != nil; x, y = x.next[0].node, y.next[0].node {
+		if cmp.Compare(x.element, y.element) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Returns true if thisSet contains all elements from thatSet. If thatSet is nil, ContainsAll returns true.
+*/
+func (thisSet *SortedSet[T]) ContainsAll(thatSet *SortedSet[T]) bool {
+	if thatSet == nil {
+		return true
+	}
+	if thatSet.size > thisSet.size {
+		return false
+	}
+	x := thisSet.head.next[0].node
+	for y := thatSet.head.next[0].node; y != nil; y = y.next[0].node {
+		for x != nil && cmp.Less(x.element, y.element) {
+			x = x.next[0].node
+		}
+		if x == nil || cmp.Compare(x.element, y.element) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Returns true if thisSet contains all of the given argument values.
+*/
+func (thisSet *SortedSet[T]) ContainsAllOf(args ...T) bool {
+	for _, e := range args {
+		if !thisSet.Contains(e) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Returns true if thisSet contains any element from thatSet. Returns false if thatSet is nil.
+*/
+func (thisSet *SortedSet[T]) ContainsAny(thatSet *SortedSet[T]) bool {
+	if thatSet == nil {
+		return false
+	}
+	found := false
+	sortedMerge(thisSet, thatSet, func(_ T, inThis, inThat bool) bool {
+		found = inThis && inThat
+		return !found
+	})
+	return found
+}
+
+// sortedMerge walks through the union of both sets in ascending order and reports for every element in which sets it is, until visit returns false.
+func sortedMerge[T cmp.Ordered](a, b *SortedSet[T], visit func(element T, inA, inB bool) bool) {
+	x, y := a.head.next[0].node, b.head.next[0].node
+	for x != nil || y != nil {
+		var ok bool
+		switch {
+		case y == nil || (x != nil && cmp.Less(x.element, y.element)):
+			ok = visit(x.element, true, false)
+			x = x.next[0].node
+		case x == nil || cmp.Less(y.element, x.element):
+			ok = visit(y.element, false, true)
+			y = y.next[0].node
+		default:
+			ok = visit(x.element, true, true)
+			x, y = x.next[0].node, y.next[0].node
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+func sortedCombine[T cmp.Ordered](a, b *SortedSet[T], keep func(inA, inB bool) bool) *SortedSet[T] {
+	var elements []T
+	sortedMerge(a, b, func(e T, inA, inB bool) bool {
+		if keep(inA, inB) {
+			elements = append(elements, e)
+		}
+		return true
+	})
+	return sortedSetFromSorted(elements)
+}
+
+/*
+Creates a new SortedSet as a mathematical union of the elements from thisSet and thatSet in linear time. If thatSet is nil, Unite returns a clone of thisSet.
+*/
+func (thisSet *SortedSet[T]) Unite(thatSet *SortedSet[T]) *SortedSet[T] {
+	if thatSet == nil {
+		return thisSet.Clone()
+	}
+	return sortedCombine(thisSet, thatSet, func(inA, inB bool) bool { return inA || inB })
+}
+
+/*
+Creates a new SortedSet as a mathematical intersection between thisSet and thatSet in linear time. If thatSet is nil, Intersect returns an empty SortedSet.
+*/
+func (thisSet *SortedSet[T]) Intersect(thatSet *SortedSet[T]) *SortedSet[T] {
+	if thatSet == nil {
+		return EmptySortedSet[T]()
+	}
+	return sortedCombine(thisSet, thatSet, func(inA, inB bool) bool { return inA && inB })
+}
+
+/*
+Creates a new SortedSet as a mathematical difference between thisSet and thatSet in linear time. If thatSet is nil, Subtract returns a clone of thisSet.
+*/
+func (thisSet *SortedSet[T]) Subtract(thatSet *SortedSet[T]) *SortedSet[T] {
+	if thatSet == nil {
+		return thisSet.Clone()
+	}
+	return sortedCombine(thisSet, thatSet, func(inA, inB bool) bool { return inA && !inB })
+}
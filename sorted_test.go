@@ -0,0 +1,179 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkSortedSetInvariants verifies the widths of all links against the positions on the lowest level.
+func checkSortedSetInvariants[T cmp.Ordered](t *testing.T, set *SortedSet[T]) {
+	t.Helper()
+	positions := make(map[*sortedNode[T]]uint32)
+	pos := uint32(0)
+	for x := set.head.next[0].node; x != nil; x = x.next[0].node {
+		pos++
+		positions[x] = pos
+	}
+	require.Equal(t, set.size, pos)
+	nodes := []*sortedNode[T]{&set.head}
+	for x := set.head.next[0].node; x != nil; x = x.next[0].node {
+		nodes = append(nodes, x)
+	}
+	for _, x := range nodes {
+		for l, link := range x.next {
+			target := set.size + 1
+			if link.node != nil {
+				target = positions[link.node]
+			}
+			require.Equal(t, target-positions[x], link.width, "width on level %d", l)
+		}
+	}
+}
+
+func TestSortedSetMatchesSortedSlice(t *testing.T) {
+	rng := rand.New(rand.NewPCG(13, 14)) //nolint:gosec
+	set := EmptySortedSet[int]()
+	expected := []int{}
+	for i := range 20_000 {
+		e := rng.IntN(3000)
+		idx, found := slices.BinarySearch(expected, e)
+		if rng.IntN(3) == 0 {
+			assert.Equal(t, found, set.Remove(e))
+			if found {
+				expected = slices.Delete(expected, idx, idx+1)
+			}
+		} else {
+			set.Add(e)
+			if !found {
+				expected = slices.Insert(expected, idx, e)
+			}
+		}
+		if i%2000 == 0 {
+			checkSortedSetInvariants(t, set)
+			require.Equal(t, expected, set.ToArray())
+			for j := 0; j < len(expected); j += 37 {
+				assert.Equal(t, expected[j], set.At(j))
+				assert.Equal(t, j, set.Rank(expected[j]))
+			}
+		}
+	}
+	for range 1000 {
+		q := rng.IntN(3200) - 100
+		idx, found := slices.BinarySearch(expected, q)
+		assert.Equal(t, found, set.Contains(q))
+		assert.Equal(t, idx, set.Rank(q))
+		floor, ok := set.Floor(q)
+		if found {
+			assert.Equal(t, q, floor)
+		} else if idx > 0 {
+			assert.Equal(t, expected[idx-1], floor)
+		} else {
+			assert.False(t, ok)
+		}
+		ceiling, ok := set.Ceiling(q)
+		if idx < len(expected) {
+			assert.Equal(t, expected[idx], ceiling)
+		} else {
+			assert.False(t, ok)
+		}
+		hi := q + rng.IntN(200)
+		hiIdx, hiFound := slices.BinarySearch(expected, hi)
+		if hiFound {
+			hiIdx++
+		}
+		assert.Equal(t, expected[idx:max(idx, hiIdx)], append([]int{}, slices.Collect(set.RangeBetween(q, hi))...))
+	}
+}
+
+func TestSortedSetOperations(t *testing.T) {
+	rng := rand.New(rand.NewPCG(15, 16)) //nolint:gosec
+	for range 20 {
+		a := Empty[uint16]()
+		b := Empty[uint16]()
+		for range rng.IntN(500) {
+			a.Add(uint16(rng.IntN(1000))) //nolint:gosec
+		}
+		for range rng.IntN(500) {
+			b.Add(uint16(rng.IntN(1000))) //nolint:gosec
+		}
+		sortedA := SortedSetFromSet3(a)
+		sortedB := SortedSetFromSet3(b)
+		checkSortedSetInvariants(t, sortedA)
+		assert.True(t, a.Equals(sortedA.ToSet3()))
+		union := sortedA.Unite(sortedB)
+		checkSortedSetInvariants(t, union)
+		assert.True(t, a.Unite(b).Equals(union.ToSet3()))
+		assert.True(t, a.Intersect(b).Equals(sortedA.Intersect(sortedB).ToSet3()))
+		assert.True(t, a.Subtract(b).Equals(sortedA.Subtract(sortedB).ToSet3()))
+		assert.Equal(t, a.ContainsAll(b), sortedA.ContainsAll(sortedB))
+		assert.Equal(t, a.ContainsAny(b), sortedA.ContainsAny(sortedB))
+		assert.Equal(t, a.Equals(b), sortedA.Equals(sortedB))
+		assert.True(t, union.ContainsAll(sortedB))
+		assert.True(t, sortedA.Equals(sortedA.Clone()))
+	}
+}
+
+func TestSortedSetBasics(t *testing.T) {
+	set := SortedSetFrom("pear", "apple", "fig", "apple")
+	assert.Equal(t, "{apple,fig,pear}", set.String())
+	assert.Equal(t, uint32(3), set.Size())
+	lo, _ := set.Min()
+	hi, _ := set.Max()
+	assert.Equal(t, "apple", lo)
+	assert.Equal(t, "pear", hi)
+	assert.True(t, set.ContainsAllOf("fig", "pear"))
+	assert.False(t, set.ContainsAllOf("fig", "kiwi"))
+	set.AddAllOf("kiwi", "banana")
+	assert.Equal(t, []string{"apple", "banana", "fig", "kiwi", "pear"}, slices.Collect(set.ImmutableRange()))
+	for e := range set.ImmutableRange() {
+		set.Remove(e)
+	}
+	assert.Equal(t, uint32(0), set.Size())
+	_, ok := set.Min()
+	assert.False(t, ok)
+	_, ok = set.Max()
+	assert.False(t, ok)
+	assert.PanicsWithValue(t, "set3: index 0 out of range [0,0)", func() { set.At(0) })
+	assert.True(t, set.Equals(nil))
+	assert.True(t, set.ContainsAll(nil))
+	assert.False(t, set.ContainsAny(nil))
+
+	set.AddAllOf("x", "y")
+	set.Clear()
+	assert.Equal(t, "{}", set.String())
+	set.Add("z")
+	checkSortedSetInvariants(t, set)
+	assert.Equal(t, uint32(0), SortedSetFromSet3[int](nil).Size())
+	var nilSet *SortedSet[int]
+	assert.Equal(t, "{nil}", nilSet.String())
+}
+
+func TestSortedSetNaN(t *testing.T) {
+	set := SortedSetFrom(1.0, math.NaN(), 2.0, math.NaN())
+	assert.Equal(t, uint32(3), set.Size())
+	set.Add(math.NaN())
+	assert.Equal(t, uint32(3), set.Size(), "NaN shall only be added once")
+	assert.True(t, set.Contains(math.NaN()))
+	assert.True(t, set.Remove(math.NaN()))
+	assert.Equal(t, []float64{1, 2}, set.ToArray())
+}
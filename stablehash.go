@@ -0,0 +1,111 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"reflect"
+	"unsafe"
+)
+
+// The hash function of Set3 (see maphash) is seeded by the Go runtime with a random
+// key on every process start. Data structures that leave the process, e.g. files,
+// need a hash function that yields the same values in every process. stableHash is
+// such a function. It hashes the memory representation of plain data types.
+
+const (
+	stablePrime1 uint64 = 0x9E3779B97F4A7C15
+	stablePrime2 uint64 = 0xC2B2AE3D27D4EB4F
+)
+
+func stableMix(h, w uint64) uint64 {
+	h ^= w
+	h *= stablePrime1
+	h = bits.RotateLeft64(h, 31)
+	h *= stablePrime2
+	return h
+}
+
+// stableFinalize is the finalizer of MurmurHash3 (fmix64).
+func stableFinalize(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xFF51AFD7ED558CCD
+	h ^= h >> 33
+	h *= 0xC4CEB9FE1A85EC53
+	h ^= h >> 33
+	return h
+}
+
+func stableHash(seed uint64, data []byte) uint64 {
+	h := seed ^ (uint64(len(data)) * stablePrime2)
+	for len(data) >= 8 {
+		h = stableMix(h, binary.LittleEndian.Uint64(data))
+		data = data[8:]
+	}
+	if len(data) > 0 {
+		var tail uint64
+		for i, b := range data {
+			tail |= uint64(b) << (8 * i)
+		}
+		h = stableMix(h, tail)
+	}
+	return stableFinalize(h)
+}
+
+// isPlainData returns true if values of type t can be compared and hashed by their
+// memory representation: no pointers, no padding bytes, and no floating point
+// numbers (for which == differs from bitwise equality, e.g. +0.0 == -0.0).
+func isPlainData(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Array:
+		return isPlainData(t.Elem())
+	case reflect.Struct:
+		var sum uintptr
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !isPlainData(f.Type) {
+				return false
+			}
+			sum += f.Type.Size()
+		}
+		return sum == t.Size() // no padding
+	default:
+		return false
+	}
+}
+
+// plainDataSize returns the size of T in bytes and whether T is a non-empty plain data type (see isPlainData).
+func plainDataSize[T any]() (int, bool) {
+	t := reflect.TypeFor[T]()
+	if t.Size() == 0 || !isPlainData(t) {
+		return 0, false
+	}
+	return int(t.Size()), true
+}
+
+// plainDataBytes returns the memory representation of *p. T must be a plain data type.
+func plainDataBytes[T any](p *T, size int) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(p)), size)
+}
+
+func isLittleEndianHost() bool {
+	one := uint16(1)
+	return *(*byte)(unsafe.Pointer(&one)) == 1
+}
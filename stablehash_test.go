@@ -0,0 +1,80 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPlainData(t *testing.T) {
+	type noPadding struct {
+		A uint32
+		B [2]uint16
+	}
+	type padding struct {
+		A uint8
+		B uint32
+	}
+	type nested struct {
+		A noPadding
+		B int64
+	}
+	type withString struct {
+		A uint64
+		B string
+	}
+	plain := []reflect.Type{
+		reflect.TypeFor[bool](), reflect.TypeFor[int](), reflect.TypeFor[uint8](), reflect.TypeFor[int64](),
+		reflect.TypeFor[uintptr](), reflect.TypeFor[[16]byte](), reflect.TypeFor[noPadding](), reflect.TypeFor[nested](),
+	}
+	notPlain := []reflect.Type{
+		reflect.TypeFor[string](), reflect.TypeFor[*int](), reflect.TypeFor[float64](), reflect.TypeFor[complex64](),
+		reflect.TypeFor[padding](), reflect.TypeFor[withString](), reflect.TypeFor[[2]string](), reflect.TypeFor[any](),
+	}
+	for _, tp := range plain {
+		assert.True(t, isPlainData(tp), "%v shall be plain data", tp)
+	}
+	for _, tp := range notPlain {
+		assert.False(t, isPlainData(tp), "%v shall not be plain data", tp)
+	}
+	_, ok := plainDataSize[struct{}]()
+	assert.False(t, ok, "empty types shall not be supported")
+	size, ok := plainDataSize[noPadding]()
+	assert.True(t, ok)
+	assert.Equal(t, 8, size)
+}
+
+func TestStableHash(t *testing.T) {
+	// the values must never change, as they are persisted in files
+	assert.Equal(t, stableHash(0, nil), stableHash(0, []byte{}))
+	assert.NotEqual(t, stableHash(0, []byte{0}), stableHash(0, []byte{0, 0}), "length shall be part of the hash")
+	assert.NotEqual(t, stableHash(1, []byte("abc")), stableHash(2, []byte("abc")), "seed shall be part of the hash")
+	assert.Equal(t, uint64(0xb90508f67414e752), stableHash(42, []byte("0123456789abcdefXYZ")))
+
+	// low bits are used for H2, bits 7..38 for the group index - both must be well distributed
+	h2 := make(map[uint64]int)
+	for i := range uint64(100_000) {
+		x := i
+		h := stableHash(0, plainDataBytes(&x, 8))
+		h2[h&0x7f]++
+	}
+	assert.Equal(t, 128, len(h2))
+	for _, c := range h2 {
+		assert.InDelta(t, 100_000/128, c, 150)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"iter"
+	"slices"
+)
+
+/*
+StringSet is a set of strings for very large sets. Unlike a Set3[string], whose group slots hold one string header per element that
+the garbage collector has to follow, a StringSet copies the strings into the pointer-free arena of a [BytesSet]. So a StringSet with
+millions of elements adds next to nothing to the mark phase of the garbage collector.
+
+The price is that the strings returned by the set, e.g. by [StringSet.MutableRange], are newly allocated copies.
+Use the underlying [StringSet.Bytes] to iterate without allocating.
+
+Removed strings stay in the arena as garbage until the next compaction, which happens automatically when strings are added,
+see [BytesSet]. So the arena stays bounded when strings are added and removed continuously. Call [StringSet.Compact] only to
+release memory after removing many strings from a set that will not grow anymore.
+
+Only strings are covered. For other element types that contain pointers, encode the elements into byte strings and use a [BytesSet],
+or use a plain data type (see [OpenMapped]) as element type of a Set3, whose slots then contain no pointers either.
+*/
+type StringSet struct {
+	bytes *BytesSet
+}
+
+/*
+EmptyStringSet creates a new and empty StringSet with a reasonable default initial capacity.
+
+Example:
+
+	set := EmptyStringSet()
+	set.Add("key")
+*/
+func EmptyStringSet() *StringSet {
+	return &StringSet{bytes: EmptyBytesSet()}
+}
+
+/*
+EmptyStringSetWithCapacity creates a new and empty StringSet that can hold initialCapacity strings with a total length of arenaCapacity bytes without being reorganized.
+
+Example:
+
+	set := EmptyStringSetWithCapacity(20_000_000, 400_000_000)
+*/
+func EmptyStringSetWithCapacity(initialCapacity uint32, arenaCapacity uint32) *StringSet {
+	return &StringSet{bytes: EmptyBytesSetWithCapacity(initialCapacity, arenaCapacity)}
+}
+
+/*
+StringSetFrom is a convenience constructor to directly create a StringSet from given arguments.
+
+Example:
+
+	set := StringSetFrom("a", "b", "c")
+*/
+func StringSetFrom(args ...string) *StringSet {
+	return StringSetFromArray(args)
+}
+
+/*
+StringSetFromArray is a convenience constructor to directly create a StringSet from the strings in data.
+
+Example:
+
+	set := StringSetFromArray([]string{"a", "b", "c"})
+*/
+func StringSetFromArray(data []string) *StringSet {
+	result := EmptyStringSetWithCapacity(uint32(len(data)), 0) //nolint:gosec
+	result.AddAllFromArray(data)
+	return result
+}
+
+/*
+StringSetFromSet3 is a convenience constructor to create a StringSet with the elements of set. nil is interpreted as empty set.
+*/
+func StringSetFromSet3[T ~string](set *Set3[T]) *StringSet {
+	if set == nil {
+		return EmptyStringSet()
+	}
+	result := EmptyStringSetWithCapacity(set.Size(), 0)
+	for e := range set.MutableRange() {
+		result.Add(string(e))
+	}
+	return result
+}
+
+/*
+ToSet3 creates a Set3[string] with the elements of thisSet.
+*/
+func (thisSet *StringSet) ToSet3() *Set3[string] {
+	result := EmptyWithCapacity[string](thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result.Add(e)
+	}
+	return result
+}
+
+/*
+Bytes returns the [BytesSet] that stores the elements of thisSet. Changes to one of them are visible in the other.
+*/
+func (thisSet *StringSet) Bytes() *BytesSet {
+	return thisSet.bytes
+}
+
+/*
+Returns a string representation of the elements of thisSet in Roster notation, each element quoted. The order of the elements in the result is arbitrary.
+*/
+func (thisSet *StringSet) String() string {
+	if thisSet == nil {
+		return "{nil}"
+	}
+	return thisSet.bytes.String()
+}
+
+/*
+Size returns the number of elements in thisSet.
+*/
+func (thisSet *StringSet) Size() uint32 {
+	return thisSet.bytes.Size()
+}
+
+/*
+Contains returns true if thisSet contains str. It does not allocate.
+*/
+func (thisSet *StringSet) Contains(str string) bool {
+	return thisSet.bytes.ContainsString(str)
+}
+
+/*
+Returns true if thisSet contains all of the given argument values.
+*/
+func (thisSet *StringSet) ContainsAllOf(args ...string) bool {
+	for _, e := range args {
+		if !thisSet.Contains(e) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Add copies str into thisSet, if thisSet does not already contain it. Panics if the strings in thisSet would exceed 4 GiB.
+*/
+func (thisSet *StringSet) Add(str string) {
+	thisSet.bytes.AddString(str)
+}
+
+/*
+Inserts all parameter values into thisSet.
+*/
+func (thisSet *StringSet) AddAllOf(args ...string) {
+	thisSet.AddAllFromArray(args)
+}
+
+/*
+Inserts all strings from the given data array into thisSet.
+*/
+func (thisSet *StringSet) AddAllFromArray(data []string) {
+	for _, e := range data {
+		thisSet.Add(e)
+	}
+}
+
+/*
+Removes str from thisSet, returns whether or not str was in thisSet. The memory of str is reclaimed by a later Add or by [StringSet.Compact].
+*/
+func (thisSet *StringSet) Remove(str string) bool {
+	return thisSet.bytes.RemoveString(str)
+}
+
+/*
+Clear removes all elements from thisSet.
+*/
+func (thisSet *StringSet) Clear() {
+	thisSet.bytes.Clear()
+}
+
+/*
+Clone creates a copy of thisSet.
+*/
+func (thisSet *StringSet) Clone() *StringSet {
+	return &StringSet{bytes: thisSet.bytes.Clone()}
+}
+
+/*
+Compact drops the bytes of removed strings, see [BytesSet.Compact].
+*/
+func (thisSet *StringSet) Compact() {
+	thisSet.bytes.Compact()
+}
+
+/*
+Iterates over all elements in thisSet. Every yielded string is a new copy.
+
+Caution: If thisSet is changed during the iteration, the result is unpredictable. So if you want to add or remove elements to or from thisSet during the itration, choose [StringSet.ImmutableRange].
+*/
+func (thisSet *StringSet) MutableRange() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for b := range thisSet.bytes.MutableRange() {
+			if !yield(string(b)) {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over all elements in thisSet.
+
+Makes an internal copy of the stored elements first, so you can add or remove elements to or from thisSet during the itration.
+*/
+func (thisSet *StringSet) ImmutableRange() iter.Seq[string] {
+	return slices.Values(thisSet.ToArray())
+}
+
+/*
+ToArray allocates an array of strings and adds all elements of thisSet to it. The order of the elements in the resulting array is arbitrary.
+*/
+func (thisSet *StringSet) ToArray() []string {
+	result := make([]string, 0, thisSet.Size())
+	for e := range thisSet.MutableRange() {
+		result = append(result, e)
+	}
+	return result
+}
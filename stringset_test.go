@@ -0,0 +1,129 @@
+// Copyright 2024 TomTonic
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package set3
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringSetBasics(t *testing.T) {
+	set := StringSetFrom("a", "b", "c", "a")
+	assert.Equal(t, uint32(3), set.Size())
+	assert.True(t, set.ContainsAllOf("a", "b", "c"))
+	assert.False(t, set.Contains("d"))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, set.ToArray())
+	assert.True(t, set.ToSet3().Equals(From("a", "b", "c")))
+	assert.True(t, set.Bytes().ContainsBytes([]byte("b")))
+
+	clone := set.Clone()
+	assert.True(t, set.Remove("a"))
+	assert.False(t, set.Remove("a"))
+	set.Compact()
+	assert.Equal(t, uint64(2), set.Bytes().ArenaSize())
+	assert.True(t, clone.Contains("a"))
+	for e := range clone.ImmutableRange() {
+		clone.Remove(e)
+	}
+	assert.Equal(t, "{}", clone.String())
+	set.Clear()
+	assert.Equal(t, uint32(0), set.Size())
+
+	var nilSet *StringSet
+	assert.Equal(t, "{nil}", nilSet.String())
+}
+
+func TestStringSetFromSet3(t *testing.T) {
+	type name string
+	source := From[name]("x", "y")
+	set := StringSetFromSet3(source)
+	assert.ElementsMatch(t, []string{"x", "y"}, set.ToArray())
+	set.AddAllOf("x", "z")
+	assert.Equal(t, uint32(3), set.Size())
+	assert.Equal(t, "{\"z\"}", StringSetFrom("z").String())
+
+	var nilSet *Set3[string]
+	assert.Equal(t, uint32(0), StringSetFromSet3(nilSet).Size(), "nil shall be interpreted as empty set")
+}
+
+func TestStringSetChurnKeepsArenaBounded(t *testing.T) {
+	set := EmptyStringSet()
+	const window = 1000
+	key := func(i int) string { return "session-" + strconv.Itoa(1_000_000+i) }
+	maxArena := uint64(0)
+	for i := range 100_000 {
+		set.Add(key(i))
+		if i >= window {
+			assert.True(t, set.Remove(key(i-window)))
+		}
+		maxArena = max(maxArena, set.Bytes().ArenaSize())
+	}
+	live := uint64(window * len(key(0)))
+	assert.LessOrEqual(t, maxArena, 2*live+uint64(2*len(key(0))), "removed strings shall be reclaimed without calling Compact")
+	assert.Equal(t, uint32(window), set.Size())
+	assert.True(t, set.Contains(key(99_999)))
+	assert.False(t, set.Contains(key(0)))
+}
+
+func genGCBenchStrings(n int) []string {
+	result := make([]string, n)
+	for i := range result {
+		result[i] = fmt.Sprintf("user-%012d", i)
+	}
+	return result
+}
+
+// BenchmarkGCPauseStringSets measures a full garbage collection while a large set is alive. The mark phase has to follow
+// every string header in the slots of a Set3[string], but nothing in a StringSet. ns/op is the duration of runtime.GC,
+// stw-ns/gc the part of it that stops the world.
+func BenchmarkGCPauseStringSets(b *testing.B) {
+	for _, n := range []int{100_000, 1_000_000} {
+		b.Run("n="+strconv.Itoa(n), func(b *testing.B) {
+			b.Run("Set3[string]", func(b *testing.B) {
+				set := FromArray(genGCBenchStrings(n))
+				benchmarkGCPause(b)
+				runtime.KeepAlive(set)
+			})
+			b.Run("StringSet", func(b *testing.B) {
+				set := StringSetFromArray(genGCBenchStrings(n))
+				benchmarkGCPause(b)
+				runtime.KeepAlive(set)
+			})
+		})
+	}
+}
+
+func benchmarkGCPause(b *testing.B) {
+	runtime.GC()
+	var pauses time.Duration
+	var before, after runtime.MemStats
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+		runtime.GC()
+		b.StopTimer()
+		runtime.ReadMemStats(&after)
+		b.StartTimer()
+		pauses += time.Duration(after.PauseTotalNs - before.PauseTotalNs) //nolint:gosec
+	}
+	b.ReportMetric(float64(pauses.Nanoseconds())/float64(b.N), "stw-ns/gc")
+}